@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+func (s *mysqlStore) ReadLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT throttle_key, failures, last_failure_at
+		FROM login_throttles WHERE throttle_key = ?`, key,
+	).Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt); err != nil {
+		return nil, wrapError(err)
+	}
+	return &throttle, nil
+}
+
+func (s *mysqlStore) RecordLoginFailure(ctx context.Context, key string, at time.Time, since time.Time) (int, error) {
+	var failures int
+	err := s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*mysqlStore).db
+		// failures is assigned first, so it still sees the old last_failure_at
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO login_throttles (throttle_key, failures, last_failure_at) VALUES (?, 1, ?)
+			ON DUPLICATE KEY UPDATE
+				failures = IF(last_failure_at < ?, 1, failures + 1),
+				last_failure_at = VALUES(last_failure_at)`, key, at, since); err != nil {
+			return wrapError(err)
+		}
+		return wrapError(q.QueryRowContext(ctx,
+			`SELECT failures FROM login_throttles WHERE throttle_key = ?`, key).Scan(&failures))
+	})
+	return failures, err
+}
+
+func (s *mysqlStore) LockLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	// Only a row that exists can be locked, a new one has no failures
+	if _, err := s.db.ExecContext(ctx, `INSERT IGNORE INTO login_throttles (throttle_key) VALUES (?)`, key); err != nil {
+		return nil, wrapError(err)
+	}
+	var throttle models.LoginThrottle
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT throttle_key, failures, last_failure_at
+		FROM login_throttles WHERE throttle_key = ? FOR UPDATE`, key,
+	).Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt); err != nil {
+		return nil, wrapError(err)
+	}
+	return &throttle, nil
+}
+
+func (s *mysqlStore) ForgiveLoginFailure(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE login_throttles SET failures = GREATEST(failures - 1, 0)
+		WHERE throttle_key = ?`, key)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) DeleteLoginThrottle(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE throttle_key = ?`, key)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	var userId sql.NullString
+	if event.UserId != "" {
+		userId = sql.NullString{String: event.UserId, Valid: true}
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (user_id, event, username, ip, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userId, event.Event, event.Username, event.IP, event.UserAgent, event.CreatedAt)
+	if err != nil {
+		return wrapError(err)
+	}
+	event.Id, err = result.LastInsertId()
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadAuditEvents(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, event, username, ip, user_agent, created_at
+		FROM audit_log ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		var userId sql.NullString
+		if err := rows.Scan(&event.Id, &userId, &event.Event, &event.Username, &event.IP, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, wrapError(err)
+		}
+		event.UserId = userId.String
+		events = append(events, event)
+	}
+	return events, wrapError(rows.Err())
+}
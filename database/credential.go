@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+const credentialColumns = `id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at, last_used_at`
+
+func scanCredential(row scanner) (*models.Credential, error) {
+	var credential models.Credential
+	var transports string
+	var lastUsed sql.NullTime
+	if err := row.Scan(&credential.Id, &credential.UserId, &credential.Name, &credential.PublicKey, &credential.AttestationType,
+		&transports, &credential.AAGUID, &credential.SignCount, &credential.BackupEligible, &credential.BackupState,
+		&credential.CreatedAt, &lastUsed); err != nil {
+		return nil, wrapError(err)
+	}
+	if transports != "" {
+		credential.Transports = strings.Split(transports, ",")
+	}
+	credential.LastUsedAt = lastUsed.Time
+	return &credential, nil
+}
+
+func (s *mysqlStore) CreateCredential(ctx context.Context, credential *models.Credential) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO credentials (id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		credential.Id, credential.UserId, credential.Name, credential.PublicKey, credential.AttestationType,
+		strings.Join(credential.Transports, ","), credential.AAGUID, credential.SignCount,
+		credential.BackupEligible, credential.BackupState, credential.CreatedAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadCredential(ctx context.Context, id []byte) (*models.Credential, error) {
+	return scanCredential(s.db.QueryRowContext(ctx, `
+		SELECT `+credentialColumns+`
+		FROM credentials WHERE id = ?`, id))
+}
+
+func (s *mysqlStore) ReadCredentials(ctx context.Context, userId string) ([]models.Credential, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+credentialColumns+`
+		FROM credentials WHERE user_id = ? ORDER BY created_at`, userId)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var credentials []models.Credential
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+	return credentials, wrapError(rows.Err())
+}
+
+func (s *mysqlStore) UseCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, at time.Time) error {
+	// Authenticators without a counter always send 0, and the row may not
+	// change at all, which MySQL reports as no rows affected
+	if signCount == 0 {
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE credentials SET backup_state = ?, last_used_at = ?
+			WHERE id = ? AND sign_count = 0`, backupState, at, id)
+		return wrapError(err)
+	}
+	return expectRows(s.db.ExecContext(ctx, `
+		UPDATE credentials SET sign_count = ?, backup_state = ?, last_used_at = ?
+		WHERE id = ? AND sign_count < ?`,
+		signCount, backupState, at, id, signCount))
+}
+
+func (s *mysqlStore) DeleteCredential(ctx context.Context, userId string, id []byte) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM credentials WHERE user_id = ? AND id = ?`, userId, id))
+}
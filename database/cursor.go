@@ -0,0 +1,105 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for pagination tokens we didn't hand out.
+var ErrInvalidCursor = errors.New("database: invalid cursor")
+
+// Cursor points at the last row of a page. Lists are ordered newest first by
+// (created_at, id), so the next page starts strictly after this position and
+// stays stable while other users add or remove rows.
+type Cursor struct {
+	CreatedAt time.Time
+	Id        string
+}
+
+// Encode turns the cursor into the opaque token sent to clients.
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.Id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a token produced by Encode. An empty token means the
+// first page and decodes to nil.
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.Unix(0, unixNano).UTC(), Id: id}, nil
+}
+
+// before reports whether a row at (createdAt, id) comes after the cursor in
+// newest-first order, ie. belongs on the next page.
+func (c *Cursor) before(createdAt time.Time, id string) bool {
+	if c == nil {
+		return true
+	}
+	return createdAt.Before(c.CreatedAt) || (createdAt.Equal(c.CreatedAt) && id < c.Id)
+}
+
+// keysetClause is the SQL equivalent of before for a table alias.
+func keysetClause(c *Cursor, alias string) (string, []any) {
+	if c == nil {
+		return "", nil
+	}
+	return " AND (" + alias + "created_at < ? OR (" + alias + "created_at = ? AND " + alias + "id < ?))",
+		[]any{c.CreatedAt, c.CreatedAt, c.Id}
+}
+
+// nextCursor trims the extra row fetched to detect another page and returns
+// the token for it, or "" on the last page.
+func nextCursor[T any](items []T, limit int, key func(T) Cursor) ([]T, string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+	items = items[:limit]
+	return items, key(items[len(items)-1]).Encode()
+}
+
+// Search results are ordered by relevance rather than by time, so their
+// cursors carry the offset of the next page instead.
+
+func encodeOffset(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeOffset(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "offset:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(raw), "offset:") {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// nextOffset is nextCursor for offset-paginated results.
+func nextOffset[T any](items []T, offset int, limit int) ([]T, string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+	return items[:limit], encodeOffset(offset + limit)
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrNotFound is returned when the requested row (or a row it refers to)
+	// does not exist.
+	ErrNotFound = errors.New("database: not found")
+	// ErrConflict is returned when a write violates a unique constraint, eg. a
+	// duplicate username or email.
+	ErrConflict = errors.New("database: conflict")
+
+	// Conflicts reported by the availability checks during signup
+	ErrUsernameTaken = fmt.Errorf("%w: username already taken", ErrConflict)
+	ErrEmailTaken    = fmt.Errorf("%w: email already registered", ErrConflict)
+)
+
+// MySQL server error numbers we translate into typed errors
+const (
+	mysqlDuplicateEntry  = 1062
+	mysqlNoReferencedRow = 1452
+)
+
+// wrapError translates driver errors into ErrNotFound/ErrConflict and wraps
+// everything else, so callers can tell a missing row from a failing database.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlDuplicateEntry:
+			return fmt.Errorf("%w: %s", ErrConflict, mysqlErr.Message)
+		case mysqlNoReferencedRow:
+			return fmt.Errorf("%w: %s", ErrNotFound, mysqlErr.Message)
+		}
+	}
+	return fmt.Errorf("database: %w", err)
+}
+
+// expectRows returns ErrNotFound when a DELETE or UPDATE matched nothing.
+func expectRows(result sql.Result, err error) error {
+	if err != nil {
+		return wrapError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return wrapError(err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
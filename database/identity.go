@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+const identityColumns = `provider, subject, user_id, created_at`
+
+func scanIdentity(row scanner) (*models.Identity, error) {
+	var identity models.Identity
+	if err := row.Scan(&identity.Provider, &identity.Subject, &identity.UserId, &identity.CreatedAt); err != nil {
+		return nil, wrapError(err)
+	}
+	return &identity, nil
+}
+
+func (s *mysqlStore) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO identities (provider, subject, user_id, created_at)
+		VALUES (?, ?, ?, ?)`,
+		identity.Provider, identity.Subject, identity.UserId, identity.CreatedAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadIdentity(ctx context.Context, provider string, subject string) (*models.Identity, error) {
+	return scanIdentity(s.db.QueryRowContext(ctx, `
+		SELECT `+identityColumns+`
+		FROM identities WHERE provider = ? AND subject = ?`, provider, subject))
+}
+
+func (s *mysqlStore) ReadIdentities(ctx context.Context, userId string) ([]models.Identity, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+identityColumns+`
+		FROM identities WHERE user_id = ? ORDER BY provider`, userId)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var identities []models.Identity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+	return identities, wrapError(rows.Err())
+}
+
+func (s *mysqlStore) DeleteIdentity(ctx context.Context, userId string, provider string) error {
+	return expectRows(s.db.ExecContext(ctx,
+		`DELETE FROM identities WHERE user_id = ? AND provider = ?`, userId, provider))
+}
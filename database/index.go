@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// invertedIndex is the memory backend's stand-in for a FULLTEXT index.
+type invertedIndex struct {
+	postings map[string]map[string]int // word -> doc id -> occurrences
+	docs     map[string][]string       // doc id -> its words in order
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings: map[string]map[string]int{},
+		docs:     map[string][]string{},
+	}
+}
+
+func (x *invertedIndex) clone() *invertedIndex {
+	clone := &invertedIndex{
+		postings: make(map[string]map[string]int, len(x.postings)),
+		docs:     cloneMap(x.docs),
+	}
+	for word, docs := range x.postings {
+		clone.postings[word] = cloneMap(docs)
+	}
+	return clone
+}
+
+// add indexes text under id, replacing whatever id had before.
+func (x *invertedIndex) add(id string, text string) {
+	x.remove(id)
+	words := tokenize(text)
+	x.docs[id] = words
+	for _, word := range words {
+		if x.postings[word] == nil {
+			x.postings[word] = map[string]int{}
+		}
+		x.postings[word][id]++
+	}
+}
+
+func (x *invertedIndex) remove(id string) {
+	for _, word := range x.docs[id] {
+		delete(x.postings[word], id)
+		if len(x.postings[word]) == 0 {
+			delete(x.postings, word)
+		}
+	}
+	delete(x.docs, id)
+}
+
+// match scores every doc containing all the query's terms and phrases by
+// tf-idf. It returns nil for a query without any.
+func (x *invertedIndex) match(query SearchQuery) map[string]float64 {
+	words := append([]string{}, query.Terms...)
+	for _, phrase := range query.Phrases {
+		words = append(words, phrase...)
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	scores := map[string]float64{}
+	for id := range x.postings[words[0]] {
+		scores[id] = 0
+	}
+	for _, word := range words {
+		docs := x.postings[word]
+		idf := math.Log(1 + float64(len(x.docs))/float64(len(docs)+1))
+		for id := range scores {
+			if docs[id] == 0 {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += float64(docs[id]) * idf
+		}
+	}
+	for id := range scores {
+		for _, phrase := range query.Phrases {
+			if !containsRun(x.docs[id], phrase) {
+				delete(scores, id)
+				break
+			}
+		}
+	}
+	return scores
+}
+
+func containsRun(words []string, run []string) bool {
+outer:
+	for i := 0; i+len(run) <= len(words); i++ {
+		for j := range run {
+			if words[i+j] != run[j] {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// hasPrefixes reports whether every term starts one of the doc's words.
+func (x *invertedIndex) hasPrefixes(id string, terms []string) bool {
+	for _, term := range terms {
+		found := false
+		for _, word := range x.docs[id] {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type ranked[T any] struct {
+	item  T
+	score float64
+}
+
+// rankPage orders items by score, then newest first, and returns the page at
+// offset.
+func rankPage[T any](items []ranked[T], offset int, limit int, key func(T) Cursor) ([]T, string) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].score != items[j].score {
+			return items[i].score > items[j].score
+		}
+		a, b := key(items[i].item), key(items[j].item)
+		return a.before(b.CreatedAt, b.Id)
+	})
+	var page []T
+	for i := offset; i < len(items) && i <= offset+limit; i++ {
+		page = append(page, items[i].item)
+	}
+	return nextOffset(page, offset, limit)
+}
+
+func (s *memoryStore) SearchUsers(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.UserSummary, string, error) {
+	offset, err := decodeOffset(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if query.Text == "" {
+		return nil, "", nil
+	}
+	s.rlock()
+	defer s.runlock()
+	text := strings.ToLower(query.Text)
+	var matches []ranked[models.UserSummary]
+	for id, user := range s.users {
+		var score float64
+		username := strings.ToLower(user.Username)
+		switch {
+		case username == text:
+			score = 3
+		case strings.HasPrefix(username, text):
+			score = 2
+		case len(query.Terms) > 0 && s.userIndex.hasPrefixes(id, query.Terms):
+			score = 1
+		default:
+			continue
+		}
+		matches = append(matches, ranked[models.UserSummary]{models.UserSummary{User: *copyUser(user)}, score})
+	}
+	users, next := rankPage(matches, offset, limit, func(summary models.UserSummary) Cursor {
+		return Cursor{summary.CreatedAt, summary.Id}
+	})
+	for i := range users {
+		users[i].Followers = len(s.followers(users[i].Id))
+		users[i].Following = len(s.follows[users[i].Id])
+		users[i].Posts = s.postsCount(users[i].Id)
+	}
+	return users, next, nil
+}
+
+func (s *memoryStore) SearchPosts(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.Post, string, error) {
+	offset, err := decodeOffset(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	s.rlock()
+	defer s.runlock()
+
+	var scores map[string]float64
+	if len(query.Terms) > 0 || len(query.Phrases) > 0 {
+		// Body matches count fully, the best matching comment half
+		scores = s.postIndex.match(query)
+		best := map[string]float64{}
+		for commentId, score := range s.commentIndex.match(query) {
+			postId := s.comments[commentId].PostId
+			best[postId] = math.Max(best[postId], score)
+		}
+		for postId, score := range best {
+			scores[postId] += 0.5 * score
+		}
+	} else if query.From != "" {
+		scores = map[string]float64{}
+		for id := range s.posts {
+			scores[id] = 0
+		}
+	}
+
+	var matches []ranked[models.Post]
+	for id, score := range scores {
+		post := s.posts[id]
+		author := s.users[post.UserId]
+		if query.From != "" && !strings.EqualFold(author.Username, query.From) {
+			continue
+		}
+		post.Username = author.Username
+		post.Avatar = copyUser(author).Avatar
+		matches = append(matches, ranked[models.Post]{post, score})
+	}
+	posts, next := rankPage(matches, offset, limit, postCursor)
+	return posts, next, nil
+}
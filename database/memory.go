@@ -0,0 +1,1367 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// memoryStore keeps everything in process memory. It needs no server and
+// starts empty, which makes it handy for local development and tests. It's
+// only meant for those: every transaction copies the whole store and runs
+// alone, which gets slow as the data grows.
+type memoryStore struct {
+	mu   *sync.RWMutex
+	inTx bool // the lock is already held by WithTx
+	*memoryData
+}
+
+// identityKey is the primary key of the identities table.
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+type memoryData struct {
+	users         map[string]models.User
+	oauthUsers    map[string]bool
+	identities    map[identityKey]models.Identity
+	sessions      map[string]models.Session
+	twoFactor     map[string]models.TwoFactor
+	recoveryCodes map[string]map[string]bool   // user id -> code hashes
+	credentials   map[string]models.Credential // string(credential id) -> passkey
+	apiTokens     map[string]models.APIToken   // id -> token
+	throttles     map[string]models.LoginThrottle
+	audit         []models.AuditEvent // oldest first
+	resets        map[string]models.PasswordReset
+	emailChanges  map[string]models.EmailChange
+	verifications map[string]string // id -> token
+	mailSends     map[string]models.MailSends
+	posts         map[string]models.Post
+	follows       map[string]map[string]bool // user_id -> follow_id
+	votes         map[string]map[string]bool // post id -> user_id
+	comments      map[string]models.Comment
+
+	userIndex    *invertedIndex // usernames
+	postIndex    *invertedIndex // post bodies
+	commentIndex *invertedIndex // comment bodies
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		mu: &sync.RWMutex{},
+		memoryData: &memoryData{
+			users:         map[string]models.User{},
+			oauthUsers:    map[string]bool{},
+			identities:    map[identityKey]models.Identity{},
+			sessions:      map[string]models.Session{},
+			twoFactor:     map[string]models.TwoFactor{},
+			recoveryCodes: map[string]map[string]bool{},
+			credentials:   map[string]models.Credential{},
+			apiTokens:     map[string]models.APIToken{},
+			throttles:     map[string]models.LoginThrottle{},
+			resets:        map[string]models.PasswordReset{},
+			emailChanges:  map[string]models.EmailChange{},
+			verifications: map[string]string{},
+			mailSends:     map[string]models.MailSends{},
+			posts:         map[string]models.Post{},
+			follows:       map[string]map[string]bool{},
+			votes:         map[string]map[string]bool{},
+			comments:      map[string]models.Comment{},
+			userIndex:     newInvertedIndex(),
+			postIndex:     newInvertedIndex(),
+			commentIndex:  newInvertedIndex(),
+		},
+	}
+}
+
+func (s *memoryStore) lock() {
+	if !s.inTx {
+		s.mu.Lock()
+	}
+}
+
+func (s *memoryStore) unlock() {
+	if !s.inTx {
+		s.mu.Unlock()
+	}
+}
+
+func (s *memoryStore) rlock() {
+	if !s.inTx {
+		s.mu.RLock()
+	}
+}
+
+func (s *memoryStore) runlock() {
+	if !s.inTx {
+		s.mu.RUnlock()
+	}
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	clone := make(map[K]V, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func cloneSets(m map[string]map[string]bool) map[string]map[string]bool {
+	clone := make(map[string]map[string]bool, len(m))
+	for k, set := range m {
+		clone[k] = cloneMap(set)
+	}
+	return clone
+}
+
+func (d *memoryData) clone() *memoryData {
+	return &memoryData{
+		users:         cloneMap(d.users),
+		oauthUsers:    cloneMap(d.oauthUsers),
+		identities:    cloneMap(d.identities),
+		sessions:      cloneMap(d.sessions),
+		twoFactor:     cloneMap(d.twoFactor),
+		recoveryCodes: cloneSets(d.recoveryCodes),
+		credentials:   cloneMap(d.credentials),
+		apiTokens:     cloneMap(d.apiTokens),
+		throttles:     cloneMap(d.throttles),
+		audit:         slices.Clone(d.audit),
+		resets:        cloneMap(d.resets),
+		emailChanges:  cloneMap(d.emailChanges),
+		verifications: cloneMap(d.verifications),
+		mailSends:     cloneMap(d.mailSends),
+		posts:         cloneMap(d.posts),
+		follows:       cloneSets(d.follows),
+		votes:         cloneSets(d.votes),
+		comments:      cloneMap(d.comments),
+		userIndex:     d.userIndex.clone(),
+		postIndex:     d.postIndex.clone(),
+		commentIndex:  d.commentIndex.clone(),
+	}
+}
+
+// WithTx holds the write lock for the whole of fn and restores a snapshot of
+// the data if fn fails, so the memory backend gets the same all-or-nothing
+// behaviour as a SQL transaction. The snapshot is a deep copy of everything,
+// so a transaction costs as much as the store is big; fine for tests and
+// development, not for production.
+func (s *memoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	s.lock()
+	defer s.unlock()
+	snapshot := s.memoryData.clone()
+	if err := fn(&memoryStore{mu: s.mu, inTx: true, memoryData: s.memoryData}); err != nil {
+		*s.memoryData = *snapshot
+		return err
+	}
+	return nil
+}
+
+func copyUser(user models.User) *models.User {
+	if user.Email != nil {
+		email := *user.Email
+		user.Email = &email
+	}
+	if user.Avatar != nil {
+		avatar := *user.Avatar
+		user.Avatar = &avatar
+	}
+	return &user
+}
+
+func (s *memoryStore) userByName(username string) (models.User, bool) {
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+func (s *memoryStore) userByEmail(email string) (models.User, bool) {
+	for _, user := range s.users {
+		if user.Email != nil && *user.Email == email {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+func (s *memoryStore) usernames(ids map[string]bool) []string {
+	var names []string
+	for id := range ids {
+		if user, ok := s.users[id]; ok {
+			names = append(names, user.Username)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *memoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[user.Id]; ok {
+		return ErrConflict
+	}
+	if _, ok := s.userByName(user.Username); ok {
+		return ErrConflict
+	}
+	if user.Email != nil {
+		if _, ok := s.userByEmail(*user.Email); ok {
+			return ErrConflict
+		}
+	}
+	s.users[user.Id] = *copyUser(*user)
+	s.userIndex.add(user.Id, user.Username)
+	return nil
+}
+
+func (s *memoryStore) CreateOAuthUser(ctx context.Context, id string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	if s.oauthUsers[id] {
+		return ErrConflict
+	}
+	s.oauthUsers[id] = true
+	return nil
+}
+
+func (s *memoryStore) ReadUserByName(ctx context.Context, username string) (*models.User, error) {
+	s.rlock()
+	defer s.runlock()
+	if user, ok := s.userByName(username); ok {
+		return copyUser(user), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.rlock()
+	defer s.runlock()
+	if user, ok := s.userByEmail(email); ok {
+		return copyUser(user), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadUserById(ctx context.Context, id string) (*models.User, error) {
+	s.rlock()
+	defer s.runlock()
+	if user, ok := s.users[id]; ok {
+		return copyUser(user), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) IsOAuthUser(ctx context.Context, id string) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.oauthUsers[id], nil
+}
+
+func (s *memoryStore) DeleteOAuthUser(ctx context.Context, id string) error {
+	s.lock()
+	defer s.unlock()
+	if !s.oauthUsers[id] {
+		return ErrNotFound
+	}
+	delete(s.oauthUsers, id)
+	return nil
+}
+
+func (s *memoryStore) UpdateUser(ctx context.Context, id string, updates map[string]any) error {
+	s.lock()
+	defer s.unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for column, value := range updates {
+		switch column {
+		case "email":
+			email, _ := value.(string)
+			if other, taken := s.userByEmail(email); taken && other.Id != id {
+				return ErrConflict
+			}
+			user.Email = &email
+		case "username":
+			username, _ := value.(string)
+			if other, taken := s.userByName(username); taken && other.Id != id {
+				return ErrConflict
+			}
+			user.Username = username
+		case "password":
+			user.Password, _ = value.(string)
+		case "verified":
+			user.Verified, _ = value.(bool)
+		case "avatar":
+			avatar, _ := value.(string)
+			user.Avatar = &avatar
+		default:
+			return fmt.Errorf("database: unknown column %q", column)
+		}
+	}
+	s.users[id] = user
+	s.userIndex.add(id, user.Username)
+	return nil
+}
+
+func (s *memoryStore) DeleteUser(ctx context.Context, id string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	// Mirror the ON DELETE CASCADE rules of the MySQL schema
+	delete(s.users, id)
+	s.userIndex.remove(id)
+	delete(s.oauthUsers, id)
+	for key, identity := range s.identities {
+		if identity.UserId == id {
+			delete(s.identities, key)
+		}
+	}
+	for sessionId, session := range s.sessions {
+		if session.UserId == id {
+			delete(s.sessions, sessionId)
+		}
+	}
+	delete(s.twoFactor, id)
+	delete(s.recoveryCodes, id)
+	for key, credential := range s.credentials {
+		if credential.UserId == id {
+			delete(s.credentials, key)
+		}
+	}
+	for tokenId, token := range s.apiTokens {
+		if token.UserId == id {
+			delete(s.apiTokens, tokenId)
+		}
+	}
+	for i := range s.audit {
+		if s.audit[i].UserId == id {
+			s.audit[i].UserId = ""
+		}
+	}
+	for hash, reset := range s.resets {
+		if reset.UserId == id {
+			delete(s.resets, hash)
+		}
+	}
+	for hash, change := range s.emailChanges {
+		if change.UserId == id {
+			delete(s.emailChanges, hash)
+		}
+	}
+	delete(s.follows, id)
+	for _, followed := range s.follows {
+		delete(followed, id)
+	}
+	for postId, post := range s.posts {
+		if post.UserId == id {
+			s.deletePost(postId)
+		}
+	}
+	for _, voters := range s.votes {
+		delete(voters, id)
+	}
+	for commentId, comment := range s.comments {
+		if comment.UserId == id {
+			delete(s.comments, commentId)
+			s.commentIndex.remove(commentId)
+		}
+	}
+	return nil
+}
+
+// LockUser has nothing to do, WithTx already holds the write lock.
+func (s *memoryStore) LockUser(ctx context.Context, id string) error {
+	s.rlock()
+	defer s.runlock()
+	if _, ok := s.users[id]; !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[identity.UserId]; !ok {
+		return ErrNotFound
+	}
+	key := identityKey{identity.Provider, identity.Subject}
+	if _, ok := s.identities[key]; ok {
+		return ErrConflict
+	}
+	for _, other := range s.identities {
+		if other.UserId == identity.UserId && other.Provider == identity.Provider {
+			return ErrConflict
+		}
+	}
+	s.identities[key] = *identity
+	return nil
+}
+
+func (s *memoryStore) ReadIdentity(ctx context.Context, provider string, subject string) (*models.Identity, error) {
+	s.rlock()
+	defer s.runlock()
+	if identity, ok := s.identities[identityKey{provider, subject}]; ok {
+		return &identity, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadIdentities(ctx context.Context, userId string) ([]models.Identity, error) {
+	s.rlock()
+	defer s.runlock()
+	var identities []models.Identity
+	for _, identity := range s.identities {
+		if identity.UserId == userId {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Provider < identities[j].Provider
+	})
+	return identities, nil
+}
+
+func (s *memoryStore) DeleteIdentity(ctx context.Context, userId string, provider string) error {
+	s.lock()
+	defer s.unlock()
+	for key, identity := range s.identities {
+		if identity.UserId == userId && identity.Provider == provider {
+			delete(s.identities, key)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[session.UserId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.sessions[session.Id]; ok {
+		return ErrConflict
+	}
+	s.sessions[session.Id] = *session
+	return nil
+}
+
+func (s *memoryStore) ReadSession(ctx context.Context, id string) (*models.Session, error) {
+	s.rlock()
+	defer s.runlock()
+	if session, ok := s.sessions[id]; ok {
+		return &session, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadSessions(ctx context.Context, userId string) ([]models.Session, error) {
+	s.rlock()
+	defer s.runlock()
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *memoryStore) RotateSession(ctx context.Context, id string, oldHash string, newHash string, at time.Time, expiresAt time.Time) error {
+	s.lock()
+	defer s.unlock()
+	session, ok := s.sessions[id]
+	if !ok || session.RefreshHash != oldHash {
+		return ErrNotFound
+	}
+	session.PreviousHash, session.RefreshHash = oldHash, newHash
+	session.RotatedAt, session.LastSeenAt, session.ExpiresAt = at, at, expiresAt
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *memoryStore) TouchSession(ctx context.Context, id string, ip string, location string, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+	if session, ok := s.sessions[id]; ok {
+		session.IP, session.Location, session.LastSeenAt = ip, location, at
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteSession(ctx context.Context, userId string, id string) error {
+	s.lock()
+	defer s.unlock()
+	if session, ok := s.sessions[id]; !ok || session.UserId != userId {
+		return ErrNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *memoryStore) DeleteSessions(ctx context.Context, userId string, exceptId string) error {
+	s.lock()
+	defer s.unlock()
+	for id, session := range s.sessions {
+		if session.UserId == userId && id != exceptId {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteExpiredSessions(ctx context.Context, userId string, now time.Time) error {
+	s.lock()
+	defer s.unlock()
+	for id, session := range s.sessions {
+		if session.UserId == userId && !session.ExpiresAt.After(now) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateTwoFactor(ctx context.Context, twoFactor *models.TwoFactor) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[twoFactor.UserId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.twoFactor[twoFactor.UserId]; ok {
+		return ErrConflict
+	}
+	s.twoFactor[twoFactor.UserId] = *twoFactor
+	return nil
+}
+
+func (s *memoryStore) ReadTwoFactor(ctx context.Context, userId string) (*models.TwoFactor, error) {
+	s.rlock()
+	defer s.runlock()
+	if twoFactor, ok := s.twoFactor[userId]; ok {
+		return &twoFactor, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) EnableTwoFactor(ctx context.Context, userId string, step int64, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+	twoFactor, ok := s.twoFactor[userId]
+	if !ok || twoFactor.Enabled() {
+		return ErrNotFound
+	}
+	twoFactor.EnabledAt, twoFactor.LastStep = at, step
+	s.twoFactor[userId] = twoFactor
+	return nil
+}
+
+func (s *memoryStore) UseTwoFactorStep(ctx context.Context, userId string, step int64) error {
+	s.lock()
+	defer s.unlock()
+	twoFactor, ok := s.twoFactor[userId]
+	if !ok || twoFactor.LastStep >= step {
+		return ErrNotFound
+	}
+	twoFactor.LastStep = step
+	s.twoFactor[userId] = twoFactor
+	return nil
+}
+
+func (s *memoryStore) DeleteTwoFactor(ctx context.Context, userId string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.twoFactor[userId]; !ok {
+		return ErrNotFound
+	}
+	delete(s.twoFactor, userId)
+	delete(s.recoveryCodes, userId)
+	return nil
+}
+
+func (s *memoryStore) ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return ErrNotFound
+	}
+	codes := map[string]bool{}
+	for _, hash := range codeHashes {
+		codes[hash] = true
+	}
+	s.recoveryCodes[userId] = codes
+	return nil
+}
+
+func (s *memoryStore) UseRecoveryCode(ctx context.Context, userId string, codeHash string) error {
+	s.lock()
+	defer s.unlock()
+	if !s.recoveryCodes[userId][codeHash] {
+		return ErrNotFound
+	}
+	delete(s.recoveryCodes[userId], codeHash)
+	return nil
+}
+
+func (s *memoryStore) CountRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	return len(s.recoveryCodes[userId]), nil
+}
+
+func (s *memoryStore) CreateCredential(ctx context.Context, credential *models.Credential) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[credential.UserId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.credentials[string(credential.Id)]; ok {
+		return ErrConflict
+	}
+	s.credentials[string(credential.Id)] = *credential
+	return nil
+}
+
+func (s *memoryStore) ReadCredential(ctx context.Context, id []byte) (*models.Credential, error) {
+	s.rlock()
+	defer s.runlock()
+	if credential, ok := s.credentials[string(id)]; ok {
+		return &credential, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadCredentials(ctx context.Context, userId string) ([]models.Credential, error) {
+	s.rlock()
+	defer s.runlock()
+	var credentials []models.Credential
+	for _, credential := range s.credentials {
+		if credential.UserId == userId {
+			credentials = append(credentials, credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (s *memoryStore) UseCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+	credential, ok := s.credentials[string(id)]
+	if !ok || (signCount <= credential.SignCount && (signCount != 0 || credential.SignCount != 0)) {
+		return ErrNotFound
+	}
+	credential.SignCount, credential.BackupState, credential.LastUsedAt = signCount, backupState, at
+	s.credentials[string(id)] = credential
+	return nil
+}
+
+func (s *memoryStore) DeleteCredential(ctx context.Context, userId string, id []byte) error {
+	s.lock()
+	defer s.unlock()
+	if credential, ok := s.credentials[string(id)]; !ok || credential.UserId != userId {
+		return ErrNotFound
+	}
+	delete(s.credentials, string(id))
+	return nil
+}
+
+func (s *memoryStore) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[token.UserId]; !ok {
+		return ErrNotFound
+	}
+	for id, existing := range s.apiTokens {
+		if id == token.Id || existing.TokenHash == token.TokenHash {
+			return ErrConflict
+		}
+	}
+	token.Scopes = slices.Clone(token.Scopes)
+	s.apiTokens[token.Id] = *token
+	return nil
+}
+
+func (s *memoryStore) ReadAPIToken(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	s.rlock()
+	defer s.runlock()
+	for _, token := range s.apiTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadAPITokens(ctx context.Context, userId string) ([]models.APIToken, error) {
+	s.rlock()
+	defer s.runlock()
+	var tokens []models.APIToken
+	for _, token := range s.apiTokens {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (s *memoryStore) UseAPIToken(ctx context.Context, id string, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+	if token, ok := s.apiTokens[id]; ok {
+		token.LastUsedAt = at
+		s.apiTokens[id] = token
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteAPIToken(ctx context.Context, userId string, id string) error {
+	s.lock()
+	defer s.unlock()
+	if token, ok := s.apiTokens[id]; !ok || token.UserId != userId {
+		return ErrNotFound
+	}
+	delete(s.apiTokens, id)
+	return nil
+}
+
+func (s *memoryStore) DeleteAPITokens(ctx context.Context, userId string) error {
+	s.lock()
+	defer s.unlock()
+	for id, token := range s.apiTokens {
+		if token.UserId == userId {
+			delete(s.apiTokens, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ReadLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	s.rlock()
+	defer s.runlock()
+	if throttle, ok := s.throttles[key]; ok {
+		return &throttle, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) RecordLoginFailure(ctx context.Context, key string, at time.Time, since time.Time) (int, error) {
+	s.lock()
+	defer s.unlock()
+	throttle, ok := s.throttles[key]
+	if !ok || throttle.LastFailureAt.Before(since) {
+		throttle = models.LoginThrottle{Key: key}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = at
+	s.throttles[key] = throttle
+	return throttle.Failures, nil
+}
+
+// LockLoginThrottle has no locking to do, WithTx already holds the write
+// lock.
+func (s *memoryStore) LockLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	s.rlock()
+	defer s.runlock()
+	throttle, ok := s.throttles[key]
+	if !ok {
+		throttle = models.LoginThrottle{Key: key}
+	}
+	return &throttle, nil
+}
+
+func (s *memoryStore) ForgiveLoginFailure(ctx context.Context, key string) error {
+	s.lock()
+	defer s.unlock()
+	if throttle, ok := s.throttles[key]; ok && throttle.Failures > 0 {
+		throttle.Failures--
+		s.throttles[key] = throttle
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteLoginThrottle(ctx context.Context, key string) error {
+	s.lock()
+	defer s.unlock()
+	delete(s.throttles, key)
+	return nil
+}
+
+func (s *memoryStore) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	s.lock()
+	defer s.unlock()
+	event.Id = int64(len(s.audit)) + 1
+	s.audit = append(s.audit, *event)
+	return nil
+}
+
+func (s *memoryStore) ReadAuditEvents(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	s.rlock()
+	defer s.runlock()
+	var events []models.AuditEvent
+	for i := len(s.audit) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, s.audit[i])
+	}
+	return events, nil
+}
+
+func (s *memoryStore) Followed(ctx context.Context, userId, followId string) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.follows[userId][followId], nil
+}
+
+func (s *memoryStore) ReadFollowedIds(ctx context.Context, userId string, ids []string) (map[string]bool, error) {
+	s.rlock()
+	defer s.runlock()
+	followed := map[string]bool{}
+	for _, id := range ids {
+		if s.follows[userId][id] {
+			followed[id] = true
+		}
+	}
+	return followed, nil
+}
+
+func (s *memoryStore) ToggleFollow(ctx context.Context, userId, followId string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return false, ErrNotFound
+	}
+	if _, ok := s.users[followId]; !ok {
+		return false, ErrNotFound
+	}
+	if s.follows[userId][followId] {
+		delete(s.follows[userId], followId)
+		return false, nil
+	}
+	if s.follows[userId] == nil {
+		s.follows[userId] = map[string]bool{}
+	}
+	s.follows[userId][followId] = true
+	return true, nil
+}
+
+func (s *memoryStore) SetFollow(ctx context.Context, userId, followId string, follow bool) (bool, error) {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return false, ErrNotFound
+	}
+	if _, ok := s.users[followId]; !ok {
+		return false, ErrNotFound
+	}
+	if s.follows[userId][followId] == follow {
+		return false, nil
+	}
+	if !follow {
+		delete(s.follows[userId], followId)
+		return true, nil
+	}
+	if s.follows[userId] == nil {
+		s.follows[userId] = map[string]bool{}
+	}
+	s.follows[userId][followId] = true
+	return true, nil
+}
+
+func (s *memoryStore) followers(userId string) map[string]bool {
+	ids := map[string]bool{}
+	for id, followed := range s.follows {
+		if followed[userId] {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+func (s *memoryStore) ReadFollowers(ctx context.Context, userId string) ([]string, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.usernames(s.followers(userId)), nil
+}
+
+func (s *memoryStore) ReadFollowersCount(ctx context.Context, userId string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	return len(s.followers(userId)), nil
+}
+
+func (s *memoryStore) ReadFollowing(ctx context.Context, userId string) ([]string, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.usernames(s.follows[userId]), nil
+}
+
+func (s *memoryStore) ReadFollowingCount(ctx context.Context, userId string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	return len(s.follows[userId]), nil
+}
+
+func (s *memoryStore) CreateVerificationId(ctx context.Context, token string, id string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.verifications[id]; ok {
+		return ErrConflict
+	}
+	for _, existing := range s.verifications {
+		if existing == token {
+			return ErrConflict
+		}
+	}
+	s.verifications[id] = token
+	return nil
+}
+
+func (s *memoryStore) ReadVerificationId(ctx context.Context, id string) (string, error) {
+	s.rlock()
+	defer s.runlock()
+	if token, ok := s.verifications[id]; ok {
+		return token, nil
+	}
+	return "", ErrNotFound
+}
+
+func (s *memoryStore) DeleteVerificationId(ctx context.Context, id string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.verifications[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.verifications, id)
+	return nil
+}
+
+func (s *memoryStore) ReadMailSends(ctx context.Context, key string) (*models.MailSends, error) {
+	s.rlock()
+	defer s.runlock()
+	if sends, ok := s.mailSends[key]; ok {
+		return &sends, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) RecordMailSend(ctx context.Context, key string, at time.Time, since time.Time) (int, error) {
+	s.lock()
+	defer s.unlock()
+	sends, ok := s.mailSends[key]
+	if !ok || sends.LastSentAt.Before(since) {
+		sends = models.MailSends{Key: key}
+	}
+	sends.Sent++
+	sends.LastSentAt = at
+	s.mailSends[key] = sends
+	return sends.Sent, nil
+}
+
+// LockMailSends has no locking to do, WithTx already holds the write lock.
+func (s *memoryStore) LockMailSends(ctx context.Context, key string) (*models.MailSends, error) {
+	s.rlock()
+	defer s.runlock()
+	sends, ok := s.mailSends[key]
+	if !ok {
+		sends = models.MailSends{Key: key}
+	}
+	return &sends, nil
+}
+
+func (s *memoryStore) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[reset.UserId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.resets[reset.TokenHash]; ok {
+		return ErrConflict
+	}
+	s.resets[reset.TokenHash] = *reset
+	return nil
+}
+
+func (s *memoryStore) ReadPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	s.rlock()
+	defer s.runlock()
+	if reset, ok := s.resets[tokenHash]; ok {
+		return &reset, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) DeletePasswordReset(ctx context.Context, tokenHash string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.resets[tokenHash]; !ok {
+		return ErrNotFound
+	}
+	delete(s.resets, tokenHash)
+	return nil
+}
+
+func (s *memoryStore) DeletePasswordResets(ctx context.Context, userId string) error {
+	s.lock()
+	defer s.unlock()
+	for hash, reset := range s.resets {
+		if reset.UserId == userId {
+			delete(s.resets, hash)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateEmailChange(ctx context.Context, change *models.EmailChange) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[change.UserId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.emailChanges[change.TokenHash]; ok {
+		return ErrConflict
+	}
+	s.emailChanges[change.TokenHash] = *change
+	return nil
+}
+
+func (s *memoryStore) ReadEmailChange(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	s.rlock()
+	defer s.runlock()
+	if change, ok := s.emailChanges[tokenHash]; ok {
+		return &change, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadPendingEmailChange(ctx context.Context, userId string) (*models.EmailChange, error) {
+	s.rlock()
+	defer s.runlock()
+	var latest *models.EmailChange
+	for _, change := range s.emailChanges {
+		if change.UserId == userId && (latest == nil || change.CreatedAt.After(latest.CreatedAt)) {
+			latest = &change
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (s *memoryStore) DeleteEmailChange(ctx context.Context, tokenHash string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.emailChanges[tokenHash]; !ok {
+		return ErrNotFound
+	}
+	delete(s.emailChanges, tokenHash)
+	return nil
+}
+
+func (s *memoryStore) DeleteEmailChanges(ctx context.Context, userId string) error {
+	s.lock()
+	defer s.unlock()
+	for hash, change := range s.emailChanges {
+		if change.UserId == userId {
+			delete(s.emailChanges, hash)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreatePost(ctx context.Context, userId string, post *models.Post) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.posts[post.Id]; ok {
+		return ErrConflict
+	}
+	s.posts[post.Id] = models.Post{
+		UserId:    userId,
+		Id:        post.Id,
+		Body:      post.Body,
+		CreatedAt: post.CreatedAt,
+	}
+	s.postIndex.add(post.Id, post.Body)
+	return nil
+}
+
+func (s *memoryStore) ReadPost(ctx context.Context, id string) (*models.Post, error) {
+	s.rlock()
+	defer s.runlock()
+	if post, ok := s.posts[id]; ok {
+		return &post, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) postsCount(userId string) int {
+	count := 0
+	for _, post := range s.posts {
+		if post.UserId == userId {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *memoryStore) ReadPostsCount(ctx context.Context, userId string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.postsCount(userId), nil
+}
+
+func (s *memoryStore) filterPosts(keep func(models.Post) bool, cursor string, limit int) ([]models.Post, string, error) {
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var posts []models.Post
+	for _, post := range s.posts {
+		if keep(post) {
+			posts = append(posts, post)
+		}
+	}
+	posts, next := pageAfter(posts, after, limit, postCursor)
+	for i := range posts {
+		author := copyUser(s.users[posts[i].UserId])
+		posts[i].Username = author.Username
+		posts[i].Avatar = author.Avatar
+	}
+	return posts, next, nil
+}
+
+func (s *memoryStore) ReadPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.filterPosts(func(post models.Post) bool {
+		return post.UserId == userId
+	}, cursor, limit)
+}
+
+func (s *memoryStore) ReadFeedPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error) {
+	s.rlock()
+	defer s.runlock()
+	followed := s.follows[userId]
+	return s.filterPosts(func(post models.Post) bool {
+		return followed[post.UserId]
+	}, cursor, limit)
+}
+
+func (s *memoryStore) UpdatePost(ctx context.Context, id string, body string) error {
+	s.lock()
+	defer s.unlock()
+	post, ok := s.posts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	post.Body = body
+	s.posts[id] = post
+	s.postIndex.remove(id)
+	s.postIndex.add(id, body)
+	return nil
+}
+
+func (s *memoryStore) deletePost(id string) {
+	delete(s.posts, id)
+	s.postIndex.remove(id)
+	delete(s.votes, id)
+	for commentId, comment := range s.comments {
+		if comment.PostId == id {
+			delete(s.comments, commentId)
+			s.commentIndex.remove(commentId)
+		}
+	}
+}
+
+func (s *memoryStore) DeletePost(ctx context.Context, id string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.posts[id]; !ok {
+		return ErrNotFound
+	}
+	s.deletePost(id)
+	return nil
+}
+
+func (s *memoryStore) Voted(ctx context.Context, userId string, id string) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.votes[id][userId], nil
+}
+
+func (s *memoryStore) ToggleVote(ctx context.Context, userId string, id string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return false, ErrNotFound
+	}
+	if _, ok := s.posts[id]; !ok {
+		return false, ErrNotFound
+	}
+	if s.votes[id][userId] {
+		delete(s.votes[id], userId)
+		return false, nil
+	}
+	if s.votes[id] == nil {
+		s.votes[id] = map[string]bool{}
+	}
+	s.votes[id][userId] = true
+	return true, nil
+}
+
+func (s *memoryStore) SetVote(ctx context.Context, userId string, id string, vote bool) (bool, error) {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return false, ErrNotFound
+	}
+	if _, ok := s.posts[id]; !ok {
+		return false, ErrNotFound
+	}
+	if s.votes[id][userId] == vote {
+		return false, nil
+	}
+	if !vote {
+		delete(s.votes[id], userId)
+		return true, nil
+	}
+	if s.votes[id] == nil {
+		s.votes[id] = map[string]bool{}
+	}
+	s.votes[id][userId] = true
+	return true, nil
+}
+
+func (s *memoryStore) ReadVotes(ctx context.Context, id string) ([]string, error) {
+	s.rlock()
+	defer s.runlock()
+	return s.usernames(s.votes[id]), nil
+}
+
+func (s *memoryStore) CreateComment(ctx context.Context, userId string, postId string, comment *models.Comment) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.users[userId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.posts[postId]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.comments[comment.Id]; ok {
+		return ErrConflict
+	}
+	s.comments[comment.Id] = models.Comment{
+		UserId:    userId,
+		PostId:    postId,
+		Id:        comment.Id,
+		Body:      comment.Body,
+		CreatedAt: comment.CreatedAt,
+	}
+	s.commentIndex.add(comment.Id, comment.Body)
+	return nil
+}
+
+func (s *memoryStore) ReadComment(ctx context.Context, id string) (*models.Comment, error) {
+	s.rlock()
+	defer s.runlock()
+	if comment, ok := s.comments[id]; ok {
+		return &comment, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ReadComments(ctx context.Context, postId string, cursor string, limit int) ([]models.Comment, string, error) {
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	s.rlock()
+	defer s.runlock()
+	var comments []models.Comment
+	for _, comment := range s.comments {
+		if comment.PostId == postId {
+			comments = append(comments, comment)
+		}
+	}
+	comments, next := pageAfter(comments, after, limit, func(comment models.Comment) Cursor {
+		return Cursor{comment.CreatedAt, comment.Id}
+	})
+	for i := range comments {
+		author := copyUser(s.users[comments[i].UserId])
+		comments[i].Username = author.Username
+		comments[i].Avatar = author.Avatar
+	}
+	return comments, next, nil
+}
+
+func (s *memoryStore) UpdateComment(ctx context.Context, id string, body string) error {
+	s.lock()
+	defer s.unlock()
+	comment, ok := s.comments[id]
+	if !ok {
+		return ErrNotFound
+	}
+	comment.Body = body
+	s.comments[id] = comment
+	s.commentIndex.remove(id)
+	s.commentIndex.add(id, body)
+	return nil
+}
+
+func (s *memoryStore) DeleteComment(ctx context.Context, id string) error {
+	s.lock()
+	defer s.unlock()
+	if _, ok := s.comments[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.comments, id)
+	s.commentIndex.remove(id)
+	return nil
+}
+
+// pageAfter sorts items newest first by (created_at, id) and returns the
+// page following the cursor, like the keyset queries of the MySQL backend.
+func pageAfter[T any](items []T, after *Cursor, limit int, key func(T) Cursor) ([]T, string) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := key(items[i]), key(items[j])
+		return a.before(b.CreatedAt, b.Id)
+	})
+	var rest []T
+	for _, item := range items {
+		if k := key(item); after.before(k.CreatedAt, k.Id) {
+			rest = append(rest, item)
+			if len(rest) > limit {
+				break
+			}
+		}
+	}
+	return nextCursor(rest, limit, key)
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+func newTestUser(t *testing.T, s Store, username string) *models.User {
+	t.Helper()
+	user := &models.User{Id: username + "-id", Username: username, CreatedAt: time.Now()}
+	if err := s.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestWithTxCommits(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	err := s.WithTx(ctx, func(tx Store) error {
+		return tx.CreateUser(ctx, &models.User{Id: "a", Username: "alice"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadUserByName(ctx, "alice"); err != nil {
+		t.Fatalf("user not committed: %v", err)
+	}
+}
+
+func TestWithTxRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	owner := newTestUser(t, s, "owner")
+	failed := errors.New("failed")
+	err := s.WithTx(ctx, func(tx Store) error {
+		if err := tx.CreateUser(ctx, &models.User{Id: "a", Username: "alice"}); err != nil {
+			return err
+		}
+		if err := tx.UpdateUser(ctx, owner.Id, map[string]any{"verified": true}); err != nil {
+			return err
+		}
+		// A nested call joins the transaction, so its writes go too
+		return tx.WithTx(ctx, func(tx Store) error {
+			if err := tx.CreatePost(ctx, owner.Id, &models.Post{Id: "p", Body: "hi", CreatedAt: time.Now()}); err != nil {
+				return err
+			}
+			return failed
+		})
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithTx returned %v, want %v", err, failed)
+	}
+	if _, err := s.ReadUserByName(ctx, "alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("created user survived the rollback: %v", err)
+	}
+	if user, err := s.ReadUserById(ctx, owner.Id); err != nil || user.Verified {
+		t.Errorf("update survived the rollback: %+v, %v", user, err)
+	}
+	if _, err := s.ReadPost(ctx, "p"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("nested write survived the rollback: %v", err)
+	}
+	// The store is still usable after a rollback
+	newTestUser(t, s, "alice")
+}
+
+func TestWithTxConflict(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	newTestUser(t, s, "alice")
+	err := s.WithTx(ctx, func(tx Store) error {
+		if err := UsernameAvailable(ctx, tx, "alice"); err != nil {
+			return err
+		}
+		return tx.CreateUser(ctx, &models.User{Id: "b", Username: "alice"})
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("WithTx returned %v, want ErrConflict", err)
+	}
+}
+
+// readAllPosts walks every page of a user's posts.
+func readAllPosts(t *testing.T, s Store, userId string, limit int) ([]models.Post, int) {
+	t.Helper()
+	var all []models.Post
+	pages, cursor := 0, ""
+	for {
+		posts, next, err := s.ReadPosts(context.Background(), userId, cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) > limit {
+			t.Fatalf("page %d has %d posts, limit is %d", pages, len(posts), limit)
+		}
+		all = append(all, posts...)
+		pages++
+		if next == "" {
+			return all, pages
+		}
+		cursor = next
+	}
+}
+
+func TestReadPostsPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	user := newTestUser(t, s, "alice")
+	start := time.Date(2024, time.March, 14, 9, 0, 0, 0, time.UTC)
+	for i := range 25 {
+		// Every few posts share a timestamp, the id breaks the tie
+		post := &models.Post{Id: "p" + strconv.Itoa(i+10), Body: "post", CreatedAt: start.Add(time.Duration(i/3) * time.Second)}
+		if err := s.CreatePost(ctx, user.Id, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	posts, pages := readAllPosts(t, s, user.Id, 10)
+	if len(posts) != 25 || pages != 3 {
+		t.Fatalf("got %d posts in %d pages, want 25 in 3", len(posts), pages)
+	}
+	seen := map[string]bool{}
+	for i, post := range posts {
+		if seen[post.Id] {
+			t.Fatalf("post %s is on two pages", post.Id)
+		}
+		seen[post.Id] = true
+		if post.Username != "alice" {
+			t.Errorf("post %s has author %q", post.Id, post.Username)
+		}
+		if i > 0 {
+			prev := posts[i-1]
+			if post.CreatedAt.After(prev.CreatedAt) || (post.CreatedAt.Equal(prev.CreatedAt) && post.Id > prev.Id) {
+				t.Errorf("post %s comes after %s, not newest first", post.Id, prev.Id)
+			}
+		}
+	}
+
+	// A page that ends exactly at the last post has no next cursor
+	if _, pages := readAllPosts(t, s, user.Id, 25); pages != 1 {
+		t.Errorf("limit 25 took %d pages, want 1", pages)
+	}
+}
+
+func TestReadPostsCursorIsStable(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	user := newTestUser(t, s, "alice")
+	start := time.Now()
+	for i := range 4 {
+		if err := s.CreatePost(ctx, user.Id, &models.Post{Id: "p" + strconv.Itoa(i), Body: "post", CreatedAt: start.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, next, err := s.ReadPosts(ctx, user.Id, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A new post on top doesn't shift the next page
+	if err := s.CreatePost(ctx, user.Id, &models.Post{Id: "p9", Body: "post", CreatedAt: start.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := s.ReadPosts(ctx, user.Id, next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{first[0].Id, first[1].Id, second[0].Id, second[1].Id}
+	want := []string{"p3", "p2", "p1", "p0"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("pages are %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReadPostsInvalidCursor(t *testing.T) {
+	s := NewMemoryStore()
+	for _, cursor := range []string{"not base64!", Cursor{Id: "x"}.Encode()[:3], "bm9jb2xvbg"} {
+		if _, _, err := s.ReadPosts(context.Background(), "a", cursor, 10); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: got %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := Cursor{CreatedAt: time.Date(2024, time.March, 14, 9, 26, 0, 123, time.UTC), Id: "a:b"}
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.Id != want.Id {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got, err := DecodeCursor(""); got != nil || err != nil {
+		t.Errorf("empty cursor decoded to %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,368 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered pair of up/down SQL scripts from database/migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrator is implemented by backends with a versioned schema.
+type migrator interface {
+	MigrateUp(ctx context.Context, steps int) ([]Migration, error)
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+const migrationLock = "socialecho_schema_migrations"
+
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		match := migrationName.FindStringSubmatch(base)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock runs fn while holding a MySQL named lock, so replicas
+// booting at the same time apply migrations one after another.
+func (s *mysqlStore) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := s.pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 60)`, migrationLock).Scan(&acquired); err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return errors.New("timed out waiting for the migration lock")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, migrationLock)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version     BIGINT          PRIMARY KEY,
+			name        VARCHAR(255)    NOT NULL,
+			applied_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitSQLStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\nin statement: %s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies up to steps pending migrations (all of them if steps <= 0).
+func (s *mysqlStore) MigrateUp(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if err := execScript(ctx, conn, m.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name,
+			); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown reverts the last steps applied migrations (one if steps <= 0).
+func (s *mysqlStore) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", m.Version, m.Name)
+			}
+			if err := execScript(ctx, conn, m.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				`DELETE FROM schema_migrations WHERE version = ?`, m.Version,
+			); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (s *mysqlStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var status []MigrationStatus
+	err = s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			entry := MigrationStatus{Migration: m}
+			if appliedAt, ok := applied[m.Version]; ok {
+				entry.AppliedAt = &appliedAt
+			}
+			status = append(status, entry)
+		}
+		return nil
+	})
+	return status, err
+}
+
+// Migrate runs the "migrate up|down|status [steps]" subcommand against the
+// configured backend and reports progress to w.
+func Migrate(args []string, w io.Writer) error {
+	s, err := connect()
+	if err != nil {
+		return err
+	}
+	m, ok := s.(migrator)
+	if !ok {
+		fmt.Fprintln(w, "The configured backend has no schema to migrate.")
+		return nil
+	}
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status [steps]")
+	}
+	steps := 0
+	if len(args) > 1 {
+		if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+			return fmt.Errorf("invalid number of steps %q", args[1])
+		}
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := m.MigrateUp(ctx, steps)
+		for _, migration := range done {
+			fmt.Fprintf(w, "applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(w, "Schema is up to date.")
+		}
+		return err
+	case "down":
+		done, err := m.MigrateDown(ctx, steps)
+		for _, migration := range done {
+			fmt.Fprintf(w, "reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(w, "No migrations to revert.")
+		}
+		return err
+	case "status":
+		status, err := m.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, entry := range status {
+			applied := "pending"
+			if entry.AppliedAt != nil {
+				applied = "applied " + entry.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d_%-30s %s\n", entry.Version, entry.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// migrateOnBoot brings the schema up to date when the server starts.
+func migrateOnBoot(s Store) error {
+	m, ok := s.(migrator)
+	if !ok {
+		return nil
+	}
+	done, err := m.MigrateUp(context.Background(), 0)
+	for _, migration := range done {
+		log.Printf("Applied migration %04d_%s\n", migration.Version, migration.Name)
+	}
+	return err
+}
+
+// splitSQLStatements splits a script on semicolons, skipping comments and
+// semicolons inside quoted strings or identifiers.
+func splitSQLStatements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		current.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			// Copy the quoted section verbatim, honouring backslash escapes
+			j := i + 1
+			for j < len(script) && script[j] != ch {
+				if script[j] == '\\' && ch != '`' {
+					j++
+				}
+				j++
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			current.WriteString(script[i : j+1])
+			i = j
+		case ch == '#' || isDashComment(script[i:]):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+		case ch == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end == -1 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case ch == ';':
+			flush()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// isDashComment reports whether s starts with a MySQL "-- " comment, which
+// requires whitespace (or the end of input) after the two dashes.
+func isDashComment(s string) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || s[2] == ' ' || s[2] == '\t' || s[2] == '\n' || s[2] == '\r'
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations found")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %04d_%s is number %d, versions must have no gaps", m.Version, m.Name, i+1)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+		if len(splitSQLStatements(m.Up)) == 0 {
+			t.Errorf("migration %04d_%s has an empty up script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"one", "SELECT 1", []string{"SELECT 1"}},
+		{"several", "SELECT 1;\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"quoted semicolon", "INSERT INTO t VALUES ('a;b');", []string{"INSERT INTO t VALUES ('a;b')"}},
+		{"escaped quote", `INSERT INTO t VALUES ('it\'s;');`, []string{`INSERT INTO t VALUES ('it\'s;')`}},
+		{"backticks", "SELECT `a;b` FROM t;", []string{"SELECT `a;b` FROM t"}},
+		{"dash comment", "-- drop; this\nSELECT 1;", []string{"SELECT 1"}},
+		{"hash comment", "# drop; this\nSELECT 1;", []string{"SELECT 1"}},
+		{"block comment", "SELECT /* ; */ 1;", []string{"SELECT   1"}},
+		{"dashes without space", "SELECT 1--1;", []string{"SELECT 1--1"}},
+		{"only comments", "-- nothing here\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSQLStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMigrateUpDown applies every migration, reverts them all and applies
+// them again on a scratch MySQL database. It only runs when MYSQL_TEST_DB
+// names one, along with the other MYSQL_* env vars. Everything in it is
+// dropped.
+func TestMigrateUpDown(t *testing.T) {
+	name := os.Getenv("MYSQL_TEST_DB")
+	if name == "" {
+		t.Skip("MYSQL_TEST_DB is not set")
+	}
+	t.Setenv("MYSQL_DB", name)
+	s, err := OpenMySQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.(migrator)
+	ctx := context.Background()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Start from an empty schema
+	if _, err := m.MigrateDown(ctx, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	for round := range 2 {
+		done, err := m.MigrateUp(ctx, 0)
+		if err != nil {
+			t.Fatalf("round %d up: %v", round, err)
+		}
+		if len(done) != len(migrations) {
+			t.Fatalf("round %d applied %d migrations, want %d", round, len(done), len(migrations))
+		}
+		status, err := m.MigrationStatus(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range status {
+			if entry.AppliedAt == nil {
+				t.Errorf("round %d: %04d_%s is still pending", round, entry.Version, entry.Name)
+			}
+		}
+		done, err = m.MigrateDown(ctx, len(migrations))
+		if err != nil {
+			t.Fatalf("round %d down: %v", round, err)
+		}
+		if len(done) != len(migrations) {
+			t.Fatalf("round %d reverted %d migrations, want %d", round, len(done), len(migrations))
+		}
+	}
+}
@@ -0,0 +1,9 @@
+-- The composite indexes may have replaced the implicit ones backing the
+-- foreign keys, so give those keys a plain index before dropping them
+CREATE INDEX idx_posts_user ON posts (user_id);
+CREATE INDEX idx_comments_post ON comments (post_id);
+
+DROP INDEX idx_users_created ON t_users;
+DROP INDEX idx_comments_post_created ON comments;
+DROP INDEX idx_posts_created ON posts;
+DROP INDEX idx_posts_user_created ON posts;
@@ -0,0 +1,5 @@
+-- Keyset pagination walks these in (created_at, id) order
+CREATE INDEX idx_posts_user_created ON posts (user_id, created_at, id);
+CREATE INDEX idx_posts_created ON posts (created_at, id);
+CREATE INDEX idx_comments_post_created ON comments (post_id, created_at, id);
+CREATE INDEX idx_users_created ON t_users (created_at, id);
@@ -0,0 +1,3 @@
+ALTER TABLE t_users DROP INDEX ft_users_username;
+ALTER TABLE comments DROP INDEX ft_comments_body;
+ALTER TABLE posts DROP INDEX ft_posts_body;
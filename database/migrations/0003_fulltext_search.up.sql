@@ -0,0 +1,5 @@
+-- Full-text indexes backing /search. InnoDB only builds one FULLTEXT index
+-- per ALTER, so each table gets its own statement.
+ALTER TABLE posts ADD FULLTEXT INDEX ft_posts_body (body);
+ALTER TABLE comments ADD FULLTEXT INDEX ft_comments_body (body);
+ALTER TABLE t_users ADD FULLTEXT INDEX ft_users_username (username);
@@ -0,0 +1,15 @@
+-- External accounts (GitHub, Google, ...) users log in with, matched by the
+-- provider's subject id rather than by email. A user links at most one
+-- account per provider.
+CREATE TABLE IF NOT EXISTS identities (
+    provider    VARCHAR(32)     NOT NULL,
+    subject     VARCHAR(255)    NOT NULL,
+    user_id     CHAR(36)        NOT NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject),
+    UNIQUE KEY uq_identities_user_provider (user_id, provider),
+    CONSTRAINT fk_identities_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
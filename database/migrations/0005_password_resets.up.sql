@@ -0,0 +1,12 @@
+-- Outstanding "forgot password" links. Only a SHA-256 hash of the token in
+-- the link is kept, so a leaked table can't be used to reset passwords.
+CREATE TABLE IF NOT EXISTS password_resets (
+    token_hash  CHAR(64)        PRIMARY KEY,
+    user_id     CHAR(36)        NOT NULL,
+    expires_at  TIMESTAMP       NOT NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_password_resets_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
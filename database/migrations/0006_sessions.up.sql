@@ -0,0 +1,20 @@
+-- Server-side login sessions, one per device. The access token in the cookie
+-- names its session, which has to still be here for the token to count, and
+-- only a SHA-256 hash of the current refresh token is kept.
+CREATE TABLE IF NOT EXISTS sessions (
+    id              CHAR(36)        PRIMARY KEY,
+    user_id         CHAR(36)        NOT NULL,
+    refresh_hash    CHAR(64)        NOT NULL,
+    previous_hash   CHAR(64)        NOT NULL DEFAULT '',
+    device          VARCHAR(255)    NOT NULL DEFAULT '',
+    ip              VARCHAR(45)     NOT NULL DEFAULT '',
+    created_at      TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at    TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rotated_at      TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at      TIMESTAMP       NOT NULL,
+    INDEX idx_sessions_user_id (user_id, last_seen_at),
+    CONSTRAINT fk_sessions_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
@@ -0,0 +1,3 @@
+-- Rough location of the session's last IP, eg. "Lyon, FR", for the active
+-- sessions page
+ALTER TABLE sessions ADD COLUMN location VARCHAR(128) NOT NULL DEFAULT '' AFTER ip;
@@ -0,0 +1,25 @@
+-- TOTP secrets. A row with no enabled_at is an enrollment that hasn't been
+-- confirmed with a code yet. last_step is the time step of the last code
+-- accepted, so a code can't be used twice.
+CREATE TABLE IF NOT EXISTS two_factor (
+    user_id     CHAR(36)        PRIMARY KEY,
+    secret      VARCHAR(64)     NOT NULL,
+    last_step   BIGINT          NOT NULL DEFAULT 0,
+    enabled_at  TIMESTAMP       NULL DEFAULT NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_two_factor_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+-- Single-use codes for when the authenticator is lost, kept as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id     CHAR(36)        NOT NULL,
+    code_hash   CHAR(64)        NOT NULL,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_recovery_codes_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
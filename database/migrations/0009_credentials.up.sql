@@ -0,0 +1,22 @@
+-- Passkeys (WebAuthn credentials). sign_count is the authenticator's counter
+-- at the last login, so a cloned authenticator can be noticed; many passkeys
+-- always report 0.
+CREATE TABLE IF NOT EXISTS credentials (
+    id                  VARBINARY(1023) PRIMARY KEY,
+    user_id             CHAR(36)        NOT NULL,
+    name                VARCHAR(64)     NOT NULL,
+    public_key          BLOB            NOT NULL,
+    attestation_type    VARCHAR(32)     NOT NULL DEFAULT '',
+    transports          VARCHAR(255)    NOT NULL DEFAULT '',
+    aaguid              VARBINARY(16)   NOT NULL,
+    sign_count          INT UNSIGNED    NOT NULL DEFAULT 0,
+    backup_eligible     BOOLEAN         NOT NULL DEFAULT FALSE,
+    backup_state        BOOLEAN         NOT NULL DEFAULT FALSE,
+    created_at          TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at        TIMESTAMP       NULL DEFAULT NULL,
+    INDEX idx_credentials_user_id (user_id),
+    CONSTRAINT fk_credentials_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
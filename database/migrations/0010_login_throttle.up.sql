@@ -0,0 +1,26 @@
+-- Failed logins per IP ("ip:...") and per account ("user:<id>", or
+-- "name:<hex SHA-256 of the username>" for usernames nobody has), for
+-- backing off and locking out. failures starts over after a quiet day.
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key        VARCHAR(100)    PRIMARY KEY,
+    failures            INT             NOT NULL DEFAULT 0,
+    last_failure_at     TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
+
+-- Security events, like failed logins and lockouts. Rows stay after the
+-- account is deleted.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGINT          AUTO_INCREMENT PRIMARY KEY,
+    user_id     CHAR(36)        NULL DEFAULT NULL,
+    event       VARCHAR(32)     NOT NULL,
+    username    VARCHAR(64)     NOT NULL DEFAULT '',
+    ip          VARCHAR(45)     NOT NULL DEFAULT '',
+    user_agent  VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_log_user_id (user_id),
+    INDEX idx_audit_log_created_at (created_at),
+    CONSTRAINT fk_audit_log_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE SET NULL
+) ENGINE=InnoDB;
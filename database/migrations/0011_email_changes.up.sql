@@ -0,0 +1,13 @@
+-- Pending email address changes, waiting for the link sent to the new
+-- address. Like password resets only a SHA-256 hash of the token is kept.
+CREATE TABLE IF NOT EXISTS email_changes (
+    token_hash  CHAR(64)        PRIMARY KEY,
+    user_id     CHAR(36)        NOT NULL,
+    email       VARCHAR(320)    NOT NULL,
+    expires_at  TIMESTAMP       NOT NULL,
+    created_at  TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_email_changes_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
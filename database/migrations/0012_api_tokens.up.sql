@@ -0,0 +1,17 @@
+-- Personal API tokens, sent as "Authorization: Bearer <token>" by scripts.
+-- Only a SHA-256 hash of the token is kept, it's shown once when created.
+-- scopes is a comma separated list, eg. "read,post".
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id              CHAR(36)        PRIMARY KEY,
+    user_id         CHAR(36)        NOT NULL,
+    name            VARCHAR(64)     NOT NULL,
+    token_hash      CHAR(64)        UNIQUE NOT NULL,
+    scopes          VARCHAR(255)    NOT NULL,
+    created_at      TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at    TIMESTAMP       NULL DEFAULT NULL,
+    INDEX idx_api_tokens_user_id (user_id),
+    CONSTRAINT fk_api_tokens_user_id
+        FOREIGN KEY(user_id)
+            REFERENCES t_users(id)
+            ON DELETE CASCADE
+) ENGINE=InnoDB;
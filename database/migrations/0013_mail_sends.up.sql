@@ -0,0 +1,7 @@
+-- Mails sent per recipient, eg. verification mails per user ("verify:<id>"),
+-- for spacing out resends. sent starts over after a quiet hour.
+CREATE TABLE IF NOT EXISTS mail_sends (
+    send_key        VARCHAR(100)    PRIMARY KEY,
+    sent            INT             NOT NULL DEFAULT 0,
+    last_sent_at    TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
@@ -1,25 +1,32 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
 )
 
-var db *sql.DB
+// querier is the part of *sql.DB that *sql.Tx also implements, so the same
+// queries run inside or outside a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
-func init() {
-	// Load environment variables
-	if err := godotenv.Load(".env"); err != nil {
-		log.Fatal("Error loading .env file:", err)
-	}
+type mysqlStore struct {
+	db   querier
+	pool *sql.DB
+	tx   *sql.Tx // set on stores handed out by WithTx
+}
 
+// OpenMySQL connects to the MySQL server described by the MYSQL_* env vars.
+// The schema is managed separately through migrations.
+func OpenMySQL() (Store, error) {
 	// Build DSN from individual env vars
 	user := os.Getenv("MYSQL_USER")
 	pass := os.Getenv("MYSQL_PASSWORD")
@@ -29,73 +36,32 @@ func init() {
 
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", user, pass, host, port, dbName)
 
-	var err error
-	db, err = sql.Open("mysql", dsn)
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		log.Fatal("MySQL open error:", err)
+		return nil, fmt.Errorf("MySQL open error: %w", err)
 	}
 
 	if err = db.Ping(); err != nil {
-		log.Fatal("MySQL connection error:", err)
+		return nil, fmt.Errorf("MySQL connection error: %w", err)
 	}
 
 	log.Println("Connected to MySQL")
-
-	// Initialize DB schema from SQL file
-	if err := runInitSQL("database/init.sql"); err != nil {
-		log.Fatal("Init SQL error:", err)
-	}
-}
-
-func runInitSQL(filepath string) error {
-	data, err := ioutil.ReadFile(filepath)
-	if err != nil {
-		return err
-	}
-
-	statements := splitSQLStatements(string(data))
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
-			continue
-		}
-		if _, err := db.Exec(stmt); err != nil {
-			log.Printf("Error executing statement: %s\nErr: %v\n", stmt, err)
-			return err
-		}
-	}
-	return nil
+	return &mysqlStore{db: db, pool: db}, nil
 }
 
-func splitSQLStatements(script string) []string {
-	var stmts []string
-	current := ""
-	for _, line := range strings.Split(script, "\n") {
-		line = trimComment(line)
-		current += line + " "
-		if endsWithSemicolon(line) {
-			stmts = append(stmts, strings.TrimSpace(current))
-			current = ""
-		}
+// WithTx runs fn inside a transaction, committing if it returns nil and
+// rolling back otherwise. Calls nested inside fn join the outer transaction.
+func (s *mysqlStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.tx != nil {
+		return fn(s)
 	}
-	if current != "" {
-		stmts = append(stmts, strings.TrimSpace(current))
+	tx, err := s.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(err)
 	}
-	return stmts
-}
-
-func trimComment(line string) string {
-	if i := strings.Index(line, "--"); i != -1 {
-		return strings.TrimSpace(line[:i])
+	if err := fn(&mysqlStore{db: tx, pool: s.pool, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
 	}
-	return strings.TrimSpace(line)
-}
-
-func endsWithSemicolon(line string) bool {
-	return strings.HasSuffix(strings.TrimSpace(line), ";")
-}
-
-// Expose db globally
-func GetDB() *sql.DB {
-	return db
+	return wrapError(tx.Commit())
 }
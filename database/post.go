@@ -1,195 +1,239 @@
 package database
 
 import (
-	"log"
+	"context"
+	"database/sql"
 
 	"github.com/Aniket52kr/GO-Assignment/models"
 )
 
-func CreatePost(userId string, post *models.Post) bool {
-	if _, err := db.Exec(
+func (s *mysqlStore) CreatePost(ctx context.Context, userId string, post *models.Post) error {
+	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO posts(user_id, id, body, created_at)
 		VALUES (?, ?, ?, ?)`,
 		userId, post.Id, post.Body, post.CreatedAt,
-	); err != nil {
-		log.Println(err)
-		return false
-	}
-	return true
+	)
+	return wrapError(err)
 }
 
-func ReadPost(id string) *models.Post {
+func (s *mysqlStore) ReadPost(ctx context.Context, id string) (*models.Post, error) {
 	var post models.Post
-	if err := db.QueryRow(`SELECT * FROM posts WHERE id = ?`, id).Scan(
+	if err := s.db.QueryRowContext(ctx, `SELECT * FROM posts WHERE id = ?`, id).Scan(
 		&post.UserId, &post.Id, &post.Body, &post.CreatedAt,
 	); err != nil {
-		log.Println(err)
-		return nil
+		return nil, wrapError(err)
 	}
-	return &post
+	return &post, nil
 }
 
-func ReadPostsCount(userId string) int {
+func (s *mysqlStore) ReadPostsCount(ctx context.Context, userId string) (int, error) {
 	var count int
-	if err := db.QueryRow(`SELECT COUNT(*) FROM posts WHERE user_id = ?`, userId).Scan(&count); err != nil {
-		log.Println(err)
-		return 0
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM posts WHERE user_id = ?`, userId).Scan(&count); err != nil {
+		return 0, wrapError(err)
 	}
-	return count
+	return count, nil
 }
 
-func ReadPosts(userId string, limit int, offset int) []models.Post {
-	var posts []models.Post
-	rows, err := db.Query(
-		`SELECT * FROM posts WHERE user_id = ? ORDER BY created_at DESC
-		LIMIT ? OFFSET ?`,
-		userId, limit, offset,
-	)
+// postColumns selects a post joined with its author.
+const postColumns = `p.user_id, p.id, p.body, p.created_at, u.username, u.avatar
+	FROM posts p JOIN t_users u ON u.id = p.user_id`
+
+func (s *mysqlStore) readPosts(ctx context.Context, query string, args ...any) ([]models.Post, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println(err)
-		return nil
+		return nil, wrapError(err)
 	}
 	defer rows.Close()
+
+	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
-		rows.Scan(&post.UserId, &post.Id, &post.Body, &post.CreatedAt)
+		var avatar sql.NullString
+		if err := rows.Scan(&post.UserId, &post.Id, &post.Body, &post.CreatedAt, &post.Username, &avatar); err != nil {
+			return nil, wrapError(err)
+		}
+		if avatar.Valid {
+			post.Avatar = &avatar.String
+		}
 		posts = append(posts, post)
 	}
-	return posts
+	return posts, wrapError(rows.Err())
 }
 
-func ReadFeedPosts(userId string, limit int, offset int) []models.Post {
-	var posts []models.Post
-	rows, err := db.Query(
-		`SELECT * FROM posts WHERE user_id IN
-		(SELECT follow_id FROM follows WHERE user_id = ?)
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?`,
-		userId, limit, offset,
+func postCursor(post models.Post) Cursor {
+	return Cursor{post.CreatedAt, post.Id}
+}
+
+func (s *mysqlStore) ReadPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error) {
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	clause, args := keysetClause(after, "p.")
+	posts, err := s.readPosts(ctx,
+		`SELECT `+postColumns+` WHERE p.user_id = ?`+clause+`
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ?`,
+		append(append([]any{userId}, args...), limit+1)...,
 	)
 	if err != nil {
-		log.Println(err)
-		return nil
+		return nil, "", err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var post models.Post
-		rows.Scan(&post.UserId, &post.Id, &post.Body, &post.CreatedAt)
-		posts = append(posts, post)
-	}
-	return posts
+	posts, next := nextCursor(posts, limit, postCursor)
+	return posts, next, nil
 }
 
-func DeletePost(id string) bool {
-	if _, err := db.Exec(`DELETE FROM posts WHERE id = ?`, id); err != nil {
-		log.Println(err)
-		return false
+func (s *mysqlStore) ReadFeedPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error) {
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	clause, args := keysetClause(after, "p.")
+	posts, err := s.readPosts(ctx,
+		`SELECT `+postColumns+` WHERE p.user_id IN
+		(SELECT follow_id FROM follows WHERE user_id = ?)`+clause+`
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ?`,
+		append(append([]any{userId}, args...), limit+1)...,
+	)
+	if err != nil {
+		return nil, "", err
 	}
-	return true
+	posts, next := nextCursor(posts, limit, postCursor)
+	return posts, next, nil
+}
+
+// UpdatePost changes the body of a post. An unchanged body isn't an error.
+func (s *mysqlStore) UpdatePost(ctx context.Context, id string, body string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE posts SET body = ? WHERE id = ?`, body, id)
+	return wrapError(err)
 }
 
-func Voted(userId string, id string) bool {
+func (s *mysqlStore) DeletePost(ctx context.Context, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM posts WHERE id = ?`, id))
+}
+
+func (s *mysqlStore) Voted(ctx context.Context, userId string, id string) (bool, error) {
 	var count int
-	db.QueryRow(
+	if err := s.db.QueryRowContext(ctx,
 		`SELECT COUNT(*) FROM votes WHERE user_id = ? AND id = ?`,
 		userId, id,
-	).Scan(&count)
-
-	return count > 0
+	).Scan(&count); err != nil {
+		return false, wrapError(err)
+	}
+	return count > 0, nil
 }
 
-func ToggleVote(userId string, id string) {
-	var query string
-	voted := Voted(userId, id)
+// ToggleVote adds or removes a vote in one transaction and reports whether
+// userId has voted on the post afterwards.
+func (s *mysqlStore) ToggleVote(ctx context.Context, userId string, id string) (bool, error) {
+	var voted bool
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		voted, err = toggle(ctx, tx.(*mysqlStore).db,
+			`DELETE FROM votes WHERE user_id = ? AND id = ?`,
+			`INSERT INTO votes (user_id, id) VALUES (?, ?)`,
+			userId, id,
+		)
+		return err
+	})
+	return voted, err
+}
 
-	if voted {
-		query = `DELETE FROM votes WHERE user_id = ? AND id = ?`
-	} else {
-		query = `INSERT INTO votes (user_id, id) VALUES (?, ?)`
-	}
-	if _, err := db.Exec(query, userId, id); err != nil {
-		log.Println(err)
-	}
+func (s *mysqlStore) SetVote(ctx context.Context, userId string, id string, vote bool) (bool, error) {
+	return set(ctx, s.db, vote,
+		`DELETE FROM votes WHERE user_id = ? AND id = ?`,
+		`INSERT INTO votes (user_id, id) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE id = id`,
+		userId, id,
+	)
 }
 
-func ReadVotes(id string) []string {
-	var voters []string
-	rows, err := db.Query(
+func (s *mysqlStore) ReadVotes(ctx context.Context, id string) ([]string, error) {
+	return s.readUsernames(ctx,
 		`SELECT username FROM t_users WHERE id IN
 		(SELECT user_id FROM votes WHERE id = ?)`,
 		id,
 	)
-	if err != nil {
-		log.Println(err)
-		return nil
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var username string
-		rows.Scan(&username)
-		voters = append(voters, username)
-	}
-	return voters
 }
 
-func CreateComment(userId string, postId string, comment *models.Comment) bool {
-	if _, err := db.Exec(
+func (s *mysqlStore) CreateComment(ctx context.Context, userId string, postId string, comment *models.Comment) error {
+	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO comments (user_id, post_id, id, body, created_at)
 		VALUES (?, ?, ?, ?, ?)`,
 		userId, postId, comment.Id, comment.Body, comment.CreatedAt,
-	); err != nil {
-		log.Println(err)
-		return false
-	}
-	return true
+	)
+	return wrapError(err)
 }
 
-func ReadComment(id string) *models.Comment {
+func (s *mysqlStore) ReadComment(ctx context.Context, id string) (*models.Comment, error) {
 	var comment models.Comment
-	if err := db.QueryRow(`SELECT * FROM comments WHERE id = ?`, id).Scan(
+	if err := s.db.QueryRowContext(ctx, `SELECT * FROM comments WHERE id = ?`, id).Scan(
 		&comment.UserId,
 		&comment.PostId,
 		&comment.Id,
 		&comment.Body,
 		&comment.CreatedAt,
 	); err != nil {
-		log.Println(err)
-		return nil
+		return nil, wrapError(err)
 	}
-	return &comment
+	return &comment, nil
 }
 
-func ReadComments(postId string, limit int, offset int) []models.Comment {
-	var comments []models.Comment
-	rows, err := db.Query(
-		`SELECT * FROM comments WHERE post_id = ?
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?`,
-		postId, limit, offset,
+func (s *mysqlStore) ReadComments(ctx context.Context, postId string, cursor string, limit int) ([]models.Comment, string, error) {
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	clause, args := keysetClause(after, "c.")
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT c.user_id, c.post_id, c.id, c.body, c.created_at, u.username, u.avatar
+		FROM comments c JOIN t_users u ON u.id = c.user_id
+		WHERE c.post_id = ?`+clause+`
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT ?`,
+		append(append([]any{postId}, args...), limit+1)...,
 	)
 	if err != nil {
-		log.Println(err)
-		return nil
+		return nil, "", wrapError(err)
 	}
 	defer rows.Close()
+
+	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		rows.Scan(
+		var avatar sql.NullString
+		if err := rows.Scan(
 			&comment.UserId,
 			&comment.PostId,
 			&comment.Id,
 			&comment.Body,
 			&comment.CreatedAt,
-		)
+			&comment.Username,
+			&avatar,
+		); err != nil {
+			return nil, "", wrapError(err)
+		}
+		if avatar.Valid {
+			comment.Avatar = &avatar.String
+		}
 		comments = append(comments, comment)
 	}
-	return comments
+	if err := rows.Err(); err != nil {
+		return nil, "", wrapError(err)
+	}
+	comments, next := nextCursor(comments, limit, func(comment models.Comment) Cursor {
+		return Cursor{comment.CreatedAt, comment.Id}
+	})
+	return comments, next, nil
 }
 
-func DeleteComment(id string) bool {
-	if _, err := db.Exec(`DELETE FROM comments WHERE id = ?`, id); err != nil {
-		log.Println(err)
-		return false
-	}
-	return true
+// UpdateComment changes the body of a comment, like UpdatePost.
+func (s *mysqlStore) UpdateComment(ctx context.Context, id string, body string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE comments SET body = ? WHERE id = ?`, body, id)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) DeleteComment(ctx context.Context, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM comments WHERE id = ?`, id))
 }
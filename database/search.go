@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// SearchQuery is a parsed search box input, eg.
+//
+//	golang "error handling" from:alice
+//
+// matches posts by alice containing the word golang and the phrase
+// "error handling".
+type SearchQuery struct {
+	Text    string     // the input without filters, matched against usernames
+	Terms   []string   // words that must all appear
+	Phrases [][]string // runs of words that must appear in order
+	From    string     // only posts by this username
+}
+
+// ParseSearchQuery splits raw into free words, quoted phrases and a
+// from:username filter.
+func ParseSearchQuery(raw string) SearchQuery {
+	var query SearchQuery
+	var text []string
+	for rest := strings.TrimSpace(raw); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] == '"' {
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			if words := tokenize(phrase); len(words) > 0 {
+				query.Phrases = append(query.Phrases, words)
+				text = append(text, strings.TrimSpace(phrase))
+			}
+			rest = after
+			continue
+		}
+		word := rest
+		if end := strings.IndexFunc(rest, unicode.IsSpace); end >= 0 {
+			word = rest[:end]
+		}
+		rest = rest[len(word):]
+		if username, ok := strings.CutPrefix(word, "from:"); ok && username != "" {
+			query.From = strings.TrimPrefix(username, "@")
+			continue
+		}
+		query.Terms = append(query.Terms, tokenize(word)...)
+		text = append(text, word)
+	}
+	query.Text = strings.Join(text, " ")
+	return query
+}
+
+// tokenize lowercases text and splits it into words the way MySQL's full-text
+// parser does: runs of letters, digits and underscores.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// minTokenSize is InnoDB's default innodb_ft_min_token_size. Shorter words are
+// never indexed, so requiring them would match nothing.
+const minTokenSize = 3
+
+// booleanMode renders the terms and phrases as a MATCH ... AGAINST boolean
+// mode expression requiring all of them. Words are already reduced to letters,
+// digits and underscores, so none of them can inject an operator.
+func (q SearchQuery) booleanMode(prefix bool) string {
+	var parts []string
+	for _, term := range q.Terms {
+		switch {
+		case prefix:
+			parts = append(parts, "+"+term+"*")
+		case len([]rune(term)) >= minTokenSize:
+			parts = append(parts, "+"+term)
+		}
+	}
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `+"`+strings.Join(phrase, " ")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+const userSummaryColumns = `u.email, u.username, u.password, u.id, u.verified, u.avatar, u.created_at,
+	(SELECT COUNT(*) FROM follows f WHERE f.follow_id = u.id),
+	(SELECT COUNT(*) FROM follows f WHERE f.user_id = u.id),
+	(SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id)`
+
+func scanUserSummary(row scanner) (models.UserSummary, error) {
+	var summary models.UserSummary
+	var email, avatar sql.NullString
+	if err := row.Scan(
+		&email, &summary.Username, &summary.Password, &summary.Id, &summary.Verified, &avatar, &summary.CreatedAt,
+		&summary.Followers, &summary.Following, &summary.Posts,
+	); err != nil {
+		return summary, wrapError(err)
+	}
+	if email.Valid {
+		summary.Email = &email.String
+	}
+	if avatar.Valid {
+		summary.Avatar = &avatar.String
+	}
+	return summary, nil
+}
+
+// SearchUsers ranks exact username matches first, then usernames starting
+// with the query, then usernames whose words start with its words.
+func (s *mysqlStore) SearchUsers(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.UserSummary, string, error) {
+	offset, err := decodeOffset(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if query.Text == "" {
+		return nil, "", nil
+	}
+	prefix := likeEscaper.Replace(query.Text) + "%"
+	expr := query.booleanMode(true)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userSummaryColumns+`
+		FROM t_users u
+		WHERE u.username LIKE ? OR MATCH(u.username) AGAINST(? IN BOOLEAN MODE)
+		ORDER BY u.username = ? DESC, u.username LIKE ? DESC,
+			MATCH(u.username) AGAINST(? IN BOOLEAN MODE) DESC,
+			u.created_at DESC, u.id DESC
+		LIMIT ? OFFSET ?`,
+		prefix, expr, query.Text, prefix, expr, limit+1, offset)
+	if err != nil {
+		return nil, "", wrapError(err)
+	}
+	defer rows.Close()
+
+	var users []models.UserSummary
+	for rows.Next() {
+		summary, err := scanUserSummary(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		users = append(users, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", wrapError(err)
+	}
+	users, next := nextOffset(users, offset, limit)
+	return users, next, nil
+}
+
+// SearchPosts matches posts whose body, or one of whose comments, contains
+// the query. Matches in the body rank above matches in comments; a query
+// with only a from: filter lists that user's posts newest first.
+func (s *mysqlStore) SearchPosts(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.Post, string, error) {
+	offset, err := decodeOffset(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	expr := query.booleanMode(false)
+	if expr == "" && query.From == "" {
+		return nil, "", nil
+	}
+
+	var where []string
+	var args []any
+	rank := "0"
+	var rankArgs []any
+	if expr != "" {
+		where = append(where, `(MATCH(p.body) AGAINST(? IN BOOLEAN MODE)
+			OR p.id IN (SELECT c.post_id FROM comments c WHERE MATCH(c.body) AGAINST(? IN BOOLEAN MODE)))`)
+		args = append(args, expr, expr)
+		rank = `MATCH(p.body) AGAINST(? IN BOOLEAN MODE) + 0.5 * COALESCE(
+			(SELECT MAX(MATCH(c.body) AGAINST(? IN BOOLEAN MODE)) FROM comments c WHERE c.post_id = p.id), 0)`
+		rankArgs = append(rankArgs, expr, expr)
+	}
+	if query.From != "" {
+		where = append(where, `u.username = ?`)
+		args = append(args, query.From)
+	}
+
+	posts, err := s.readPosts(ctx,
+		`SELECT `+postColumns+`
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY `+rank+` DESC, p.created_at DESC, p.id DESC
+		LIMIT ? OFFSET ?`,
+		append(append(args, rankArgs...), limit+1, offset)...,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	posts, next := nextOffset(posts, offset, limit)
+	return posts, next, nil
+}
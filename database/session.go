@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+const sessionColumns = `id, user_id, refresh_hash, previous_hash, device, ip, location, created_at, last_seen_at, rotated_at, expires_at`
+
+func scanSession(row scanner) (*models.Session, error) {
+	var session models.Session
+	if err := row.Scan(&session.Id, &session.UserId, &session.RefreshHash, &session.PreviousHash,
+		&session.Device, &session.IP, &session.Location, &session.CreatedAt, &session.LastSeenAt, &session.RotatedAt, &session.ExpiresAt); err != nil {
+		return nil, wrapError(err)
+	}
+	return &session, nil
+}
+
+func (s *mysqlStore) CreateSession(ctx context.Context, session *models.Session) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sessions (`+sessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.Id, session.UserId, session.RefreshHash, session.PreviousHash, session.Device, session.IP, session.Location,
+		session.CreatedAt, session.LastSeenAt, session.RotatedAt, session.ExpiresAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadSession(ctx context.Context, id string) (*models.Session, error) {
+	return scanSession(s.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE id = ?`, id))
+}
+
+func (s *mysqlStore) ReadSessions(ctx context.Context, userId string) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE user_id = ? ORDER BY last_seen_at DESC`, userId)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, wrapError(rows.Err())
+}
+
+func (s *mysqlStore) RotateSession(ctx context.Context, id string, oldHash string, newHash string, at time.Time, expiresAt time.Time) error {
+	return expectRows(s.db.ExecContext(ctx, `
+		UPDATE sessions SET refresh_hash = ?, previous_hash = ?, rotated_at = ?, last_seen_at = ?, expires_at = ?
+		WHERE id = ? AND refresh_hash = ?`,
+		newHash, oldHash, at, at, expiresAt, id, oldHash))
+}
+
+func (s *mysqlStore) TouchSession(ctx context.Context, id string, ip string, location string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET ip = ?, location = ?, last_seen_at = ? WHERE id = ?`, ip, location, at, id)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) DeleteSession(ctx context.Context, userId string, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND id = ?`, userId, id))
+}
+
+func (s *mysqlStore) DeleteSessions(ctx context.Context, userId string, exceptId string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND id <> ?`, userId, exceptId)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) DeleteExpiredSessions(ctx context.Context, userId string, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND expires_at <= ?`, userId, now)
+	return wrapError(err)
+}
@@ -0,0 +1,617 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// Store is implemented by every storage backend the app can run on.
+//
+// List reads return a page of at most limit rows after cursor ("" for the
+// first page) and the cursor for the next page ("" if there is none). Posts
+// and comments in a page come with their author's username (and avatar, for
+// posts) filled in.
+type Store interface {
+	// WithTx runs fn against a Store bound to a single transaction
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+
+	// users
+	CreateUser(ctx context.Context, user *models.User) error
+	CreateOAuthUser(ctx context.Context, id string) error
+	ReadUserByName(ctx context.Context, username string) (*models.User, error)
+	ReadUserByEmail(ctx context.Context, email string) (*models.User, error)
+	ReadUserById(ctx context.Context, id string) (*models.User, error)
+	IsOAuthUser(ctx context.Context, id string) (bool, error)
+	DeleteOAuthUser(ctx context.Context, id string) error
+	UpdateUser(ctx context.Context, id string, updates map[string]any) error
+	DeleteUser(ctx context.Context, id string) error
+	// LockUser makes other transactions that lock the same user wait until
+	// this one ends. It only has an effect on a tx.
+	LockUser(ctx context.Context, id string) error
+
+	// identities, the external accounts a user logs in with
+	CreateIdentity(ctx context.Context, identity *models.Identity) error
+	ReadIdentity(ctx context.Context, provider string, subject string) (*models.Identity, error)
+	ReadIdentities(ctx context.Context, userId string) ([]models.Identity, error)
+	DeleteIdentity(ctx context.Context, userId string, provider string) error
+
+	// sessions, the devices a user is logged in on
+	CreateSession(ctx context.Context, session *models.Session) error
+	ReadSession(ctx context.Context, id string) (*models.Session, error)
+	// ReadSessions lists the user's sessions, most recently used first
+	ReadSessions(ctx context.Context, userId string) ([]models.Session, error)
+	// RotateSession replaces the refresh token hash, but only if it is still
+	// oldHash, so two concurrent refreshes can't both rotate
+	RotateSession(ctx context.Context, id string, oldHash string, newHash string, at time.Time, expiresAt time.Time) error
+	// TouchSession records that the session was just used from ip
+	TouchSession(ctx context.Context, id string, ip string, location string, at time.Time) error
+	DeleteSession(ctx context.Context, userId string, id string) error
+	// DeleteSessions logs the user out everywhere but on session exceptId
+	DeleteSessions(ctx context.Context, userId string, exceptId string) error
+	DeleteExpiredSessions(ctx context.Context, userId string, now time.Time) error
+
+	// two-factor authentication
+	CreateTwoFactor(ctx context.Context, twoFactor *models.TwoFactor) error
+	ReadTwoFactor(ctx context.Context, userId string) (*models.TwoFactor, error)
+	// EnableTwoFactor confirms a pending enrollment with the step of the code
+	// that confirmed it
+	EnableTwoFactor(ctx context.Context, userId string, step int64, at time.Time) error
+	// UseTwoFactorStep records the step of a code that was just accepted. It
+	// returns ErrNotFound if that step or a later one was already used.
+	UseTwoFactorStep(ctx context.Context, userId string, step int64) error
+	// DeleteTwoFactor also deletes the recovery codes
+	DeleteTwoFactor(ctx context.Context, userId string) error
+	ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId string, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userId string) (int, error)
+
+	// passkeys
+	CreateCredential(ctx context.Context, credential *models.Credential) error
+	ReadCredential(ctx context.Context, id []byte) (*models.Credential, error)
+	// ReadCredentials lists the user's passkeys, oldest first
+	ReadCredentials(ctx context.Context, userId string) ([]models.Credential, error)
+	// UseCredential records a login with the passkey. It returns ErrNotFound
+	// if the authenticator's counter didn't go up since the last one.
+	UseCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, at time.Time) error
+	DeleteCredential(ctx context.Context, userId string, id []byte) error
+
+	// personal API tokens
+	CreateAPIToken(ctx context.Context, token *models.APIToken) error
+	ReadAPIToken(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	// ReadAPITokens lists the user's tokens, oldest first
+	ReadAPITokens(ctx context.Context, userId string) ([]models.APIToken, error)
+	UseAPIToken(ctx context.Context, id string, at time.Time) error
+	DeleteAPIToken(ctx context.Context, userId string, id string) error
+	DeleteAPITokens(ctx context.Context, userId string) error
+
+	// failed logins and the audit log
+	ReadLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error)
+	// RecordLoginFailure counts a failed login against key and returns the
+	// count, which starts over if the last failure was before since
+	RecordLoginFailure(ctx context.Context, key string, at time.Time, since time.Time) (int, error)
+	// LockLoginThrottle is ReadLoginThrottle, with no failures for a key
+	// that has none, that makes other transactions that lock the same key
+	// wait until this one ends. It only has an effect on a tx.
+	LockLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error)
+	// ForgiveLoginFailure takes back one failure counted against key
+	ForgiveLoginFailure(ctx context.Context, key string) error
+	DeleteLoginThrottle(ctx context.Context, key string) error
+	CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	// ReadAuditEvents returns the latest events, newest first
+	ReadAuditEvents(ctx context.Context, limit int) ([]models.AuditEvent, error)
+
+	// follows
+	Followed(ctx context.Context, userId string, followId string) (bool, error)
+	ReadFollowedIds(ctx context.Context, userId string, ids []string) (map[string]bool, error)
+	ToggleFollow(ctx context.Context, userId string, followId string) (bool, error)
+	SetFollow(ctx context.Context, userId string, followId string, follow bool) (bool, error)
+	ReadFollowers(ctx context.Context, userId string) ([]string, error)
+	ReadFollowersCount(ctx context.Context, userId string) (int, error)
+	ReadFollowing(ctx context.Context, userId string) ([]string, error)
+	ReadFollowingCount(ctx context.Context, userId string) (int, error)
+
+	// verification ids
+	CreateVerificationId(ctx context.Context, token string, id string) error
+	ReadVerificationId(ctx context.Context, id string) (string, error)
+	DeleteVerificationId(ctx context.Context, id string) error
+
+	// mails sent, counted per key for spacing them out
+	ReadMailSends(ctx context.Context, key string) (*models.MailSends, error)
+	// RecordMailSend counts a mail sent under key and returns the count,
+	// which starts over if the last one was before since
+	RecordMailSend(ctx context.Context, key string, at time.Time, since time.Time) (int, error)
+	// LockMailSends is ReadMailSends, with none sent for a key that has
+	// none, that makes other transactions that lock the same key wait until
+	// this one ends. It only has an effect on a tx.
+	LockMailSends(ctx context.Context, key string) (*models.MailSends, error)
+
+	// password resets, keyed by the hash of the emailed token
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	ReadPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	DeletePasswordReset(ctx context.Context, tokenHash string) error
+	DeletePasswordResets(ctx context.Context, userId string) error
+
+	// email changes, keyed by the hash of the token sent to the new address
+	CreateEmailChange(ctx context.Context, change *models.EmailChange) error
+	ReadEmailChange(ctx context.Context, tokenHash string) (*models.EmailChange, error)
+	ReadPendingEmailChange(ctx context.Context, userId string) (*models.EmailChange, error)
+	DeleteEmailChange(ctx context.Context, tokenHash string) error
+	DeleteEmailChanges(ctx context.Context, userId string) error
+
+	// posts
+	CreatePost(ctx context.Context, userId string, post *models.Post) error
+	ReadPost(ctx context.Context, id string) (*models.Post, error)
+	ReadPostsCount(ctx context.Context, userId string) (int, error)
+	ReadPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error)
+	ReadFeedPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error)
+	UpdatePost(ctx context.Context, id string, body string) error
+	DeletePost(ctx context.Context, id string) error
+
+	// votes
+	Voted(ctx context.Context, userId string, id string) (bool, error)
+	ToggleVote(ctx context.Context, userId string, id string) (bool, error)
+	SetVote(ctx context.Context, userId string, id string, vote bool) (bool, error)
+	ReadVotes(ctx context.Context, id string) ([]string, error)
+
+	// comments
+	CreateComment(ctx context.Context, userId string, postId string, comment *models.Comment) error
+	ReadComment(ctx context.Context, id string) (*models.Comment, error)
+	ReadComments(ctx context.Context, postId string, cursor string, limit int) ([]models.Comment, string, error)
+	UpdateComment(ctx context.Context, id string, body string) error
+	DeleteComment(ctx context.Context, id string) error
+
+	// search, paginated by offset since results are ranked
+	SearchUsers(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.UserSummary, string, error)
+	SearchPosts(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.Post, string, error)
+}
+
+var store Store
+
+// Open selects the storage backend from DB_DRIVER ("mysql" or "memory") and
+// applies any pending schema migrations.
+func Open() error {
+	s, err := connect()
+	if err != nil {
+		return err
+	}
+	if err := migrateOnBoot(s); err != nil {
+		return fmt.Errorf("migration error: %w", err)
+	}
+	store = s
+	return nil
+}
+
+func connect() (Store, error) {
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "mysql":
+		return OpenMySQL()
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
+
+// Use replaces the active backend, eg. with a fresh memory store in tests.
+func Use(s Store) {
+	store = s
+}
+
+// The functions below forward to the active backend.
+
+// WithTx runs fn in a transaction on the active backend. fn must use the tx
+// it is given, not the package-level functions, for its reads and writes.
+func WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return store.WithTx(ctx, fn)
+}
+
+func CreateUser(ctx context.Context, user *models.User) error {
+	return store.CreateUser(ctx, user)
+}
+
+func CreateOAuthUser(ctx context.Context, id string) error {
+	return store.CreateOAuthUser(ctx, id)
+}
+
+func ReadUserByName(ctx context.Context, username string) (*models.User, error) {
+	return store.ReadUserByName(ctx, username)
+}
+
+func ReadUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return store.ReadUserByEmail(ctx, email)
+}
+
+func ReadUserById(ctx context.Context, id string) (*models.User, error) {
+	return store.ReadUserById(ctx, id)
+}
+
+func IsOAuthUser(ctx context.Context, id string) (bool, error) {
+	return store.IsOAuthUser(ctx, id)
+}
+
+func DeleteOAuthUser(ctx context.Context, id string) error {
+	return store.DeleteOAuthUser(ctx, id)
+}
+
+func UpdateUser(ctx context.Context, id string, updates map[string]any) error {
+	return store.UpdateUser(ctx, id, updates)
+}
+
+func DeleteUser(ctx context.Context, id string) error {
+	return store.DeleteUser(ctx, id)
+}
+
+func CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	return store.CreateIdentity(ctx, identity)
+}
+
+func ReadIdentity(ctx context.Context, provider string, subject string) (*models.Identity, error) {
+	return store.ReadIdentity(ctx, provider, subject)
+}
+
+func ReadIdentities(ctx context.Context, userId string) ([]models.Identity, error) {
+	return store.ReadIdentities(ctx, userId)
+}
+
+func DeleteIdentity(ctx context.Context, userId string, provider string) error {
+	return store.DeleteIdentity(ctx, userId, provider)
+}
+
+func CreateSession(ctx context.Context, session *models.Session) error {
+	return store.CreateSession(ctx, session)
+}
+
+func ReadSession(ctx context.Context, id string) (*models.Session, error) {
+	return store.ReadSession(ctx, id)
+}
+
+func ReadSessions(ctx context.Context, userId string) ([]models.Session, error) {
+	return store.ReadSessions(ctx, userId)
+}
+
+func RotateSession(ctx context.Context, id string, oldHash string, newHash string, at time.Time, expiresAt time.Time) error {
+	return store.RotateSession(ctx, id, oldHash, newHash, at, expiresAt)
+}
+
+func TouchSession(ctx context.Context, id string, ip string, location string, at time.Time) error {
+	return store.TouchSession(ctx, id, ip, location, at)
+}
+
+func DeleteSession(ctx context.Context, userId string, id string) error {
+	return store.DeleteSession(ctx, userId, id)
+}
+
+func DeleteSessions(ctx context.Context, userId string, exceptId string) error {
+	return store.DeleteSessions(ctx, userId, exceptId)
+}
+
+func DeleteExpiredSessions(ctx context.Context, userId string, now time.Time) error {
+	return store.DeleteExpiredSessions(ctx, userId, now)
+}
+
+func CreateTwoFactor(ctx context.Context, twoFactor *models.TwoFactor) error {
+	return store.CreateTwoFactor(ctx, twoFactor)
+}
+
+func ReadTwoFactor(ctx context.Context, userId string) (*models.TwoFactor, error) {
+	return store.ReadTwoFactor(ctx, userId)
+}
+
+func EnableTwoFactor(ctx context.Context, userId string, step int64, at time.Time) error {
+	return store.EnableTwoFactor(ctx, userId, step, at)
+}
+
+func UseTwoFactorStep(ctx context.Context, userId string, step int64) error {
+	return store.UseTwoFactorStep(ctx, userId, step)
+}
+
+func DeleteTwoFactor(ctx context.Context, userId string) error {
+	return store.DeleteTwoFactor(ctx, userId)
+}
+
+func ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error {
+	return store.ReplaceRecoveryCodes(ctx, userId, codeHashes)
+}
+
+func UseRecoveryCode(ctx context.Context, userId string, codeHash string) error {
+	return store.UseRecoveryCode(ctx, userId, codeHash)
+}
+
+func CountRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	return store.CountRecoveryCodes(ctx, userId)
+}
+
+func CreateCredential(ctx context.Context, credential *models.Credential) error {
+	return store.CreateCredential(ctx, credential)
+}
+
+func ReadCredential(ctx context.Context, id []byte) (*models.Credential, error) {
+	return store.ReadCredential(ctx, id)
+}
+
+func ReadCredentials(ctx context.Context, userId string) ([]models.Credential, error) {
+	return store.ReadCredentials(ctx, userId)
+}
+
+func UseCredential(ctx context.Context, id []byte, signCount uint32, backupState bool, at time.Time) error {
+	return store.UseCredential(ctx, id, signCount, backupState, at)
+}
+
+func DeleteCredential(ctx context.Context, userId string, id []byte) error {
+	return store.DeleteCredential(ctx, userId, id)
+}
+
+func CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	return store.CreateAPIToken(ctx, token)
+}
+
+func ReadAPIToken(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	return store.ReadAPIToken(ctx, tokenHash)
+}
+
+func ReadAPITokens(ctx context.Context, userId string) ([]models.APIToken, error) {
+	return store.ReadAPITokens(ctx, userId)
+}
+
+func UseAPIToken(ctx context.Context, id string, at time.Time) error {
+	return store.UseAPIToken(ctx, id, at)
+}
+
+func DeleteAPIToken(ctx context.Context, userId string, id string) error {
+	return store.DeleteAPIToken(ctx, userId, id)
+}
+
+func DeleteAPITokens(ctx context.Context, userId string) error {
+	return store.DeleteAPITokens(ctx, userId)
+}
+
+func ReadLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	return store.ReadLoginThrottle(ctx, key)
+}
+
+func RecordLoginFailure(ctx context.Context, key string, at time.Time, since time.Time) (int, error) {
+	return store.RecordLoginFailure(ctx, key, at, since)
+}
+
+func LockLoginThrottle(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	return store.LockLoginThrottle(ctx, key)
+}
+
+func ForgiveLoginFailure(ctx context.Context, key string) error {
+	return store.ForgiveLoginFailure(ctx, key)
+}
+
+func DeleteLoginThrottle(ctx context.Context, key string) error {
+	return store.DeleteLoginThrottle(ctx, key)
+}
+
+func CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return store.CreateAuditEvent(ctx, event)
+}
+
+func ReadAuditEvents(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	return store.ReadAuditEvents(ctx, limit)
+}
+
+func Followed(ctx context.Context, userId string, followId string) (bool, error) {
+	return store.Followed(ctx, userId, followId)
+}
+
+// ReadFollowedIds reports which of ids userId follows.
+func ReadFollowedIds(ctx context.Context, userId string, ids []string) (map[string]bool, error) {
+	return store.ReadFollowedIds(ctx, userId, ids)
+}
+
+func ToggleFollow(ctx context.Context, userId string, followId string) (bool, error) {
+	return store.ToggleFollow(ctx, userId, followId)
+}
+
+// SetFollow makes userId follow followId or not, and reports whether that
+// changed anything.
+func SetFollow(ctx context.Context, userId string, followId string, follow bool) (bool, error) {
+	return store.SetFollow(ctx, userId, followId, follow)
+}
+
+func ReadFollowers(ctx context.Context, userId string) ([]string, error) {
+	return store.ReadFollowers(ctx, userId)
+}
+
+func ReadFollowersCount(ctx context.Context, userId string) (int, error) {
+	return store.ReadFollowersCount(ctx, userId)
+}
+
+func ReadFollowing(ctx context.Context, userId string) ([]string, error) {
+	return store.ReadFollowing(ctx, userId)
+}
+
+func ReadFollowingCount(ctx context.Context, userId string) (int, error) {
+	return store.ReadFollowingCount(ctx, userId)
+}
+
+func CreateVerificationId(ctx context.Context, token string, id string) error {
+	return store.CreateVerificationId(ctx, token, id)
+}
+
+func ReadVerificationId(ctx context.Context, id string) (string, error) {
+	return store.ReadVerificationId(ctx, id)
+}
+
+func DeleteVerificationId(ctx context.Context, id string) error {
+	return store.DeleteVerificationId(ctx, id)
+}
+
+func ReadMailSends(ctx context.Context, key string) (*models.MailSends, error) {
+	return store.ReadMailSends(ctx, key)
+}
+
+func RecordMailSend(ctx context.Context, key string, at time.Time, since time.Time) (int, error) {
+	return store.RecordMailSend(ctx, key, at, since)
+}
+
+func LockMailSends(ctx context.Context, key string) (*models.MailSends, error) {
+	return store.LockMailSends(ctx, key)
+}
+
+func CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	return store.CreatePasswordReset(ctx, reset)
+}
+
+func ReadPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	return store.ReadPasswordReset(ctx, tokenHash)
+}
+
+func DeletePasswordReset(ctx context.Context, tokenHash string) error {
+	return store.DeletePasswordReset(ctx, tokenHash)
+}
+
+func DeletePasswordResets(ctx context.Context, userId string) error {
+	return store.DeletePasswordResets(ctx, userId)
+}
+
+func CreateEmailChange(ctx context.Context, change *models.EmailChange) error {
+	return store.CreateEmailChange(ctx, change)
+}
+
+func ReadEmailChange(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	return store.ReadEmailChange(ctx, tokenHash)
+}
+
+func ReadPendingEmailChange(ctx context.Context, userId string) (*models.EmailChange, error) {
+	return store.ReadPendingEmailChange(ctx, userId)
+}
+
+func DeleteEmailChange(ctx context.Context, tokenHash string) error {
+	return store.DeleteEmailChange(ctx, tokenHash)
+}
+
+func DeleteEmailChanges(ctx context.Context, userId string) error {
+	return store.DeleteEmailChanges(ctx, userId)
+}
+
+func CreatePost(ctx context.Context, userId string, post *models.Post) error {
+	return store.CreatePost(ctx, userId, post)
+}
+
+func ReadPost(ctx context.Context, id string) (*models.Post, error) {
+	return store.ReadPost(ctx, id)
+}
+
+func ReadPostsCount(ctx context.Context, userId string) (int, error) {
+	return store.ReadPostsCount(ctx, userId)
+}
+
+func ReadPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error) {
+	return store.ReadPosts(ctx, userId, cursor, limit)
+}
+
+func ReadFeedPosts(ctx context.Context, userId string, cursor string, limit int) ([]models.Post, string, error) {
+	return store.ReadFeedPosts(ctx, userId, cursor, limit)
+}
+
+func UpdatePost(ctx context.Context, id string, body string) error {
+	return store.UpdatePost(ctx, id, body)
+}
+
+func DeletePost(ctx context.Context, id string) error {
+	return store.DeletePost(ctx, id)
+}
+
+func Voted(ctx context.Context, userId string, id string) (bool, error) {
+	return store.Voted(ctx, userId, id)
+}
+
+func ToggleVote(ctx context.Context, userId string, id string) (bool, error) {
+	return store.ToggleVote(ctx, userId, id)
+}
+
+// SetVote adds or removes userId's vote on the post, and reports whether
+// that changed anything.
+func SetVote(ctx context.Context, userId string, id string, vote bool) (bool, error) {
+	return store.SetVote(ctx, userId, id, vote)
+}
+
+func ReadVotes(ctx context.Context, id string) ([]string, error) {
+	return store.ReadVotes(ctx, id)
+}
+
+func CreateComment(ctx context.Context, userId string, postId string, comment *models.Comment) error {
+	return store.CreateComment(ctx, userId, postId, comment)
+}
+
+func ReadComment(ctx context.Context, id string) (*models.Comment, error) {
+	return store.ReadComment(ctx, id)
+}
+
+func ReadComments(ctx context.Context, postId string, cursor string, limit int) ([]models.Comment, string, error) {
+	return store.ReadComments(ctx, postId, cursor, limit)
+}
+
+func UpdateComment(ctx context.Context, id string, body string) error {
+	return store.UpdateComment(ctx, id, body)
+}
+
+func DeleteComment(ctx context.Context, id string) error {
+	return store.DeleteComment(ctx, id)
+}
+
+func SearchUsers(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.UserSummary, string, error) {
+	return store.SearchUsers(ctx, query, cursor, limit)
+}
+
+func SearchPosts(ctx context.Context, query SearchQuery, cursor string, limit int) ([]models.Post, string, error) {
+	return store.SearchPosts(ctx, query, cursor, limit)
+}
+
+// UsernameAvailable returns ErrUsernameTaken if s already has a user with the
+// given name. Run it on the tx of a signup so the check and insert go together.
+func UsernameAvailable(ctx context.Context, s Store, username string) error {
+	_, err := s.ReadUserByName(ctx, username)
+	switch {
+	case err == nil:
+		return ErrUsernameTaken
+	case errors.Is(err, ErrNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+// EmailAvailable returns ErrEmailTaken if s already has a user with the given
+// email address.
+func EmailAvailable(ctx context.Context, s Store, email string) error {
+	_, err := s.ReadUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		return ErrEmailTaken
+	case errors.Is(err, ErrNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+// LoginMethods counts the ways userId can log in: linked identities and
+// passkeys, plus their password unless they're an OAuth user without one.
+func LoginMethods(ctx context.Context, s Store, userId string) (int, error) {
+	identities, err := s.ReadIdentities(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	credentials, err := s.ReadCredentials(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	oauth, err := s.IsOAuthUser(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	if !oauth {
+		return len(identities) + len(credentials) + 1, nil
+	}
+	return len(identities) + len(credentials), nil
+}
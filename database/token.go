@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+const apiTokenColumns = `id, user_id, name, token_hash, scopes, created_at, last_used_at`
+
+func scanAPIToken(row scanner) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopes string
+	var lastUsed sql.NullTime
+	if err := row.Scan(&token.Id, &token.UserId, &token.Name, &token.TokenHash, &scopes, &token.CreatedAt, &lastUsed); err != nil {
+		return nil, wrapError(err)
+	}
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, ",")
+	}
+	token.LastUsedAt = lastUsed.Time
+	return &token, nil
+}
+
+func (s *mysqlStore) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (id, user_id, name, token_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		token.Id, token.UserId, token.Name, token.TokenHash, strings.Join(token.Scopes, ","), token.CreatedAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadAPIToken(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	return scanAPIToken(s.db.QueryRowContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens WHERE token_hash = ?`, tokenHash))
+}
+
+func (s *mysqlStore) ReadAPITokens(ctx context.Context, userId string) ([]models.APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens WHERE user_id = ? ORDER BY created_at`, userId)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, wrapError(rows.Err())
+}
+
+func (s *mysqlStore) UseAPIToken(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, at, id)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) DeleteAPIToken(ctx context.Context, userId string, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = ? AND id = ?`, userId, id))
+}
+
+func (s *mysqlStore) DeleteAPITokens(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = ?`, userId)
+	return wrapError(err)
+}
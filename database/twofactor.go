@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+func (s *mysqlStore) CreateTwoFactor(ctx context.Context, twoFactor *models.TwoFactor) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO two_factor (user_id, secret, last_step, created_at)
+		VALUES (?, ?, ?, ?)`,
+		twoFactor.UserId, twoFactor.Secret, twoFactor.LastStep, twoFactor.CreatedAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadTwoFactor(ctx context.Context, userId string) (*models.TwoFactor, error) {
+	var twoFactor models.TwoFactor
+	var enabled sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, secret, last_step, enabled_at, created_at
+		FROM two_factor WHERE user_id = ?`, userId,
+	).Scan(&twoFactor.UserId, &twoFactor.Secret, &twoFactor.LastStep, &enabled, &twoFactor.CreatedAt); err != nil {
+		return nil, wrapError(err)
+	}
+	twoFactor.EnabledAt = enabled.Time
+	return &twoFactor, nil
+}
+
+func (s *mysqlStore) EnableTwoFactor(ctx context.Context, userId string, step int64, at time.Time) error {
+	return expectRows(s.db.ExecContext(ctx, `
+		UPDATE two_factor SET enabled_at = ?, last_step = ?
+		WHERE user_id = ? AND enabled_at IS NULL`, at, step, userId))
+}
+
+func (s *mysqlStore) UseTwoFactorStep(ctx context.Context, userId string, step int64) error {
+	return expectRows(s.db.ExecContext(ctx, `
+		UPDATE two_factor SET last_step = ?
+		WHERE user_id = ? AND last_step < ?`, step, userId, step))
+}
+
+func (s *mysqlStore) DeleteTwoFactor(ctx context.Context, userId string) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*mysqlStore).db
+		if _, err := q.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userId); err != nil {
+			return wrapError(err)
+		}
+		return expectRows(q.ExecContext(ctx, `DELETE FROM two_factor WHERE user_id = ?`, userId))
+	})
+}
+
+func (s *mysqlStore) ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*mysqlStore).db
+		if _, err := q.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userId); err != nil {
+			return wrapError(err)
+		}
+		for _, hash := range codeHashes {
+			if _, err := q.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userId, hash); err != nil {
+				return wrapError(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *mysqlStore) UseRecoveryCode(ctx context.Context, userId string, codeHash string) error {
+	return expectRows(s.db.ExecContext(ctx,
+		`DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?`, userId, codeHash))
+}
+
+func (s *mysqlStore) CountRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`, userId).Scan(&count); err != nil {
+		return 0, wrapError(err)
+	}
+	return count, nil
+}
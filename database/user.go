@@ -1,15 +1,40 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/Aniket52kr/GO-Assignment/models"
 )
 
-func CreateUser(user *models.User) bool {
+const userColumns = `email, username, password, id, verified, avatar, created_at`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var user models.User
+	var email, avatar sql.NullString
+
+	if err := row.Scan(&email, &user.Username, &user.Password, &user.Id, &user.Verified, &avatar, &user.CreatedAt); err != nil {
+		return nil, wrapError(err)
+	}
+
+	if email.Valid {
+		user.Email = &email.String
+	}
+	if avatar.Valid {
+		user.Avatar = &avatar.String
+	}
+	return &user, nil
+}
+
+func (s *mysqlStore) CreateUser(ctx context.Context, user *models.User) error {
 	userEmail := ""
 	if user.Email != nil {
 		userEmail = *user.Email
@@ -19,253 +44,344 @@ func CreateUser(user *models.User) bool {
 		userAvatar = *user.Avatar
 	}
 
-	log.Printf("Creating user: %+v\n", user)
-
-	_, err := db.Exec(`
+	_, err := s.db.ExecContext(ctx, `
 		INSERT INTO t_users (email, username, password, id, verified, avatar, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		userEmail, user.Username, user.Password, user.Id, user.Verified, userAvatar, user.CreatedAt)
-
-	if err != nil {
-		log.Println("Insert failed:", err)
-		return false
-	}
-	return true
+	return wrapError(err)
 }
 
-func CreateOAuthUser(id string) bool {
-	_, err := db.Exec(`INSERT INTO o_users(id) VALUES (?)`, id)
-	if err != nil {
-		log.Println("CreateOAuthUser failed:", err)
-		return false
-	}
-	return true
+func (s *mysqlStore) CreateOAuthUser(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO o_users(id) VALUES (?)`, id)
+	return wrapError(err)
 }
 
-func ReadUserByName(username string) *models.User {
-	var user models.User
-	var email, avatar sql.NullString
+func (s *mysqlStore) ReadUserByName(ctx context.Context, username string) (*models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM t_users WHERE username = ?`, username))
+}
 
-	err := db.QueryRow(`
-		SELECT email, username, password, id, verified, avatar, created_at
-		FROM t_users WHERE username = ?`, username).
-		Scan(&email, &user.Username, &user.Password, &user.Id, &user.Verified, &avatar, &user.CreatedAt)
+func (s *mysqlStore) ReadUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM t_users WHERE email = ?`, email))
+}
 
-	if err != nil {
-		log.Println("ReadUserByName error:", err)
-		return nil
-	}
+func (s *mysqlStore) ReadUserById(ctx context.Context, id string) (*models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`
+		FROM t_users WHERE id = ?`, id))
+}
 
-	if email.Valid {
-		user.Email = &email.String
-	}
-	if avatar.Valid {
-		user.Avatar = &avatar.String
+func (s *mysqlStore) IsOAuthUser(ctx context.Context, id string) (bool, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM o_users WHERE id = ?`, id).Scan(&count); err != nil {
+		return false, wrapError(err)
 	}
-	return &user
+	return count > 0, nil
 }
 
-func ReadUserByEmail(email string) *models.User {
-	var user models.User
-	var emailField, avatar sql.NullString
-
-	err := db.QueryRow(`
-		SELECT email, username, password, id, verified, avatar, created_at
-		FROM t_users WHERE email = ?`, email).
-		Scan(&emailField, &user.Username, &user.Password, &user.Id, &user.Verified, &avatar, &user.CreatedAt)
+func (s *mysqlStore) DeleteOAuthUser(ctx context.Context, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM o_users WHERE id = ?`, id))
+}
 
-	if err != nil {
-		log.Println("ReadUserByEmail error:", err)
+func (s *mysqlStore) UpdateUser(ctx context.Context, id string, updates map[string]any) error {
+	// Apply all columns or none of them
+	return s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*mysqlStore).db
+		for column, value := range updates {
+			query := fmt.Sprintf("UPDATE t_users SET %s = ? WHERE id = ?", strings.ReplaceAll(column, "`", ""))
+			if _, err := q.ExecContext(ctx, query, value, id); err != nil {
+				return wrapError(err)
+			}
+		}
 		return nil
-	}
-
-	if emailField.Valid {
-		user.Email = &emailField.String
-	}
-	if avatar.Valid {
-		user.Avatar = &avatar.String
-	}
-	return &user
+	})
 }
 
-func ReadUserById(id string) *models.User {
-	var user models.User
-	var email, avatar sql.NullString
-
-	err := db.QueryRow(`
-		SELECT email, username, password, id, verified, avatar, created_at
-		FROM t_users WHERE id = ?`, id).
-		Scan(&email, &user.Username, &user.Password, &user.Id, &user.Verified, &avatar, &user.CreatedAt)
-
-	if err != nil {
-		log.Println("ReadUserById error:", err)
-		return nil
-	}
+func (s *mysqlStore) DeleteUser(ctx context.Context, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM t_users WHERE id = ?`, id))
+}
 
-	if email.Valid {
-		user.Email = &email.String
-	}
-	if avatar.Valid {
-		user.Avatar = &avatar.String
-	}
-	return &user
+func (s *mysqlStore) LockUser(ctx context.Context, id string) error {
+	var locked string
+	return wrapError(s.db.QueryRowContext(ctx, `SELECT id FROM t_users WHERE id = ? FOR UPDATE`, id).Scan(&locked))
 }
 
-func IsOAuthUser(id string) bool {
+func (s *mysqlStore) Followed(ctx context.Context, userId, followId string) (bool, error) {
 	var count int
-	_ = db.QueryRow(`SELECT COUNT(*) FROM o_users WHERE id = ?`, id).Scan(&count)
-	return count > 0
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM follows WHERE user_id = ? AND follow_id = ?`, userId, followId,
+	).Scan(&count); err != nil {
+		return false, wrapError(err)
+	}
+	return count > 0, nil
 }
 
-func ReadUsers(username string, limit int, offset int) []models.User {
-	var users []models.User
-
-	rows, err := db.Query(`
-		SELECT email, username, password, id, verified, avatar, created_at
-		FROM t_users WHERE username LIKE ? ORDER BY username LIMIT ? OFFSET ?`,
-		"%"+username+"%", limit, offset)
+func (s *mysqlStore) ReadFollowedIds(ctx context.Context, userId string, ids []string) (map[string]bool, error) {
+	followed := map[string]bool{}
+	if len(ids) == 0 {
+		return followed, nil
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT follow_id FROM follows WHERE user_id = ? AND follow_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`,
+		append([]any{userId}, anySlice(ids)...)...,
+	)
 	if err != nil {
-		log.Println("ReadUsers error:", err)
-		return nil
+		return nil, wrapError(err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var user models.User
-		var email, avatar sql.NullString
-
-		err := rows.Scan(&email, &user.Username, &user.Password, &user.Id, &user.Verified, &avatar, &user.CreatedAt)
-		if err != nil {
-			log.Println("Scan error:", err)
-			continue
-		}
-
-		if email.Valid {
-			user.Email = &email.String
-		}
-		if avatar.Valid {
-			user.Avatar = &avatar.String
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, wrapError(err)
 		}
-		users = append(users, user)
+		followed[id] = true
 	}
-	return users
+	return followed, wrapError(rows.Err())
 }
 
-func UpdateUser(id string, updates map[string]any) bool {
-	for column, value := range updates {
-		query := fmt.Sprintf("UPDATE t_users SET %s = ? WHERE id = ?", strings.ReplaceAll(column, "`", ""))
-		if _, err := db.Exec(query, value, id); err != nil {
-			log.Println("UpdateUser error:", err)
-			return false
-		}
+func anySlice(values []string) []any {
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
 	}
-	return true
+	return args
 }
 
-func DeleteUser(id string) bool {
-	if _, err := db.Exec(`DELETE FROM t_users WHERE id = ?`, id); err != nil {
-		log.Println("DeleteUser error:", err)
-		return false
-	}
-	return true
+// ToggleFollow follows or unfollows in one transaction and reports whether
+// userId follows followId afterwards.
+func (s *mysqlStore) ToggleFollow(ctx context.Context, userId, followId string) (bool, error) {
+	var following bool
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		following, err = toggle(ctx, tx.(*mysqlStore).db,
+			`DELETE FROM follows WHERE user_id = ? AND follow_id = ?`,
+			`INSERT INTO follows(user_id, follow_id) VALUES (?, ?)`,
+			userId, followId,
+		)
+		return err
+	})
+	return following, err
 }
 
-func Followed(userId, followId string) bool {
-	var count int
-	_ = db.QueryRow(`SELECT COUNT(*) FROM follows WHERE user_id = ? AND follow_id = ?`, userId, followId).Scan(&count)
-	return count > 0
+func (s *mysqlStore) SetFollow(ctx context.Context, userId, followId string, follow bool) (bool, error) {
+	return set(ctx, s.db, follow,
+		`DELETE FROM follows WHERE user_id = ? AND follow_id = ?`,
+		`INSERT INTO follows(user_id, follow_id) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE follow_id = follow_id`,
+		userId, followId,
+	)
 }
 
-func ToggleFollow(userId, followId string) {
-	var query string
-	if Followed(userId, followId) {
-		query = `DELETE FROM follows WHERE user_id = ? AND follow_id = ?`
-	} else {
-		query = `INSERT INTO follows(user_id, follow_id) VALUES (?, ?)`
+// set runs insert when on is true and remove otherwise, and reports whether
+// a row was added or deleted. insert must leave an existing row alone.
+func set(ctx context.Context, q querier, on bool, remove string, insert string, args ...any) (bool, error) {
+	query := remove
+	if on {
+		query = insert
+	}
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, wrapError(err)
 	}
-	if _, err := db.Exec(query, userId, followId); err != nil {
-		log.Println("ToggleFollow error:", err)
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapError(err)
 	}
+	return changed > 0, nil
 }
 
-func ReadFollowers(userId string) []string {
-	var followers []string
-	rows, err := db.Query(`
-		SELECT username FROM t_users WHERE id IN (SELECT user_id FROM follows WHERE follow_id = ?)`, userId)
+// toggle deletes the row matched by remove, or runs insert when there was
+// nothing to delete, and reports whether the row exists afterwards.
+func toggle(ctx context.Context, q querier, remove string, insert string, args ...any) (bool, error) {
+	result, err := q.ExecContext(ctx, remove, args...)
 	if err != nil {
-		log.Println("ReadFollowers error:", err)
-		return nil
+		return false, wrapError(err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return false, wrapError(err)
+	} else if deleted > 0 {
+		return false, nil
+	}
+	if _, err := q.ExecContext(ctx, insert, args...); err != nil {
+		return false, wrapError(err)
+	}
+	return true, nil
+}
+
+func (s *mysqlStore) readUsernames(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError(err)
 	}
 	defer rows.Close()
 
+	var usernames []string
 	for rows.Next() {
 		var username string
-		rows.Scan(&username)
-		followers = append(followers, username)
+		if err := rows.Scan(&username); err != nil {
+			return nil, wrapError(err)
+		}
+		usernames = append(usernames, username)
 	}
-	return followers
+	return usernames, wrapError(rows.Err())
+}
+
+func (s *mysqlStore) ReadFollowers(ctx context.Context, userId string) ([]string, error) {
+	return s.readUsernames(ctx, `
+		SELECT username FROM t_users WHERE id IN (SELECT user_id FROM follows WHERE follow_id = ?)`, userId)
 }
 
-func ReadFollowersCount(userId string) int {
+func (s *mysqlStore) ReadFollowersCount(ctx context.Context, userId string) (int, error) {
 	var count int
-	if err := db.QueryRow(`
+	if err := s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM t_users WHERE id IN (SELECT user_id FROM follows WHERE follow_id = ?)`, userId).Scan(&count); err != nil {
-		log.Println("ReadFollowersCount error:", err)
-		return 0
+		return 0, wrapError(err)
 	}
-	return count
+	return count, nil
 }
 
-func ReadFollowing(userId string) []string {
-	var following []string
-	rows, err := db.Query(`
+func (s *mysqlStore) ReadFollowing(ctx context.Context, userId string) ([]string, error) {
+	return s.readUsernames(ctx, `
 		SELECT username FROM t_users WHERE id IN (SELECT follow_id FROM follows WHERE user_id = ?)`, userId)
-	if err != nil {
-		log.Println("ReadFollowing error:", err)
-		return nil
+}
+
+func (s *mysqlStore) ReadFollowingCount(ctx context.Context, userId string) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM t_users WHERE id IN (SELECT follow_id FROM follows WHERE user_id = ?)`, userId).Scan(&count); err != nil {
+		return 0, wrapError(err)
 	}
-	defer rows.Close()
+	return count, nil
+}
 
-	for rows.Next() {
-		var username string
-		rows.Scan(&username)
-		following = append(following, username)
+func (s *mysqlStore) CreateVerificationId(ctx context.Context, token string, id string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO shorturl(token, id) VALUES (?, ?)`, token, id)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadVerificationId(ctx context.Context, id string) (string, error) {
+	var token string
+	if err := s.db.QueryRowContext(ctx, `SELECT token FROM shorturl WHERE id = ?`, id).Scan(&token); err != nil {
+		return "", wrapError(err)
 	}
-	return following
+	return token, nil
 }
 
-func ReadFollowingCount(userId string) int {
-	var count int
-	if err := db.QueryRow(`
-		SELECT COUNT(*) FROM t_users WHERE id IN (SELECT follow_id FROM follows WHERE user_id = ?)`, userId).Scan(&count); err != nil {
-		log.Println("ReadFollowingCount error:", err)
-		return 0
+func (s *mysqlStore) DeleteVerificationId(ctx context.Context, id string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM shorturl WHERE id = ?`, id))
+}
+
+func (s *mysqlStore) ReadMailSends(ctx context.Context, key string) (*models.MailSends, error) {
+	var sends models.MailSends
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT send_key, sent, last_sent_at
+		FROM mail_sends WHERE send_key = ?`, key,
+	).Scan(&sends.Key, &sends.Sent, &sends.LastSentAt); err != nil {
+		return nil, wrapError(err)
 	}
-	return count
+	return &sends, nil
 }
 
-func CreateVerificationId(token string, id string) bool {
-	_, err := db.Exec(`INSERT INTO shorturl(token, id) VALUES (?, ?)`, token, id)
-	if err != nil {
-		log.Println("CreateVerificationId error:", err)
-		return false
+func (s *mysqlStore) RecordMailSend(ctx context.Context, key string, at time.Time, since time.Time) (int, error) {
+	var sent int
+	err := s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*mysqlStore).db
+		// sent is assigned first, so it still sees the old last_sent_at
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO mail_sends (send_key, sent, last_sent_at) VALUES (?, 1, ?)
+			ON DUPLICATE KEY UPDATE
+				sent = IF(last_sent_at < ?, 1, sent + 1),
+				last_sent_at = VALUES(last_sent_at)`, key, at, since); err != nil {
+			return wrapError(err)
+		}
+		return wrapError(q.QueryRowContext(ctx,
+			`SELECT sent FROM mail_sends WHERE send_key = ?`, key).Scan(&sent))
+	})
+	return sent, err
+}
+
+func (s *mysqlStore) LockMailSends(ctx context.Context, key string) (*models.MailSends, error) {
+	// Only a row that exists can be locked, a new one has none sent
+	if _, err := s.db.ExecContext(ctx, `INSERT IGNORE INTO mail_sends (send_key) VALUES (?)`, key); err != nil {
+		return nil, wrapError(err)
+	}
+	var sends models.MailSends
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT send_key, sent, last_sent_at
+		FROM mail_sends WHERE send_key = ? FOR UPDATE`, key,
+	).Scan(&sends.Key, &sends.Sent, &sends.LastSentAt); err != nil {
+		return nil, wrapError(err)
 	}
-	return true
+	return &sends, nil
 }
 
-func ReadVerificationId(id string) string {
-	var token string
-	if err := db.QueryRow(`SELECT token FROM shorturl WHERE id = ?`, id).Scan(&token); err != nil {
-		log.Println("ReadVerificationId error:", err)
-		return ""
+func (s *mysqlStore) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO password_resets (token_hash, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?)`,
+		reset.TokenHash, reset.UserId, reset.ExpiresAt, reset.CreatedAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadPasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT token_hash, user_id, expires_at, created_at
+		FROM password_resets WHERE token_hash = ?`, tokenHash,
+	).Scan(&reset.TokenHash, &reset.UserId, &reset.ExpiresAt, &reset.CreatedAt); err != nil {
+		return nil, wrapError(err)
 	}
-	return token
+	return &reset, nil
+}
+
+func (s *mysqlStore) DeletePasswordReset(ctx context.Context, tokenHash string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM password_resets WHERE token_hash = ?`, tokenHash))
+}
+
+func (s *mysqlStore) DeletePasswordResets(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = ?`, userId)
+	return wrapError(err)
 }
 
-func DeleteVerificationId(id string) bool {
-	if _, err := db.Exec(`DELETE FROM shorturl WHERE id = ?`, id); err != nil {
-		log.Println("DeleteVerificationId error:", err)
-		return false
+func scanEmailChange(row scanner) (*models.EmailChange, error) {
+	var change models.EmailChange
+	if err := row.Scan(&change.TokenHash, &change.UserId, &change.Email, &change.ExpiresAt, &change.CreatedAt); err != nil {
+		return nil, wrapError(err)
 	}
-	return true
+	return &change, nil
+}
+
+func (s *mysqlStore) CreateEmailChange(ctx context.Context, change *models.EmailChange) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO email_changes (token_hash, user_id, email, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		change.TokenHash, change.UserId, change.Email, change.ExpiresAt, change.CreatedAt)
+	return wrapError(err)
+}
+
+func (s *mysqlStore) ReadEmailChange(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	return scanEmailChange(s.db.QueryRowContext(ctx, `
+		SELECT token_hash, user_id, email, expires_at, created_at
+		FROM email_changes WHERE token_hash = ?`, tokenHash))
+}
+
+// ReadPendingEmailChange returns userId's latest email change.
+func (s *mysqlStore) ReadPendingEmailChange(ctx context.Context, userId string) (*models.EmailChange, error) {
+	return scanEmailChange(s.db.QueryRowContext(ctx, `
+		SELECT token_hash, user_id, email, expires_at, created_at
+		FROM email_changes WHERE user_id = ?
+		ORDER BY created_at DESC LIMIT 1`, userId))
+}
+
+func (s *mysqlStore) DeleteEmailChange(ctx context.Context, tokenHash string) error {
+	return expectRows(s.db.ExecContext(ctx, `DELETE FROM email_changes WHERE token_hash = ?`, tokenHash))
+}
+
+func (s *mysqlStore) DeleteEmailChanges(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = ?`, userId)
+	return wrapError(err)
 }
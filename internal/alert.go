@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityAlert mails userId about event, a change to how their account is
+// protected (eg. "password_changed"), naming the login method or API token
+// if it's about one. Only verified addresses get alerts, and failures are
+// just logged as the change itself already went through.
+func SecurityAlert(c *gin.Context, userId string, event string, method string) {
+	user, err := database.ReadUserById(c.Request.Context(), userId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if user.Email == nil || !user.Verified {
+		return
+	}
+	link, err := MailURL(alertPage(event))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := mail.Send(*user.Email, mail.Locale(c.GetHeader("Accept-Language")), "security", gin.H{
+		"Username": user.Username,
+		"Event":    event,
+		"Method":   method,
+		"IP":       c.ClientIP(),
+		"Time":     time.Now(),
+		"Link":     link,
+	}); err != nil {
+		log.Println(err)
+	}
+}
+
+// alertPage is the settings page where the change event is about can be
+// looked at or undone.
+func alertPage(event string) string {
+	if strings.HasPrefix(event, "api_token_") {
+		return "/user/settings/tokens"
+	}
+	return "/user/settings/logins"
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"os"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+type discord struct{}
+
+func init() {
+	Register(discord{})
+}
+
+func (discord) Name() string  { return "discord" }
+func (discord) Title() string { return "Discord" }
+func (discord) Icon() string  { return "fa-brands fa-discord" }
+
+func (discord) Enabled() bool {
+	return os.Getenv("DISCORD_CLIENT_ID") != ""
+}
+
+func (discord) Config(ctx context.Context, redirectURL string) (*oauth2.Config, error) {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("DISCORD_CLIENT_ID"),
+		ClientSecret: os.Getenv("DISCORD_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"identify", "email"},
+		Endpoint:     endpoints.Discord,
+	}, nil
+}
+
+func (discord) Identity(ctx context.Context, grant Grant) (*Identity, error) {
+	var authUser models.DiscordUser
+	if err := getJSON(ctx, grant.Client, "https://discord.com/api/users/@me", &authUser); err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		Subject:  authUser.DiscordId,
+		Verified: authUser.Verified,
+		Username: authUser.Username,
+	}
+	if authUser.Email != nil {
+		identity.Email = *authUser.Email
+	}
+	// Discord only hands out the hash of the avatar image
+	if authUser.Avatar != nil {
+		avatar := "https://cdn.discordapp.com/avatars/" + authUser.DiscordId + "/" + *authUser.Avatar + ".png"
+		identity.Avatar = &avatar
+	}
+	return identity, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+)
+
+// flow is an authorization request in progress, kept in the session between
+// Begin and Callback.
+type flow struct {
+	Provider string
+	State    string // echoed back by the provider, ties the callback to this session
+	Verifier string // PKCE code verifier
+	Nonce    string // echoed in OIDC ID tokens
+	Action   string
+	UserId   string // the logged in user linking an account
+	Expires  int64
+}
+
+// What the user started the flow for
+const (
+	actionSignup = "signup"
+	actionLogin  = "login"
+	actionLink   = "link"
+)
+
+// How long the user has to get through the provider's pages
+const flowTTL = 10 * time.Minute
+
+const flowKey = "oauthFlow"
+
+func newFlow(provider string, action string, userId string) *flow {
+	return &flow{
+		Provider: provider,
+		State:    randomToken(),
+		Verifier: randomToken(),
+		Nonce:    randomToken(),
+		Action:   action,
+		UserId:   userId,
+		Expires:  time.Now().Add(flowTTL).Unix(),
+	}
+}
+
+func (f *flow) save(session sessions.Session) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	session.Set(flowKey, string(data))
+	return session.Save()
+}
+
+// takeFlow removes the pending flow from the session and returns it if it
+// was started for provider with the given state and hasn't expired. A flow
+// can only be completed once.
+func takeFlow(session sessions.Session, provider string, state string) (*flow, bool) {
+	data, _ := session.Get(flowKey).(string)
+	session.Delete(flowKey)
+	session.Save()
+
+	var f flow
+	if data == "" || json.Unmarshal([]byte(data), &f) != nil {
+		return nil, false
+	}
+	if f.Provider != provider || time.Now().Unix() > f.Expires ||
+		subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) != 1 {
+		return nil, false
+	}
+	return &f, true
+}
@@ -1,190 +1,67 @@
 package auth
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
-	"net/http"
-	"net/url"
+	"context"
+	"errors"
 	"os"
-	"time"
+	"strconv"
 
-	"github.com/Aniket52kr/GO-Assignment/database"
-	"github.com/Aniket52kr/GO-Assignment/internal"
-	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/Aniket52kr/GO-Assignment/models"
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
 )
 
-const GITHUB_URL = "https://github.com/login/oauth"
+type gitHub struct{}
 
-func GitHubSignUp(c *gin.Context) {
-	api, _ := url.Parse(GITHUB_URL + "/authorize")
-	params := url.Values{
-		"client_id":    []string{os.Getenv("GITHUB_CLIENT_ID")},
-		"redirect_uri": []string{"http://localhost:8081/auth/github"},
-	}
-	api.RawQuery = params.Encode()
-	api.RawQuery += "&scope=read:user,user:email"
-	c.Redirect(http.StatusFound, api.String())
+func init() {
+	Register(gitHub{})
 }
 
-func GitHubLogin(c *gin.Context) {
-	api, _ := url.Parse(GITHUB_URL + "/authorize")
-	params := url.Values{
-		"client_id":    []string{os.Getenv("GITHUB_CLIENT_ID")},
-		"redirect_uri": []string{"http://localhost:8081/auth/github?login=true"},
-	}
-	api.RawQuery = params.Encode()
-	api.RawQuery += "&scope=read:user,user:email"
-	c.Redirect(http.StatusFound, api.String())
+func (gitHub) Name() string  { return "github" }
+func (gitHub) Title() string { return "GitHub" }
+func (gitHub) Icon() string  { return "fa-brands fa-github" }
+
+func (gitHub) Enabled() bool {
+	return os.Getenv("GITHUB_CLIENT_ID") != ""
 }
 
-func GitHubAuth(c *gin.Context) {
-	authCode := c.Query("code")
-	client := &http.Client{}
-	data := url.Values{
-		"client_id":     []string{os.Getenv("GITHUB_CLIENT_ID")},
-		"client_secret": []string{os.Getenv("GITHUB_CLIENT_SECRET")},
-		"code":          []string{authCode},
-	}
-	switch c.Query("login") {
-	case "true":
-		data.Add("redirect_uri", "http://localhost:8081/auth/github?login=true")
-	default:
-		data.Add("redirect_uri", "http://localhost:8081/auth/github")
-	}
-	request, _ := http.NewRequest("POST", GITHUB_URL+"/access_token", bytes.NewBuffer([]byte(data.Encode())))
-	request.Header.Set("Accept", "application/json")
+func (gitHub) Config(ctx context.Context, redirectURL string) (*oauth2.Config, error) {
+	return &oauth2.Config{
+		ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"read:user", "user:email"},
+		Endpoint:     github.Endpoint,
+	}, nil
+}
 
-	response, err := client.Do(request)
-	if err != nil {
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to retrieve access token, try again later.",
-		})
-		return
+func (gitHub) Identity(ctx context.Context, grant Grant) (*Identity, error) {
+	var authUser models.GitHubUser
+	if err := getJSON(ctx, grant.Client, "https://api.github.com/user", &authUser); err != nil {
+		return nil, err
 	}
-	defer response.Body.Close()
-
-	var responseData map[string]interface{}
-	if err := json.NewDecoder(response.Body).Decode(&responseData); err != nil {
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to parse authentication response, try again later.",
-		})
-		return
+	identity := &Identity{
+		Subject:  strconv.FormatInt(authUser.GitHubId, 10),
+		Username: authUser.Username,
+		Avatar:   authUser.Avatar,
 	}
-	accessToken := responseData["access_token"].(string)
 
-	request, _ = http.NewRequest("GET", "https://api.github.com/user", nil)
-	request.Header.Add("Authorization", "Bearer "+accessToken)
-	response, err = client.Do(request)
-	if err != nil {
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to make authorization request, try again later.",
-		})
-		return
+	// The profile only has an email if the user made it public, and never
+	// says whether it's verified, so ask for the primary address
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
 	}
-	defer response.Body.Close()
-
-	var authUser models.GitHubUser
-	if err := json.NewDecoder(response.Body).Decode(&authUser); err != nil {
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to parse authorization response, try again later.",
-		})
-		return
+	if err := getJSON(ctx, grant.Client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
 	}
-
-	if authUser.Email == nil {
-		request, _ = http.NewRequest("GET", "https://api.github.com/user/emails", nil)
-		request.Header.Add("Authorization", "Bearer "+accessToken)
-		response, err = client.Do(request)
-		if err != nil {
-			log.Println(err)
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to make authorization request, try again later.",
-			})
-			return
-		}
-		defer response.Body.Close()
-
-		var emails []map[string]interface{}
-		if err := json.NewDecoder(response.Body).Decode(&emails); err != nil {
-			log.Println(err)
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to parse authorization response, try again later.",
-			})
-			return
-		}
-		email := emails[0]["email"].(string)
-		authUser.Email = &email
-		authUser.Verified = emails[0]["verified"].(bool)
-	}
-
-	exists := database.ReadUserByEmail(*authUser.Email)
-	switch c.Query("login") {
-	case "true":
-		if exists == nil {
-			c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
-				"error":   "401 Unauthorized",
-				"message": "User does not exist.",
-			})
-			return
-		}
-		token, _ := middleware.CreateToken(exists.Id)
-		session := sessions.Default(c)
-		session.Set("Authorization", token)
-		session.Save()
-		c.Redirect(http.StatusFound, "/feed")
-	default:
-		if exists != nil {
-			c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
-				"error":   "403 Forbidden",
-				"message": "Account already exists with the given email.",
-			})
-			return
-		}
-		var user models.User
-		user.Username = authUser.Username
-		if result := database.ReadUserByName(user.Username); result != nil {
-			user.Username += internal.RandomString(32 - len(authUser.Username))
-		}
-		user.CreatedAt = time.Now()
-		user.Email = authUser.Email
-		user.Verified = authUser.Verified
-		user.Id = uuid.NewString()
-		user.Password = uuid.NewString()
-		user.HashPassword()
-
-		if res := database.CreateUser(&user); !res {
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to create account, try again later.",
-			})
-			return
-		}
-		database.CreateOAuthUser(user.Id)
-
-		token, _ := middleware.CreateToken(user.Id)
-		session := sessions.Default(c)
-		session.Set("Authorization", token)
-		session.Save()
-
-		if user.Verified {
-			c.Redirect(http.StatusFound, "/user/")
-		} else {
-			c.Redirect(http.StatusFound, "/auth/verify?signup=true")
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.Verified = email.Verified
+			return identity, nil
 		}
 	}
+	return nil, errors.New("github: account has no primary email")
 }
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// keySet caches an issuer's JSON Web Key Set. Unknown key ids trigger a
+// refetch, at most once a minute, so key rotation is picked up.
+type keySet struct {
+	url string
+
+	mu      sync.Mutex
+	keys    map[string]any // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+	fetched time.Time
+}
+
+const keySetRefetch = time.Minute
+
+// key returns the signing key with the given id, or the only key in the set
+// when the token doesn't name one.
+func (s *keySet) key(ctx context.Context, kid string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(s.fetched) < keySetRefetch {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+	if err := s.fetch(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+func (s *keySet) lookup(kid string) (any, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (s *keySet) fetch(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, oidcClient, s.url, &set); err != nil {
+		return fmt.Errorf("oidc: jwks: %w", err)
+	}
+	keys := map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Skip key types we don't know rather than failing every login
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	s.keys, s.fetched = keys, time.Now()
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: malformed key: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// redirectURL is where p sends the user back to, it has to be registered
+// with the provider as is.
+func redirectURL(c *gin.Context, p Provider) string {
+	return internal.AbsoluteURL(c, "/auth/"+p.Name()+"/callback")
+}
+
+func provider(c *gin.Context) (Provider, bool) {
+	p, ok := Lookup(c.Param("provider"))
+	if !ok {
+		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
+			"error":   "404 Not Found",
+			"message": "Unknown login provider.",
+		})
+	}
+	return p, ok
+}
+
+// Begin sends the user to the provider to sign up, or to log in with
+// ?login=true.
+func Begin(c *gin.Context) {
+	p, ok := provider(c)
+	if !ok {
+		return
+	}
+	action := actionSignup
+	if c.Query("login") == "true" {
+		action = actionLogin
+	}
+	start(c, p, action, "")
+}
+
+// BeginLink sends the logged in user to the provider to link the account to
+// theirs, once they confirmed it's them. It goes after AuthMiddleware and
+// TwoFactorMiddleware, like the other settings changes.
+func BeginLink(c *gin.Context) {
+	p, ok := provider(c)
+	if !ok {
+		return
+	}
+	if !middleware.ConfirmIdentity(c, c.PostForm("current")) {
+		return
+	}
+	start(c, p, actionLink, middleware.UserId(c))
+}
+
+// start begins a flow for action with the provider.
+func start(c *gin.Context, p Provider, action string, userId string) {
+	config, err := p.Config(c.Request.Context(), redirectURL(c, p))
+	if err != nil {
+		providerError(c, p, err)
+		return
+	}
+	f := newFlow(p.Name(), action, userId)
+	if err := f.save(sessions.Default(c)); err != nil {
+		log.Println(err)
+		c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
+			"error":   "500 Internal Server Error",
+			"message": "Unable to start login, try again later.",
+		})
+		return
+	}
+	c.Redirect(http.StatusFound, config.AuthCodeURL(
+		f.State,
+		oauth2.S256ChallengeOption(f.Verifier),
+		oauth2.SetAuthURLParam("nonce", f.Nonce),
+	))
+}
+
+// Callback finishes the flow started by Begin.
+func Callback(c *gin.Context) {
+	p, ok := provider(c)
+	if !ok {
+		return
+	}
+	f, ok := takeFlow(sessions.Default(c), p.Name(), c.Query("state"))
+	if !ok {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Login request is invalid or has expired, try again.",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	config, err := p.Config(ctx, redirectURL(c, p))
+	if err != nil {
+		providerError(c, p, err)
+		return
+	}
+	token, err := config.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(f.Verifier))
+	if err != nil {
+		log.Println(err)
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Unable to retrieve access token, try again later.",
+		})
+		return
+	}
+	identity, err := p.Identity(ctx, Grant{
+		Client: config.Client(ctx, token),
+		Token:  token,
+		Nonce:  f.Nonce,
+	})
+	if err != nil {
+		log.Println(err)
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Unable to retrieve your " + p.Title() + " account, try again later.",
+		})
+		return
+	}
+	switch f.Action {
+	case actionLogin:
+		logIn(c, p, identity)
+	case actionLink:
+		link(c, p, f, identity)
+	default:
+		signUp(c, p, identity)
+	}
+}
+
+// providerError reports a provider we couldn't talk to, eg. because OIDC
+// discovery failed.
+func providerError(c *gin.Context, p Provider, err error) {
+	log.Println(err)
+	c.HTML(http.StatusBadGateway, "error.tmpl.html", gin.H{
+		"error":   "502 Bad Gateway",
+		"message": "Unable to reach " + p.Title() + ", try again later.",
+	})
+}
+
+func logIn(c *gin.Context, p Provider, identity *Identity) {
+	ctx := c.Request.Context()
+	linked, err := database.ReadIdentity(ctx, p.Name(), identity.Subject)
+	if errors.Is(err, database.ErrNotFound) {
+		linked, err = claimAccount(ctx, p, identity)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "No account is linked to this " + p.Title() + " account.",
+		})
+		return
+	} else if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	// The provider stands in for the password, not for the second factor
+	middleware.LogIn(c, linked.UserId, "/feed")
+}
+
+// claimAccount links identity to the account it signed up before identities
+// were recorded, when those were matched by email alone. Only accounts
+// without a password or any linked identity qualify, and only for an email
+// address the provider has verified.
+func claimAccount(ctx context.Context, p Provider, identity *Identity) (*models.Identity, error) {
+	if identity.Email == "" || !identity.Verified {
+		return nil, database.ErrNotFound
+	}
+	linked := &models.Identity{
+		Provider:  p.Name(),
+		Subject:   identity.Subject,
+		CreatedAt: time.Now(),
+	}
+	err := database.WithTx(ctx, func(tx database.Store) error {
+		user, err := tx.ReadUserByEmail(ctx, identity.Email)
+		if err != nil {
+			return err
+		}
+		if err := tx.LockUser(ctx, user.Id); err != nil {
+			return err
+		}
+		oauth, err := tx.IsOAuthUser(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		identities, err := tx.ReadIdentities(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		if !oauth || len(identities) > 0 {
+			return database.ErrNotFound
+		}
+		linked.UserId = user.Id
+		return tx.CreateIdentity(ctx, linked)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return linked, nil
+}
+
+func signUp(c *gin.Context, p Provider, identity *Identity) {
+	ctx := c.Request.Context()
+	if identity.Email == "" {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Your " + p.Title() + " account has no email address.",
+		})
+		return
+	}
+	var user models.User
+	user.CreatedAt = time.Now()
+	user.Email = &identity.Email
+	user.Verified = identity.Verified
+	user.Avatar = identity.Avatar
+	user.Id = uuid.NewString()
+	// Generate a random password for oauth user
+	user.Password = uuid.NewString()
+	user.HashPassword()
+
+	// Create the account, mark it as OAuth and link the identity in one
+	// transaction, so a failure can't leave a half-built account behind
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		if _, err := tx.ReadIdentity(ctx, p.Name(), identity.Subject); err == nil {
+			return errAlreadyLinked
+		} else if !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		if err := database.EmailAvailable(ctx, tx, *user.Email); err != nil {
+			return err
+		}
+		user.Username = username(identity)
+		// Update the username if it already exists in the database
+		if err := database.UsernameAvailable(ctx, tx, user.Username); errors.Is(err, database.ErrUsernameTaken) {
+			user.Username += internal.RandomString(32 - len(user.Username))
+		} else if err != nil {
+			return err
+		}
+		if err := tx.CreateUser(ctx, &user); err != nil {
+			return err
+		}
+		// Add to table that identifies OAuth users
+		if err := tx.CreateOAuthUser(ctx, user.Id); err != nil {
+			return err
+		}
+		return tx.CreateIdentity(ctx, &models.Identity{
+			Provider:  p.Name(),
+			Subject:   identity.Subject,
+			UserId:    user.Id,
+			CreatedAt: user.CreatedAt,
+		})
+	}); errors.Is(err, errAlreadyLinked) {
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "This " + p.Title() + " account already has a SocialEcho account, log in instead.",
+		})
+		return
+	} else if errors.Is(err, database.ErrEmailTaken) {
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "Account already exists with the given email. Log in and link " + p.Title() + " from your settings.",
+		})
+		return
+	} else if err != nil {
+		internal.DatabaseError(c, err, internal.ConflictMessage(err))
+		return
+	}
+	if err := middleware.StartSession(c, user.Id); err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	if user.Verified {
+		c.Redirect(http.StatusFound, "/user/")
+	} else {
+		c.Redirect(http.StatusFound, "/auth/verify?signup=true")
+	}
+}
+
+var errAlreadyLinked = errors.New("identity already linked")
+
+// link adds identity as a way to log in to the account that started f,
+// if it's still logged in on this device.
+func link(c *gin.Context, p Provider, f *flow, identity *Identity) {
+	if !middleware.RequireLogin(c) {
+		return
+	}
+	if middleware.UserId(c) != f.UserId {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		if linked, err := tx.ReadIdentity(ctx, p.Name(), identity.Subject); err == nil {
+			if linked.UserId != f.UserId {
+				return errAlreadyLinked
+			}
+			return nil
+		} else if !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		// The unique key on (user_id, provider) rejects a second account
+		// from the same provider
+		return tx.CreateIdentity(ctx, &models.Identity{
+			Provider:  p.Name(),
+			Subject:   identity.Subject,
+			UserId:    f.UserId,
+			CreatedAt: time.Now(),
+		})
+	}); errors.Is(err, errAlreadyLinked) {
+		c.HTML(http.StatusConflict, "error.tmpl.html", gin.H{
+			"error":   "409 Conflict",
+			"message": "This " + p.Title() + " account is linked to another SocialEcho account.",
+		})
+		return
+	} else if errors.Is(err, database.ErrConflict) {
+		c.HTML(http.StatusConflict, "error.tmpl.html", gin.H{
+			"error":   "409 Conflict",
+			"message": "You already linked another " + p.Title() + " account, remove it first.",
+		})
+		return
+	} else if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	internal.SecurityAlert(c, f.UserId, "login_linked", p.Title())
+	c.Redirect(http.StatusFound, "/user/settings/logins")
+}
+
+// randomToken returns an unguessable URL-safe string.
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var usernameChars = regexp.MustCompile(`[^A-Za-z0-9._]`)
+
+// username turns a provider's display name into one our signup form would
+// accept, leaving room for a random suffix if it's taken.
+func username(identity *Identity) string {
+	name := usernameChars.ReplaceAllString(identity.Username, "")
+	if len(name) > 24 {
+		name = name[:24]
+	}
+	if name == "" {
+		name = "user"
+	}
+	return name
+}
+
+// getJSON decodes the JSON body of a GET request to url made with client.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
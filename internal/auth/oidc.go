@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// oidcProvider logs in with any OpenID Connect issuer, eg. a self-hosted
+// Keycloak realm, configured through the OIDC_* environment variables.
+type oidcProvider struct {
+	mu       sync.Mutex
+	metadata *oidcMetadata
+	fetched  time.Time
+	keys     *keySet
+}
+
+// oidcMetadata is the part of the issuer's discovery document we use.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discovery documents are refetched this often, so a change of endpoints
+// is picked up without a restart
+const discoveryTTL = time.Hour
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+func init() {
+	Register(&oidcProvider{})
+}
+
+func (*oidcProvider) Name() string { return "oidc" }
+func (*oidcProvider) Icon() string { return "fa-solid fa-key" }
+
+func (*oidcProvider) Title() string {
+	if name := os.Getenv("OIDC_NAME"); name != "" {
+		return name
+	}
+	return "SSO"
+}
+
+func (*oidcProvider) Enabled() bool {
+	return os.Getenv("OIDC_ISSUER") != "" && os.Getenv("OIDC_CLIENT_ID") != ""
+}
+
+// discover returns the issuer's metadata, fetching it if it's missing or
+// stale.
+func (p *oidcProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil && p.metadata.Issuer == issuer && time.Since(p.fetched) < discoveryTTL {
+		return p.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, oidcClient, url, &metadata); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: discovery: issuer %q doesn't match OIDC_ISSUER %q", metadata.Issuer, issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery: document is missing endpoints")
+	}
+	if p.keys == nil || p.keys.url != metadata.JWKSURI {
+		p.keys = &keySet{url: metadata.JWKSURI}
+	}
+	p.metadata, p.fetched = &metadata, time.Now()
+	return p.metadata, nil
+}
+
+func (p *oidcProvider) Config(ctx context.Context, redirectURL string) (*oauth2.Config, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthorizationEndpoint,
+			TokenURL: metadata.TokenEndpoint,
+		},
+	}, nil
+}
+
+// oidcClaims are the ID token and userinfo claims mapped onto a user.
+type oidcClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+
+	Email             string  `json:"email"`
+	EmailVerified     bool    `json:"email_verified"`
+	PreferredUsername string  `json:"preferred_username"`
+	Name              string  `json:"name"`
+	Picture           *string `json:"picture"`
+}
+
+// audience is the aud claim, which may be a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientId string) bool {
+	for _, aud := range a {
+		if aud == clientId {
+			return true
+		}
+	}
+	return false
+}
+
+// Tolerated clock difference between us and the issuer
+const clockSkew = time.Minute
+
+// Valid checks the token's lifetime, it's called by jwt.ParseWithClaims.
+func (c *oidcClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("oidc: id token expired")
+	}
+	if c.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("oidc: id token issued in the future")
+	}
+	return nil
+}
+
+// verify checks the ID token's signature against the issuer's keys and that
+// it was issued by the issuer, for us, in reply to the request with nonce.
+func (p *oidcProvider) verify(ctx context.Context, raw string, nonce string) (*oidcClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	var claims oidcClaims
+	if _, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (any, error) {
+		// Only asymmetric algorithms, so "none" and HMAC keyed with a
+		// public key can't be used to forge a token
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("oidc: unexpected signing algorithm %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	}); err != nil {
+		return nil, err
+	}
+
+	clientId := os.Getenv("OIDC_CLIENT_ID")
+	switch {
+	case claims.Issuer != metadata.Issuer:
+		return nil, fmt.Errorf("oidc: id token issued by %q", claims.Issuer)
+	case !claims.Audience.contains(clientId):
+		return nil, errors.New("oidc: id token not issued for this client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != clientId:
+		return nil, errors.New("oidc: id token authorized for another party")
+	case nonce == "" || claims.Nonce != nonce:
+		return nil, errors.New("oidc: id token nonce mismatch")
+	case claims.Subject == "":
+		return nil, errors.New("oidc: id token has no subject")
+	}
+	return &claims, nil
+}
+
+func (p *oidcProvider) Identity(ctx context.Context, grant Grant) (*Identity, error) {
+	raw, _ := grant.Token.Extra("id_token").(string)
+	if raw == "" {
+		return nil, errors.New("oidc: token response has no id token")
+	}
+	claims, err := p.verify(ctx, raw, grant.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some issuers keep profile claims out of the ID token
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Email == "" && metadata.UserinfoEndpoint != "" {
+		var info oidcClaims
+		if err := getJSON(ctx, grant.Client, metadata.UserinfoEndpoint, &info); err != nil {
+			return nil, err
+		}
+		if info.Subject != claims.Subject {
+			return nil, errors.New("oidc: userinfo is for another subject")
+		}
+		claims.Email, claims.EmailVerified = info.Email, info.EmailVerified
+		claims.PreferredUsername, claims.Name, claims.Picture = info.PreferredUsername, info.Name, info.Picture
+	}
+
+	identity := &Identity{
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Verified: claims.EmailVerified,
+		Username: claims.PreferredUsername,
+		Avatar:   claims.Picture,
+	}
+	if identity.Username == "" {
+		identity.Username = claims.Name
+	}
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	return identity, nil
+}
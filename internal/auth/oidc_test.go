@@ -0,0 +1,388 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+const testClientId = "socialecho"
+
+// testIssuer is an OpenID Connect issuer on an httptest.Server, with keys
+// that can be rotated.
+type testIssuer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu         sync.Mutex
+	keys       map[string]any // kid -> *rsa.PrivateKey or *ecdsa.PrivateKey
+	document   map[string]any // overrides of the discovery document
+	discovered int
+	jwksServed int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	issuer := &testIssuer{t: t, keys: map[string]any{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.serveDiscovery)
+	mux.HandleFunc("/jwks", issuer.serveJWKS)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"sub":                "alice-sub",
+			"email":              "alice@example.com",
+			"email_verified":     true,
+			"preferred_username": "alice",
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	t.Setenv("OIDC_ISSUER", issuer.URL)
+	t.Setenv("OIDC_CLIENT_ID", testClientId)
+	issuer.rotate("key-1")
+	return issuer
+}
+
+func (i *testIssuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.discovered++
+	document := map[string]any{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"userinfo_endpoint":      i.URL + "/userinfo",
+		"jwks_uri":               i.URL + "/jwks",
+	}
+	for key, value := range i.document {
+		document[key] = value
+	}
+	json.NewEncoder(w).Encode(document)
+}
+
+func (i *testIssuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.jwksServed++
+	encode := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+	keys := []map[string]string{
+		// Keys for other uses are skipped
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}
+	for kid, key := range i.keys {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig",
+				"n": encode(key.N), "e": encode(big.NewInt(int64(key.E))),
+			})
+		case *ecdsa.PrivateKey:
+			keys = append(keys, map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": encode(key.X), "y": encode(key.Y),
+			})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+// rotate replaces the issuer's keys with a new RSA key called kid.
+func (i *testIssuer) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys = map[string]any{kid: key}
+}
+
+// claims returns valid ID token claims for nonce, with changes.
+func (i *testIssuer) claims(nonce string, changes map[string]any) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   i.URL,
+		"sub":   "alice-sub",
+		"aud":   testClientId,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": nonce,
+		"email": "alice@example.com",
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+	}
+	return claims
+}
+
+// sign signs claims with the issuer's key kid.
+func (i *testIssuer) sign(kid string, claims jwt.MapClaims) string {
+	i.t.Helper()
+	i.mu.Lock()
+	key := i.keys[kid]
+	i.mu.Unlock()
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		i.t.Fatal(err)
+	}
+	return raw
+}
+
+func (i *testIssuer) counts() (int, int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.discovered, i.jwksServed
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := &oidcProvider{}
+	config, err := p.Config(context.Background(), "https://socialecho.example/auth/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Endpoint.AuthURL != issuer.URL+"/authorize" || config.Endpoint.TokenURL != issuer.URL+"/token" {
+		t.Errorf("endpoints %+v", config.Endpoint)
+	}
+	if config.ClientID != testClientId || !strings.Contains(strings.Join(config.Scopes, " "), "openid") {
+		t.Errorf("config %+v", config)
+	}
+
+	// The document is cached until it goes stale
+	if _, err := p.Config(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if discovered, _ := issuer.counts(); discovered != 1 {
+		t.Errorf("discovery fetched %d times, want 1", discovered)
+	}
+	p.fetched = time.Now().Add(-discoveryTTL)
+	if _, err := p.Config(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if discovered, _ := issuer.counts(); discovered != 2 {
+		t.Errorf("stale discovery fetched %d times, want 2", discovered)
+	}
+}
+
+func TestOIDCDiscoveryRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		document map[string]any
+		want     string
+	}{
+		{"other issuer", map[string]any{"issuer": "https://evil.example"}, "doesn't match"},
+		{"no jwks", map[string]any{"jwks_uri": ""}, "missing endpoints"},
+		{"no token endpoint", map[string]any{"token_endpoint": ""}, "missing endpoints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newTestIssuer(t)
+			issuer.document = tt.document
+			_, err := (&oidcProvider{}).Config(context.Background(), "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := &oidcProvider{}
+	claims, err := p.verify(context.Background(), issuer.sign("key-1", issuer.claims("n0nce", nil)), "n0nce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice-sub" || claims.Email != "alice@example.com" {
+		t.Errorf("claims %+v", claims)
+	}
+
+	// Several audiences are fine when we're the authorized party
+	raw := issuer.sign("key-1", issuer.claims("n0nce", map[string]any{
+		"aud": []string{"other", testClientId},
+		"azp": testClientId,
+	}))
+	if _, err := p.verify(context.Background(), raw, "n0nce"); err != nil {
+		t.Errorf("several audiences: %v", err)
+	}
+
+	// So are EC keys
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.mu.Lock()
+	issuer.keys["ec"] = ecKey
+	issuer.mu.Unlock()
+	p.keys.fetched = time.Now().Add(-keySetRefetch)
+	if _, err := p.verify(context.Background(), issuer.sign("ec", issuer.claims("n0nce", nil)), "n0nce"); err != nil {
+		t.Errorf("EC key: %v", err)
+	}
+}
+
+func TestOIDCVerifyRejects(t *testing.T) {
+	issuer := newTestIssuer(t)
+	hour := time.Hour.Seconds()
+	now := float64(time.Now().Unix())
+	tests := []struct {
+		name    string
+		changes map[string]any
+		nonce   string
+		want    string
+	}{
+		{"other issuer", map[string]any{"iss": "https://evil.example"}, "n0nce", "issued by"},
+		{"no issuer", map[string]any{"iss": nil}, "n0nce", "issued by"},
+		{"other audience", map[string]any{"aud": "other"}, "n0nce", "not issued for this client"},
+		{"several audiences without azp", map[string]any{"aud": []string{"other", testClientId}}, "n0nce", "another party"},
+		{"several audiences for another party", map[string]any{"aud": []string{"other", testClientId}, "azp": "other"}, "n0nce", "another party"},
+		{"other nonce", nil, "other", "nonce"},
+		{"no nonce sent", nil, "", "nonce"},
+		{"no nonce in token", map[string]any{"nonce": nil}, "n0nce", "nonce"},
+		{"expired", map[string]any{"exp": now - hour}, "n0nce", "expired"},
+		{"no expiry", map[string]any{"exp": nil}, "n0nce", "expired"},
+		{"issued in the future", map[string]any{"iat": now + hour}, "n0nce", "future"},
+		{"no subject", map[string]any{"sub": nil}, "n0nce", "no subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := issuer.sign("key-1", issuer.claims("n0nce", tt.changes))
+			claims, err := (&oidcProvider{}).verify(context.Background(), raw, tt.nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %+v, %v, want an error about %q", claims, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifyRejectsAlgorithms(t *testing.T) {
+	issuer := newTestIssuer(t)
+	claims := issuer.claims("n0nce", nil)
+
+	// HS256 keyed with the public key, what an attacker could get hold of
+	issuer.mu.Lock()
+	public := issuer.keys["key-1"].(*rsa.PrivateKey).N.Bytes()
+	issuer.mu.Unlock()
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = "key-1"
+	hs256, err := hmac.SignedString(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsigned.Header["kid"] = "key-1"
+	none, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed by a key that isn't the issuer's, under its key id
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	forged.Header["kid"] = "key-1"
+	wrongKey, err := forged.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"HS256", hs256, "unexpected signing algorithm HS256"},
+		{"none", none, "unexpected signing algorithm none"},
+		{"wrong key", wrongKey, "verification error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := (&oidcProvider{}).verify(context.Background(), tt.raw, "n0nce")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %+v, %v, want an error about %q", claims, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	issuer := newTestIssuer(t)
+	ctx := context.Background()
+	p := &oidcProvider{}
+	if _, err := p.verify(ctx, issuer.sign("key-1", issuer.claims("n0nce", nil)), "n0nce"); err != nil {
+		t.Fatal(err)
+	}
+	issuer.rotate("key-2")
+	rotated := issuer.sign("key-2", issuer.claims("n0nce", nil))
+
+	// Unknown key ids refetch the set at most once a minute, so tokens with
+	// made up ones can't hammer the issuer
+	if _, err := p.verify(ctx, rotated, "n0nce"); err == nil {
+		t.Fatal("accepted a key that wasn't fetched yet")
+	}
+	if _, served := issuer.counts(); served != 1 {
+		t.Fatalf("jwks fetched %d times within a minute, want 1", served)
+	}
+
+	p.keys.fetched = time.Now().Add(-keySetRefetch)
+	if _, err := p.verify(ctx, rotated, "n0nce"); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if _, served := issuer.counts(); served != 2 {
+		t.Errorf("jwks fetched %d times, want 2", served)
+	}
+	// The retired key is gone with the refetch
+	issuer.rotate("key-1")
+	if _, err := p.verify(ctx, issuer.sign("key-1", issuer.claims("n0nce", nil)), "n0nce"); err == nil {
+		t.Error("accepted a key the issuer retired")
+	}
+}
+
+func TestOIDCIdentity(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := &oidcProvider{}
+
+	// Without an email in the ID token the profile comes from userinfo
+	raw := issuer.sign("key-1", issuer.claims("n0nce", map[string]any{"email": nil}))
+	token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]any{"id_token": raw})
+	identity, err := p.Identity(context.Background(), Grant{Client: issuer.Client(), Token: token, Nonce: "n0nce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "alice-sub", Email: "alice@example.com", Verified: true, Username: "alice"}
+	if *identity != want {
+		t.Errorf("got %+v, want %+v", identity, want)
+	}
+
+	if _, err := p.Identity(context.Background(), Grant{Client: issuer.Client(), Token: &oauth2.Token{AccessToken: "access"}, Nonce: "n0nce"}); err == nil {
+		t.Error("accepted a token response without an id token")
+	}
+}
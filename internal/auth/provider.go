@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"golang.org/x/oauth2"
+)
+
+// Identity is a provider's account mapped to the fields we keep for a user.
+type Identity struct {
+	Subject  string // the provider's stable id for the account
+	Email    string
+	Verified bool
+	Username string
+	Avatar   *string
+}
+
+// Grant is what a provider's Identity gets to look up the account once the
+// user has authorized us.
+type Grant struct {
+	Client *http.Client // sends requests authorized with Token
+	Token  *oauth2.Token
+	Nonce  string // sent along with the authorization request
+}
+
+// Provider is an OAuth 2.0 identity provider users can sign up and log in
+// with. Adding one is a matter of implementing this and calling Register
+// from an init function.
+type Provider interface {
+	// Name is the provider's path segment in /auth/:provider
+	Name() string
+	// Title and Icon label the provider's button on the auth pages
+	Title() string
+	Icon() string
+	// Enabled reports whether the provider has been configured
+	Enabled() bool
+	// Config returns a fresh client config for redirectURL
+	Config(ctx context.Context, redirectURL string) (*oauth2.Config, error)
+	// Identity fetches the account the grant was issued for
+	Identity(ctx context.Context, grant Grant) (*Identity, error)
+}
+
+var providers = map[string]Provider{}
+
+// Register makes p available under /auth/<p.Name()>.
+func Register(p Provider) {
+	providers[p.Name()] = p
+}
+
+// Lookup returns the registered and configured provider called name.
+func Lookup(name string) (Provider, bool) {
+	p, ok := providers[name]
+	if !ok || !p.Enabled() {
+		return nil, false
+	}
+	return p, true
+}
+
+// Enabled lists the configured providers in name order.
+func Enabled() []Provider {
+	var enabled []Provider
+	for name := range providers {
+		if p, ok := Lookup(name); ok {
+			enabled = append(enabled, p)
+		}
+	}
+	sort.Slice(enabled, func(i, j int) bool {
+		return enabled[i].Name() < enabled[j].Name()
+	})
+	return enabled
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Geolocation headers added by CDNs and load balancers, city header first.
+// There is no GeoIP database to look addresses up in, so the location is
+// only known when the app runs behind one of these.
+var locationHeaders = [][2]string{
+	{"CF-IPCity", "CF-IPCountry"},                           // Cloudflare
+	{"CloudFront-Viewer-City", "CloudFront-Viewer-Country"}, // CloudFront
+	{"X-AppEngine-City", "X-AppEngine-Country"},             // Google App Engine
+}
+
+// Location returns where the request roughly came from, eg. "Lyon, FR",
+// or "" if that's unknown. The headers are only believed from a trusted
+// proxy.
+func Location(c *gin.Context) string {
+	if fromTrustedProxy(c) {
+		for _, headers := range locationHeaders {
+			city, country := c.GetHeader(headers[0]), strings.ToUpper(c.GetHeader(headers[1]))
+			// XX and ZZ are what the CDNs send for an unknown country
+			if country == "" || country == "XX" || country == "ZZ" {
+				continue
+			}
+			if city != "" && city != "?" {
+				return Truncate(city+", "+country, 128)
+			}
+			return Truncate(country, 128)
+		}
+	}
+	if ip := net.ParseIP(c.ClientIP()); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		return "Local network"
+	}
+	return ""
+}
+
+var (
+	browsers = [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems = [][2]string{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DescribeDevice turns a User-Agent into something like "Firefox on
+// Windows", falling back to the User-Agent itself.
+func DescribeDevice(userAgent string) string {
+	browser, system := match(userAgent, browsers), match(userAgent, systems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return "Browser on " + system
+	case userAgent == "":
+		return "Unknown device"
+	default:
+		return Truncate(userAgent, 60)
+	}
+}
+
+// match returns the name of the first pattern found in s.
+func match(s string, patterns [][2]string) string {
+	for _, pattern := range patterns {
+		if strings.Contains(s, pattern[0]) {
+			return pattern[1]
+		}
+	}
+	return ""
+}
+
+// Truncate cuts s to at most n bytes, without splitting a character.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorStatus maps an error from the database package to an HTTP status:
+// 404 for missing rows, 409 for unique-constraint conflicts, 400 for a bad
+// pagination cursor and 503 when the database itself failed.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+func errorMessage(status int, message string) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return "Invalid page cursor."
+	case status == http.StatusServiceUnavailable || message == "":
+		return "Service temporarily unavailable, try again later."
+	}
+	return message
+}
+
+// DatabaseError renders the error page for a failed database call. message is
+// shown for not-found and conflict errors; database outages get a generic
+// message instead so no internals leak to the user.
+func DatabaseError(c *gin.Context, err error, message string) {
+	if errors.Is(err, context.Canceled) {
+		// The client went away, nobody is left to render a page for
+		c.Abort()
+		return
+	}
+	status := ErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		log.Println(err)
+	}
+	c.HTML(status, "error.tmpl.html", gin.H{
+		"error":   fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		"message": errorMessage(status, message),
+	})
+	c.Abort()
+}
+
+// DatabaseErrorJSON is DatabaseError for the AJAX endpoints.
+func DatabaseErrorJSON(c *gin.Context, err error, message string) {
+	if errors.Is(err, context.Canceled) {
+		c.Abort()
+		return
+	}
+	status := ErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		log.Println(err)
+	}
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": errorMessage(status, message),
+	})
+}
+
+// ConflictMessage tells the user which field of a new account is taken.
+func ConflictMessage(err error) string {
+	switch {
+	case errors.Is(err, database.ErrUsernameTaken):
+		return "Username already taken."
+	case errors.Is(err, database.ErrEmailTaken):
+		return "An account already exists with this email."
+	default:
+		return "Username or email already taken."
+	}
+}
@@ -0,0 +1,186 @@
+// Package lockout slows down password and code guessing. Failed logins are
+// counted per IP and per account; past a few free tries each failure doubles
+// the wait before the next one, up to a lockout of maxWait.
+package lockout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+)
+
+// limit is how many failures are free, and the wait after the first one that
+// isn't.
+type limit struct {
+	free int
+	base time.Duration
+}
+
+var (
+	// An account is locked out after 10 failures in a row
+	accountLimit = limit{5, 30 * time.Second}
+	// Looser for IPs, which can be shared by a whole office
+	ipLimit = limit{20, 5 * time.Second}
+)
+
+const (
+	maxWait = 15 * time.Minute
+	// Failures are forgotten after a quiet day
+	window = 24 * time.Hour
+)
+
+func (l limit) wait(failures int) time.Duration {
+	if failures < l.free {
+		return 0
+	}
+	wait := l.base
+	for i := l.free; i < failures && wait < maxWait; i++ {
+		wait *= 2
+	}
+	return min(wait, maxWait)
+}
+
+// Account returns the throttle key of the account being logged in to. A
+// username that matches nobody gets one too, so it's throttled just the
+// same and guessing can't tell it apart from a real one. Its name is
+// hashed, the login form doesn't limit its length.
+func Account(userId string, username string) string {
+	if userId != "" {
+		return "user:" + userId
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(username)))
+	return "name:" + hex.EncodeToString(sum[:])
+}
+
+func ipKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// Attempt counts an attempt on account from this IP as failed before the
+// password or code is checked, so guesses sent all at once can't each be
+// checked before the others count. If it has to wait instead it returns how
+// long, and nothing is counted. Either Fail or Pass has to follow it.
+func Attempt(c *gin.Context, account string) (time.Duration, error) {
+	ctx := c.Request.Context()
+	var wait time.Duration
+	err := database.WithTx(ctx, func(tx database.Store) error {
+		accountWait, err := remaining(ctx, tx, account, accountLimit)
+		if err != nil {
+			return err
+		}
+		ipWait, err := remaining(ctx, tx, ipKey(c), ipLimit)
+		if err != nil {
+			return err
+		}
+		if wait = max(accountWait, ipWait); wait > 0 {
+			return nil
+		}
+		now := time.Now()
+		if _, err := tx.RecordLoginFailure(ctx, ipKey(c), now, now.Add(-window)); err != nil {
+			return err
+		}
+		_, err = tx.RecordLoginFailure(ctx, account, now, now.Add(-window))
+		return err
+	})
+	return wait, err
+}
+
+// remaining locks key's throttle until the end of tx and returns how long
+// it has to wait.
+func remaining(ctx context.Context, tx database.Store, key string, l limit) (time.Duration, error) {
+	throttle, err := tx.LockLoginThrottle(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if time.Since(throttle.LastFailureAt) > window {
+		return 0, nil
+	}
+	return max(time.Until(throttle.LastFailureAt.Add(l.wait(throttle.Failures))), 0), nil
+}
+
+// Fail records the event (eg. "login_failed") of an attempt that turned out
+// wrong in the audit log, Attempt already counted it. When it locks a real
+// account out its owner is mailed about it.
+func Fail(c *gin.Context, account string, userId string, username string, event string) error {
+	throttle, err := database.ReadLoginThrottle(c.Request.Context(), account)
+	if err != nil {
+		return err
+	}
+	Audit(c, userId, username, event)
+	failures := throttle.Failures
+	if userId != "" && accountLimit.wait(failures) == maxWait && accountLimit.wait(failures-1) < maxWait {
+		Audit(c, userId, username, "account_locked")
+		internal.SecurityAlert(c, userId, "account_locked", "")
+	}
+	return nil
+}
+
+// Pass takes back the failure Attempt counted on account from this IP, as
+// the attempt turned out right.
+func Pass(c *gin.Context, account string) error {
+	ctx := c.Request.Context()
+	if err := database.ForgiveLoginFailure(ctx, ipKey(c)); err != nil {
+		return err
+	}
+	return database.ForgiveLoginFailure(ctx, account)
+}
+
+// CheckPassword checks that password is user's current one before a
+// settings change, through Attempt like a login. It returns how long to
+// wait instead when there were too many wrong ones.
+func CheckPassword(c *gin.Context, user *models.User, password string) (bool, time.Duration, error) {
+	account := Account(user.Id, "")
+	if wait, err := Attempt(c, account); err != nil || wait > 0 {
+		return false, wait, err
+	}
+	if !user.CheckPassword(password) {
+		return false, 0, Fail(c, account, user.Id, user.Username, "password_check_failed")
+	}
+	return true, 0, Pass(c, account)
+}
+
+// Succeed forgets the failed attempts on userId's account, once they've
+// fully logged in.
+func Succeed(ctx context.Context, userId string) error {
+	return database.DeleteLoginThrottle(ctx, Account(userId, ""))
+}
+
+// Audit adds event to the audit log. Failures are only logged, the request
+// itself went through either way.
+func Audit(c *gin.Context, userId string, username string, event string) {
+	if err := database.CreateAuditEvent(c.Request.Context(), &models.AuditEvent{
+		UserId:    userId,
+		Event:     event,
+		Username:  internal.Truncate(username, 64),
+		IP:        c.ClientIP(),
+		UserAgent: internal.Truncate(c.Request.UserAgent(), 255),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		log.Println(err)
+	}
+}
+
+// Describe formats a wait for the error page, rounded up.
+func Describe(wait time.Duration) string {
+	if wait <= time.Minute {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		return plural(seconds, "second")
+	}
+	return plural(int((wait+time.Minute-1)/time.Minute), "minute")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,183 @@
+package lockout
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal/password"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Hashing at the real cost would slow down the password checks
+	if err := password.Configure(strconv.Itoa(bcrypt.MinCost), ""); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newContext is a request from ip, as a handler would get it.
+func newContext(ip string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/auth/login", nil)
+	c.Request.RemoteAddr = ip + ":40000"
+	return c
+}
+
+// failures returns how many failures are counted against key.
+func failures(t *testing.T, key string) int {
+	t.Helper()
+	throttle, err := database.ReadLoginThrottle(context.Background(), key)
+	if err != nil {
+		return 0
+	}
+	return throttle.Failures
+}
+
+func TestLimitWait(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{9, 8 * time.Minute},
+		{10, maxWait},
+		{100, maxWait},
+	}
+	for _, tt := range tests {
+		if got := accountLimit.wait(tt.failures); got != tt.want {
+			t.Errorf("wait after %d failures: %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestAccount(t *testing.T) {
+	if Account("", "Alice") != Account("", "alice") {
+		t.Error("unknown usernames aren't throttled case-insensitively")
+	}
+	if Account("", "alice") == Account("alice", "") {
+		t.Error("an unknown username shares a key with a user id")
+	}
+}
+
+func TestAttemptCountsUpFront(t *testing.T) {
+	database.Use(database.NewMemoryStore())
+	account := Account("alice-id", "")
+
+	// Guesses sent all at once each count before any is checked, so only
+	// the free ones get through
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 3*accountLimit.free; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := Attempt(newContext("192.0.2.1"), account)
+			if err != nil {
+				t.Error(err)
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != accountLimit.free {
+		t.Errorf("%d attempts got through, want %d", allowed, accountLimit.free)
+	}
+	// The ones turned away weren't counted
+	if got := failures(t, account); got != accountLimit.free {
+		t.Errorf("%d failures counted, want %d", got, accountLimit.free)
+	}
+	if wait, _ := Attempt(newContext("192.0.2.2"), account); wait <= 0 || wait > accountLimit.base {
+		t.Errorf("wait from another IP: %s, want up to %s", wait, accountLimit.base)
+	}
+}
+
+func TestAttemptPerIP(t *testing.T) {
+	database.Use(database.NewMemoryStore())
+	// Spread over accounts, so only the IP's limit applies
+	for i := 0; i < ipLimit.free; i++ {
+		if wait, err := Attempt(newContext("192.0.2.1"), Account("", string(rune('a'+i)))); err != nil || wait > 0 {
+			t.Fatalf("attempt %d: %s %v", i, wait, err)
+		}
+	}
+	if wait, _ := Attempt(newContext("192.0.2.1"), Account("", "zed")); wait <= 0 {
+		t.Error("IP past its limit wasn't made to wait")
+	}
+	if wait, _ := Attempt(newContext("192.0.2.2"), Account("", "zed")); wait != 0 {
+		t.Errorf("another IP had to wait %s", wait)
+	}
+}
+
+func TestPass(t *testing.T) {
+	database.Use(database.NewMemoryStore())
+	account := Account("alice-id", "")
+	c := newContext("192.0.2.1")
+	for i := 0; i < 3; i++ {
+		if _, err := Attempt(c, account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Pass(c, account); err != nil {
+		t.Fatal(err)
+	}
+	// Only the attempt that turned out right is taken back
+	if got := failures(t, account); got != 2 {
+		t.Errorf("account failures after a pass: %d, want 2", got)
+	}
+	if got := failures(t, ipKey(c)); got != 2 {
+		t.Errorf("IP failures after a pass: %d, want 2", got)
+	}
+	if err := Succeed(context.Background(), "alice-id"); err != nil {
+		t.Fatal(err)
+	}
+	if got := failures(t, account); got != 0 {
+		t.Errorf("account failures after logging in: %d, want 0", got)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	database.Use(database.NewMemoryStore())
+	user := &models.User{Id: "alice-id", Username: "alice", Password: "plum garage violin tundra", CreatedAt: time.Now()}
+	if err := user.HashPassword(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	c := newContext("192.0.2.1")
+	account := Account(user.Id, "")
+
+	if ok, wait, err := CheckPassword(c, user, "plum garage violin tundra"); !ok || wait != 0 || err != nil {
+		t.Fatalf("right password: %v %s %v", ok, wait, err)
+	}
+	if got := failures(t, account); got != 0 {
+		t.Errorf("right password counted as %d failures", got)
+	}
+	for i := 0; i < accountLimit.free; i++ {
+		if ok, _, err := CheckPassword(c, user, "wrong"); ok || err != nil {
+			t.Fatalf("wrong password: %v %v", ok, err)
+		}
+	}
+	// Past the free tries even the right password has to wait
+	if ok, wait, err := CheckPassword(c, user, "plum garage violin tundra"); ok || wait <= 0 || err != nil {
+		t.Errorf("right password after too many wrong ones: %v %s %v", ok, wait, err)
+	}
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// fileMailer writes every message as an .eml file to MAIL_DIR (default
+// "mail"), for development and tests.
+type fileMailer struct {
+	dir string
+	seq atomic.Int64
+}
+
+func newFile() (*fileMailer, error) {
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	raw, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102-150405"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.dir, name), raw, 0o600)
+}
+
+// logMailer prints messages to the log instead of sending them.
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s\n", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+// gmailMailer sends through the Gmail API as the EMAIL account, with the
+// OAuth credentials in CLIENT_ID, CLIENT_SECRET, TOKEN_URI, TOKEN,
+// REFRESH_TOKEN and EXPIRY.
+type gmailMailer struct {
+	tokens oauth2.TokenSource // refreshes the access token when it expires
+}
+
+func newGmail() *gmailMailer {
+	config := &oauth2.Config{
+		ClientID:     os.Getenv("CLIENT_ID"),
+		ClientSecret: os.Getenv("CLIENT_SECRET"),
+		Scopes:       []string{"https://mail.google.com/"},
+		Endpoint: oauth2.Endpoint{
+			TokenURL: os.Getenv("TOKEN_URI"),
+		},
+	}
+	expiry, _ := time.Parse(time.RFC3339, os.Getenv("EXPIRY"))
+	token := &oauth2.Token{
+		AccessToken:  os.Getenv("TOKEN"),
+		RefreshToken: os.Getenv("REFRESH_TOKEN"),
+		Expiry:       expiry,
+	}
+	return &gmailMailer{tokens: config.TokenSource(context.Background(), token)}
+}
+
+func (m *gmailMailer) Send(ctx context.Context, msg Message) error {
+	service, err := gmail.NewService(ctx, option.WithHTTPClient(oauth2.NewClient(ctx, m.tokens)))
+	if err != nil {
+		return err
+	}
+	raw, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+	_, err = service.Users.Messages.Send("me", &gmail.Message{
+		Raw: base64.RawURLEncoding.EncodeToString(raw),
+	}).Context(ctx).Do()
+	return err
+}
@@ -0,0 +1,60 @@
+// Package mail sends the app's emails through a configurable backend and
+// retries failed sends from a queue in the background. The queue is kept in
+// memory only: mail still waiting to be sent or retried when the process
+// stops is lost.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jordan-wright/email"
+)
+
+// Message is an email to a single recipient, with an HTML part and a plain
+// text alternative.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer delivers a message, or returns an error if it couldn't right now.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by MAIL_DRIVER: "gmail" (the default),
+// "smtp", "file" or "log".
+func New() (Mailer, error) {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "gmail":
+		return newGmail(), nil
+	case "smtp":
+		return newSMTP()
+	case "file":
+		return newFile()
+	case "log":
+		return logMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// bytes renders msg as a MIME message from the EMAIL address.
+func (msg Message) bytes() ([]byte, error) {
+	e := &email.Email{
+		To:      []string{msg.To},
+		From:    from(),
+		Subject: msg.Subject,
+		HTML:    []byte(msg.HTML),
+		Text:    []byte(msg.Text),
+	}
+	return e.Bytes()
+}
+
+func from() string {
+	return os.Getenv("EMAIL")
+}
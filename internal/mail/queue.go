@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrQueueFull is returned by Enqueue when too many messages are waiting.
+var ErrQueueFull = errors.New("mail: queue full")
+
+const (
+	queueSize   = 256
+	maxAttempts = 5
+	sendTimeout = 30 * time.Second
+)
+
+// Retries wait 30s, 1m, 2m, 4m. A var so tests don't have to wait that long.
+var firstRetry = 30 * time.Second
+
+type job struct {
+	msg      Message
+	attempts int
+}
+
+// Queue sends messages with a Mailer in the background and retries failed
+// sends with exponential backoff, so a mail server hiccup doesn't fail the
+// request that wanted to send mail. Nothing is persisted, a restart drops
+// the queued messages and the pending retries.
+type Queue struct {
+	mailer Mailer
+	jobs   chan job
+}
+
+// NewQueue starts a worker sending the queued messages with mailer.
+func NewQueue(mailer Mailer) *Queue {
+	q := &Queue{mailer: mailer, jobs: make(chan job, queueSize)}
+	go q.work()
+	return q
+}
+
+// Enqueue schedules msg to be sent.
+func (q *Queue) Enqueue(msg Message) error {
+	return q.push(job{msg: msg})
+}
+
+func (q *Queue) push(j job) error {
+	select {
+	case q.jobs <- j:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *Queue) work() {
+	for j := range q.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := q.mailer.Send(ctx, j.msg)
+		cancel()
+		if err == nil {
+			continue
+		}
+		j.attempts++
+		if j.attempts >= maxAttempts {
+			log.Printf("mail: giving up on %q to %s after %d attempts: %v\n", j.msg.Subject, j.msg.To, j.attempts, err)
+			continue
+		}
+		delay := firstRetry << (j.attempts - 1)
+		log.Printf("mail: sending %q to %s failed, retrying in %s: %v\n", j.msg.Subject, j.msg.To, delay, err)
+		time.AfterFunc(delay, func() {
+			if err := q.push(j); err != nil {
+				log.Printf("mail: dropped %q to %s: %v\n", j.msg.Subject, j.msg.To, err)
+			}
+		})
+	}
+}
+
+var queue *Queue
+
+// Open loads the email templates and starts the queue for the Mailer
+// picked by MAIL_DRIVER.
+func Open() error {
+	if err := LoadTemplates(); err != nil {
+		return err
+	}
+	mailer, err := New()
+	if err != nil {
+		return err
+	}
+	Use(mailer)
+	return nil
+}
+
+// Use sends queued mail with mailer instead, eg. a fake in tests.
+func Use(mailer Mailer) {
+	queue = NewQueue(mailer)
+}
+
+// Enqueue schedules msg on the queue started by Open.
+func Enqueue(msg Message) error {
+	if queue == nil {
+		return errors.New("mail: not configured")
+	}
+	return queue.Enqueue(msg)
+}
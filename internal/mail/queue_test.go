@@ -0,0 +1,144 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyMailer fails the first fails sends, then delivers to sent.
+type flakyMailer struct {
+	mu       sync.Mutex
+	fails    int
+	attempts int
+	sent     chan Message
+}
+
+func newFlakyMailer(fails int) *flakyMailer {
+	return &flakyMailer{fails: fails, sent: make(chan Message, 1)}
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.attempts <= m.fails {
+		return errors.New("mail server down")
+	}
+	m.sent <- msg
+	return nil
+}
+
+func (m *flakyMailer) tries() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts
+}
+
+// shortRetries makes the queue retry straight away for the test.
+func shortRetries(t *testing.T) {
+	t.Helper()
+	retry := firstRetry
+	firstRetry = time.Millisecond
+	t.Cleanup(func() { firstRetry = retry })
+}
+
+func TestQueueRetries(t *testing.T) {
+	shortRetries(t)
+	mailer := newFlakyMailer(maxAttempts - 1)
+	q := NewQueue(mailer)
+	if err := q.Enqueue(Message{To: "alice@example.com", Subject: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-mailer.sent:
+		if msg.To != "alice@example.com" {
+			t.Errorf("sent to %s", msg.To)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("not sent after %d attempts", mailer.tries())
+	}
+	if got := mailer.tries(); got != maxAttempts {
+		t.Errorf("sent on attempt %d, want %d", got, maxAttempts)
+	}
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	shortRetries(t)
+	mailer := newFlakyMailer(maxAttempts)
+	q := NewQueue(mailer)
+	if err := q.Enqueue(Message{To: "alice@example.com", Subject: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for mailer.tries() < maxAttempts && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// Long enough for another retry, if there was one
+	time.Sleep(50 * time.Millisecond)
+	if got := mailer.tries(); got != maxAttempts {
+		t.Errorf("tried %d times, want %d", got, maxAttempts)
+	}
+	select {
+	case <-mailer.sent:
+		t.Error("sent after giving up")
+	default:
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	// No worker, so nothing leaves the queue
+	q := &Queue{jobs: make(chan job, queueSize)}
+	for i := 0; i < queueSize; i++ {
+		if err := q.Enqueue(Message{}); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if err := q.Enqueue(Message{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("enqueue on a full queue: %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MAIL_DRIVER", "file")
+	t.Setenv("MAIL_DIR", dir)
+	t.Setenv("EMAIL", "noreply@example.com")
+	mailer, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.Send(context.Background(), Message{
+		To:      "alice@example.com",
+		Subject: "Welcome",
+		HTML:    "<p>Hello</p>",
+		Text:    "Hello",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files written: %v %v", files, err)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: <alice@example.com>", "From: <noreply@example.com>", "Subject: Welcome", "text/plain", "text/html", "<p>Hello</p>"} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("message has no %q:\n%s", want, raw)
+		}
+	}
+}
+
+func TestNewUnknownDriver(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "pigeon")
+	if _, err := New(); err == nil {
+		t.Error("an unknown MAIL_DRIVER was accepted")
+	}
+}
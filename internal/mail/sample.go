@@ -0,0 +1,40 @@
+package mail
+
+import "time"
+
+// samples fill in the templates for previews. Each email's data is listed
+// here, so a new template needs an entry too.
+var samples = map[string]map[string]any{
+	"verify": {
+		"Username": "tsuki",
+		"Email":    "tsuki@example.com",
+		"Link":     "https://socialecho.example/auth/verify/0b5d3c4e-sample",
+	},
+	"reset": {
+		"Username": "tsuki",
+		"Link":     "https://socialecho.example/auth/reset/sample-token",
+	},
+	"email_change": {
+		"Username": "tsuki",
+		"Email":    "tsuki@example.net",
+		"Link":     "https://socialecho.example/auth/email/sample-token",
+	},
+	"follower": {
+		"Username": "tsuki",
+		"Follower": "hoshi",
+		"Link":     "https://socialecho.example/user/hoshi",
+	},
+	"security": {
+		"Username": "tsuki",
+		"Event":    "password_changed",
+		"Method":   "GitHub",
+		"IP":       "203.0.113.7",
+		"Time":     time.Date(2024, time.March, 14, 9, 26, 0, 0, time.UTC),
+		"Link":     "https://socialecho.example/user/settings/logins",
+	},
+}
+
+// Sample returns the preview data for the email called name.
+func Sample(name string) map[string]any {
+	return samples[name]
+}
@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+// smtpMailer sends through an SMTP server configured by the SMTP_*
+// environment variables.
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	security string // "starttls", "tls" or "none"
+}
+
+func newSMTP() (*smtpMailer, error) {
+	m := &smtpMailer{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     os.Getenv("SMTP_PORT"),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		security: os.Getenv("SMTP_SECURITY"),
+	}
+	if m.host == "" {
+		return nil, errors.New("SMTP_HOST is required with MAIL_DRIVER=smtp")
+	}
+	if m.security == "" {
+		m.security = "starttls"
+	}
+	if m.port == "" {
+		m.port = "587"
+		if m.security == "tls" {
+			m.port = "465"
+		}
+	}
+	switch m.security {
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown SMTP_SECURITY %q", m.security)
+	}
+	return m, nil
+}
+
+func (m *smtpMailer) dial(ctx context.Context) (net.Conn, error) {
+	address := net.JoinHostPort(m.host, m.port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if m.security == "tls" {
+		return (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.host}}).DialContext(ctx, "tcp", address)
+	}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	raw, err := msg.bytes()
+	if err != nil {
+		return err
+	}
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	// Don't let a stalled server hold on to the queue worker
+	deadline := time.Now().Add(time.Minute)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.security == "starttls" {
+		// Refuse to go on in plain text, the credentials would leak
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp: %s doesn't support STARTTLS", m.host)
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from()); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,179 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+// Emails are loaded from templateDir/<locale>/. Every email <name> has a
+// <name>.html and a <name>.txt, which fill in the "content" block of the
+// locale's layout.html and layout.txt; the text file also defines the
+// "subject". A locale only needs the files it translates, everything else
+// comes from the default locale.
+const (
+	templateDir   = "templates/email"
+	defaultLocale = "en"
+)
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var (
+	templates map[string]map[string]*emailTemplate // locale -> name
+	matcher   language.Matcher
+	locales   []string // defaultLocale first
+)
+
+// LoadTemplates parses every email template, so a broken one stops the app
+// at boot rather than when the mail is sent.
+func LoadTemplates() error {
+	entries, err := os.ReadDir(templateDir)
+	if err != nil {
+		return err
+	}
+	found := []string{defaultLocale}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != defaultLocale {
+			found = append(found, entry.Name())
+		}
+	}
+
+	names, err := emailNames(filepath.Join(templateDir, defaultLocale))
+	if err != nil {
+		return err
+	}
+	loaded := map[string]map[string]*emailTemplate{}
+	for _, locale := range found {
+		loaded[locale] = map[string]*emailTemplate{}
+		for _, name := range names {
+			t, err := parseEmail(locale, name)
+			if err != nil {
+				return err
+			}
+			loaded[locale][name] = t
+		}
+	}
+
+	tags := make([]language.Tag, len(found))
+	for i, locale := range found {
+		if tags[i], err = language.Parse(locale); err != nil {
+			return fmt.Errorf("mail: locale directory %q: %w", locale, err)
+		}
+	}
+	templates, locales, matcher = loaded, found, language.NewMatcher(tags)
+	return nil
+}
+
+// emailNames lists the emails in dir, ie. its .html files but the layout.
+func emailNames(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if name := strings.TrimSuffix(filepath.Base(file), ".html"); name != "layout" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// localized returns the locale's variant of file if there is one, or the
+// default locale's.
+func localized(locale string, file string) string {
+	path := filepath.Join(templateDir, locale, file)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return filepath.Join(templateDir, defaultLocale, file)
+}
+
+func parseEmail(locale string, name string) (*emailTemplate, error) {
+	html, err := htmltemplate.ParseFiles(localized(locale, "layout.html"), localized(locale, name+".html"))
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.ParseFiles(localized(locale, "layout.txt"), localized(locale, name+".txt"))
+	if err != nil {
+		return nil, err
+	}
+	if text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("mail: %s/%s.txt doesn't define a subject", locale, name)
+	}
+	return &emailTemplate{html: html, text: text}, nil
+}
+
+// Locale picks the supported locale closest to an Accept-Language header.
+func Locale(acceptLanguage string) string {
+	if matcher == nil {
+		return defaultLocale
+	}
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return defaultLocale
+	}
+	return locales[index]
+}
+
+// Locales lists the locales there are templates for, default first.
+func Locales() []string {
+	return locales
+}
+
+// Names lists the emails there are templates for.
+func Names() []string {
+	var names []string
+	for name := range templates[defaultLocale] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Compose renders the email called name in locale with data.
+func Compose(to string, locale string, name string, data any) (Message, error) {
+	t, ok := templates[locale][name]
+	if !ok {
+		if t, ok = templates[defaultLocale][name]; !ok {
+			return Message{}, fmt.Errorf("mail: no template %q", name)
+		}
+	}
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.ExecuteTemplate(&text, "layout", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+// Send composes the email called name and queues it.
+func Send(to string, locale string, name string, data any) error {
+	msg, err := Compose(to, locale, name, data)
+	if err != nil {
+		return err
+	}
+	return Enqueue(msg)
+}
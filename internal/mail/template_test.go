@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The templates are found from the repository root
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	if err := LoadTemplates(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestEveryEmailRenders(t *testing.T) {
+	if len(Names()) == 0 {
+		t.Fatal("no emails loaded")
+	}
+	for _, locale := range Locales() {
+		for _, name := range Names() {
+			t.Run(locale+"/"+name, func(t *testing.T) {
+				data := Sample(name)
+				if data == nil {
+					t.Fatal("no sample data")
+				}
+				msg, err := Compose("tsuki@example.com", locale, name, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.To != "tsuki@example.com" || msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+					t.Errorf("to %q, subject %q", msg.To, msg.Subject)
+				}
+				// Both parts have the link, and nothing the template
+				// didn't fill in
+				for part, body := range map[string]string{"html": msg.HTML, "text": msg.Text} {
+					if !strings.Contains(body, data["Link"].(string)) {
+						t.Errorf("%s part has no link:\n%s", part, body)
+					}
+					if strings.Contains(body, "<no value>") {
+						t.Errorf("%s part has a missing value:\n%s", part, body)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestComposeLocales(t *testing.T) {
+	en, err := Compose("a@example.com", "en", "reset", Sample("reset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := Compose("a@example.com", "es", "reset", Sample("reset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if en.Subject == es.Subject {
+		t.Errorf("es subject %q is the en one", es.Subject)
+	}
+	// An unknown locale gets the default one
+	other, err := Compose("a@example.com", "fr", "reset", Sample("reset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Subject != en.Subject {
+		t.Errorf("fr subject %q, want the en %q", other.Subject, en.Subject)
+	}
+	if _, err := Compose("a@example.com", "en", "nonexistent", nil); err == nil {
+		t.Error("composed an email with no template")
+	}
+}
+
+func TestComposeEscapesHTML(t *testing.T) {
+	data := map[string]any{}
+	for k, v := range Sample("follower") {
+		data[k] = v
+	}
+	data["Follower"] = "<script>x</script>"
+	msg, err := Compose("a@example.com", "en", "follower", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") || !strings.Contains(msg.HTML, "&lt;script&gt;") {
+		t.Errorf("follower name isn't escaped in:\n%s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "<script>x</script>") {
+		t.Errorf("text part changed the name:\n%s", msg.Text)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	tests := map[string]string{
+		"":                        "en",
+		"es":                      "es",
+		"es-MX,es;q=0.9,en;q=0.8": "es",
+		"en-GB,en;q=0.9":          "en",
+		"fr-FR,fr;q=0.9":          "en",
+		"fr;q=0.9,es;q=0.5":       "es",
+		"not a header":            "en",
+	}
+	for header, want := range tests {
+		if got := Locale(header); got != want {
+			t.Errorf("Locale(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Package passkey runs the WebAuthn registration and login ceremonies for
+// passkeys, keeping the challenge in the session between the two requests
+// of each.
+package passkey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	displayName = "SocialEcho"
+	ceremonyKey = "webauthn"
+	// How long the browser has to answer a challenge
+	ceremonyTTL = 5 * time.Minute
+)
+
+// What a ceremony was started for, so a response can't be used for another
+const (
+	Register     = "register"
+	Login        = "login"      // passwordless, on the login page
+	SecondFactor = "two_factor" // after the password, instead of a code
+)
+
+// ErrInvalidPasskey is returned when the browser's response doesn't check
+// out, or the ceremony it answers expired.
+var ErrInvalidPasskey = errors.New("invalid passkey")
+
+// ceremony is a registration or login in progress.
+type ceremony struct {
+	Purpose string
+	UserId  string // "" for a passwordless login, the user isn't known yet
+	Name    string // of the passkey being registered
+	Expires int64
+	Data    webauthn.SessionData
+}
+
+// user adapts a user and their passkeys to webauthn.User. The user handle
+// stored on authenticators is the user id.
+type user struct {
+	*models.User
+	credentials []models.Credential
+}
+
+func (u *user) WebAuthnID() []byte {
+	return []byte(u.Id)
+}
+
+func (u *user) WebAuthnName() string {
+	return u.Username
+}
+
+func (u *user) WebAuthnDisplayName() string {
+	return u.Username
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for j, t := range c.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+		credentials[i] = webauthn.Credential{
+			ID:              c.Id,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+func loadUser(ctx context.Context, userId string) (*user, error) {
+	found, err := database.ReadUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := database.ReadCredentials(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &user{found, credentials}, nil
+}
+
+// relyingParty is this site as authenticators see it. Passkeys are bound to
+// its host name, so they stop working if the site moves to another domain.
+func relyingParty(c *gin.Context) (*webauthn.WebAuthn, error) {
+	base := internal.BaseURL(c)
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: displayName,
+		RPOrigins:     []string{base},
+	})
+}
+
+func save(c *gin.Context, purpose string, userId string, name string, data *webauthn.SessionData) error {
+	b, err := json.Marshal(ceremony{
+		Purpose: purpose,
+		UserId:  userId,
+		Name:    name,
+		Expires: time.Now().Add(ceremonyTTL).Unix(),
+		Data:    *data,
+	})
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set(ceremonyKey, string(b))
+	return session.Save()
+}
+
+// take removes the ceremony from the session and returns it if it was
+// started for purpose by userId and hasn't expired. A challenge can only be
+// answered once.
+func take(c *gin.Context, purpose string, userId string) (*ceremony, bool) {
+	session := sessions.Default(c)
+	data, _ := session.Get(ceremonyKey).(string)
+	session.Delete(ceremonyKey)
+	session.Save()
+
+	var cer ceremony
+	if data == "" || json.Unmarshal([]byte(data), &cer) != nil {
+		return nil, false
+	}
+	if cer.Purpose != purpose || cer.UserId != userId || time.Now().Unix() > cer.Expires {
+		return nil, false
+	}
+	return &cer, true
+}
+
+// BeginRegistration returns the options for navigator.credentials.create()
+// to add a passkey called name to userId's account.
+func BeginRegistration(c *gin.Context, userId string, name string) (*protocol.CredentialCreation, error) {
+	u, err := loadUser(c.Request.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+	rp, err := relyingParty(c)
+	if err != nil {
+		return nil, err
+	}
+	// A discoverable credential is what lets the user log in without typing
+	// their username
+	creation, data, err := rp.BeginRegistration(u,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(u.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := save(c, Register, userId, name, data); err != nil {
+		return nil, err
+	}
+	return creation, nil
+}
+
+// FinishRegistration checks the new credential in the request body and
+// saves it as a passkey of userId.
+func FinishRegistration(c *gin.Context, userId string) (*models.Credential, error) {
+	cer, ok := take(c, Register, userId)
+	if !ok {
+		return nil, ErrInvalidPasskey
+	}
+	u, err := loadUser(c.Request.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+	rp, err := relyingParty(c)
+	if err != nil {
+		return nil, err
+	}
+	created, err := rp.FinishRegistration(u, cer.Data, c.Request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	transports := make([]string, len(created.Transport))
+	for i, t := range created.Transport {
+		transports[i] = string(t)
+	}
+	credential := &models.Credential{
+		Id:              created.ID,
+		UserId:          userId,
+		Name:            cer.Name,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		Transports:      transports,
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       created.Authenticator.SignCount,
+		BackupEligible:  created.Flags.BackupEligible,
+		BackupState:     created.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+	if err := database.CreateCredential(c.Request.Context(), credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get(). With no
+// userId any passkey for this site will do, and the authenticator has to
+// verify the user (PIN, fingerprint...) since it's the only factor.
+func BeginLogin(c *gin.Context, purpose string, userId string) (*protocol.CredentialAssertion, error) {
+	rp, err := relyingParty(c)
+	if err != nil {
+		return nil, err
+	}
+	var assertion *protocol.CredentialAssertion
+	var data *webauthn.SessionData
+	if userId == "" {
+		assertion, data, err = rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		var u *user
+		if u, err = loadUser(c.Request.Context(), userId); err != nil {
+			return nil, err
+		}
+		if len(u.credentials) == 0 {
+			return nil, ErrInvalidPasskey
+		}
+		assertion, data, err = rp.BeginLogin(u)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := save(c, purpose, userId, "", data); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishLogin checks the assertion in the request body and returns the id
+// of the user whose passkey signed it.
+func FinishLogin(c *gin.Context, purpose string, userId string) (string, error) {
+	cer, ok := take(c, purpose, userId)
+	if !ok {
+		return "", ErrInvalidPasskey
+	}
+	ctx := c.Request.Context()
+	rp, err := relyingParty(c)
+	if err != nil {
+		return "", err
+	}
+	var u *user
+	var credential *webauthn.Credential
+	if userId == "" {
+		credential, err = rp.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			u, err = loadUser(ctx, string(userHandle))
+			return u, err
+		}, cer.Data, c.Request)
+	} else {
+		if u, err = loadUser(ctx, userId); err != nil {
+			return "", err
+		}
+		credential, err = rp.FinishLogin(u, cer.Data, c.Request)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	// The counter went backwards: someone may have copied the key
+	if credential.Authenticator.CloneWarning {
+		return "", fmt.Errorf("%w: sign count did not increase", ErrInvalidPasskey)
+	}
+	err = database.UseCredential(ctx, credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState, time.Now())
+	if errors.Is(err, database.ErrNotFound) {
+		return "", ErrInvalidPasskey
+	}
+	if err != nil {
+		return "", err
+	}
+	return u.Id, nil
+}
@@ -0,0 +1,52 @@
+//go:build ignore
+
+// gen.go turns a list of passwords, one per line, into breached.txt:
+//
+//	go run gen.go < passwords.txt > breached.txt
+//
+// Lines that already are SHA-1 hashes, like those of a Pwned Passwords
+// download ("HASH:COUNT"), are kept as they are.
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+func main() {
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha1.Size {
+			sum := sha1.Sum([]byte(line))
+			hash = hex.EncodeToString(sum[:])
+		}
+		seen[strings.ToUpper(hash)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	hashes := make([]string, 0, len(seen))
+	for hash := range seen {
+		hashes = append(hashes, hash)
+	}
+	slices.Sort(hashes)
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	fmt.Fprintln(w, "# SHA-1 hashes of common and leaked passwords, made with gen.go")
+	for _, hash := range hashes {
+		fmt.Fprintf(w, "%s:%s\n", hash[:5], hash[5:])
+	}
+}
@@ -0,0 +1,156 @@
+// Package password decides which passwords are good enough: long enough,
+// hard to guess by zxcvbn's estimate, and not on a list of common and
+// breached passwords. It also sets the bcrypt cost they're hashed with.
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/ccojocar/zxcvbn-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinLength = 10
+	// bcrypt ignores anything after this many bytes
+	MaxBytes = 72
+	// zxcvbn score out of 4
+	minScore = 3
+)
+
+var (
+	ErrTooShort = errors.New("password too short")
+	ErrTooLong  = errors.New("password too long")
+	ErrBreached = errors.New("password breached")
+	ErrWeak     = errors.New("password too weak")
+)
+
+// breached.txt holds the SHA-1 hashes of common and leaked passwords, in the
+// format of the Pwned Passwords range API: the first five hex digits, a
+// colon and the rest. Make it with gen.go.
+//
+//go:embed breached.txt
+var bundled []byte
+
+// breached is sorted, for binary search
+var breached [][sha1.Size]byte
+
+func init() {
+	list, err := parseList(bytes.NewReader(bundled))
+	if err != nil {
+		panic(err)
+	}
+	breached = list
+}
+
+// Configure sets the bcrypt cost for new hashes (empty for the default),
+// and replaces the bundled list of breached passwords with the one at path,
+// if given.
+func Configure(cost string, path string) error {
+	if cost != "" {
+		n, err := strconv.Atoi(cost)
+		if err != nil || n < bcrypt.MinCost || n > bcrypt.MaxCost {
+			return fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		models.PasswordCost = n
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		list, err := parseList(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		breached = list
+	}
+	return nil
+}
+
+func parseList(r io.Reader) ([][sha1.Size]byte, error) {
+	var list [][sha1.Size]byte
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// Counts after a second colon, as in Pwned Passwords downloads, are
+		// ignored
+		prefix, suffix, _ := strings.Cut(text, ":")
+		suffix, _, _ = strings.Cut(suffix, ":")
+		var hash [sha1.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(prefix+suffix)); err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		list = append(list, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(list, func(a, b [sha1.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return list, nil
+}
+
+// Breached reports whether password is on the list.
+func Breached(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	_, found := slices.BinarySearchFunc(breached, hash, func(a, b [sha1.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return found
+}
+
+// Check returns why password can't be used, or nil if it can. userInputs
+// are things an attacker would try first, like the username and email.
+func Check(password string, userInputs ...string) error {
+	switch {
+	case utf8.RuneCountInString(password) < MinLength:
+		return ErrTooShort
+	case len(password) > MaxBytes:
+		return ErrTooLong
+	case Breached(password):
+		return ErrBreached
+	}
+	var inputs []string
+	for _, input := range userInputs {
+		if input != "" {
+			inputs = append(inputs, strings.ToLower(input))
+		}
+	}
+	if zxcvbn.PasswordStrength(password, inputs).Score < minScore {
+		return ErrWeak
+	}
+	return nil
+}
+
+// Message tells the user what's wrong with their password.
+func Message(err error) string {
+	switch {
+	case errors.Is(err, ErrTooShort):
+		return fmt.Sprintf("Password must be at least %d characters.", MinLength)
+	case errors.Is(err, ErrTooLong):
+		return fmt.Sprintf("Password can't be longer than %d bytes.", MaxBytes)
+	case errors.Is(err, ErrBreached):
+		return "This password is on a list of common or leaked passwords, choose another one."
+	default:
+		return "This password is too easy to guess, make it longer or use a few unrelated words."
+	}
+}
@@ -0,0 +1,94 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		want     error
+	}{
+		{"plum garage violin tundra", nil, nil},
+		{"Tr0ub4dor&3x", nil, nil},
+		{"short1!", nil, ErrTooShort},
+		// Characters are counted, not bytes
+		{"ñandú ñandú", nil, nil},
+		{"ñandúñand", nil, ErrTooShort},
+		{strings.Repeat("plum garage violin tundra ", 3), nil, ErrTooLong},
+		{"password123", nil, ErrBreached},
+		{"qwertyuiop", nil, ErrBreached},
+		{"abcdefghijkl", nil, ErrWeak},
+		{"aaaaaaaaaaaa", nil, ErrWeak},
+		// Fine on its own, but not for the account it's made up from
+		{"tsuki@example.com!", nil, nil},
+		{"tsuki@example.com!", []string{"tsuki", "tsuki@example.com"}, ErrWeak},
+	}
+	for _, tt := range tests {
+		if got := Check(tt.password, tt.inputs...); !errors.Is(got, tt.want) {
+			t.Errorf("Check(%q, %q) = %v, want %v", tt.password, tt.inputs, got, tt.want)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	seen := map[string]bool{}
+	for _, err := range []error{ErrTooShort, ErrTooLong, ErrBreached, ErrWeak} {
+		message := Message(err)
+		if message == "" || seen[message] {
+			t.Errorf("%v: message %q", err, message)
+		}
+		seen[message] = true
+	}
+}
+
+func TestConfigureList(t *testing.T) {
+	defer func(list [][sha1.Size]byte) { breached = list }(breached)
+
+	hash := sha1.Sum([]byte("plum garage violin tundra"))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	// In the Pwned Passwords format, with a count after the hash
+	list := "# custom list\n" + hexHash[:5] + ":" + hexHash[5:] + ":42\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure("", path); err != nil {
+		t.Fatal(err)
+	}
+	if !Breached("plum garage violin tundra") {
+		t.Error("password on the configured list isn't breached")
+	}
+	// The list replaces the bundled one
+	if Breached("password123") {
+		t.Error("bundled list still used")
+	}
+
+	if err := os.WriteFile(path, []byte("not a hash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure("", path); err == nil {
+		t.Error("a malformed list was accepted")
+	}
+}
+
+func TestConfigureCost(t *testing.T) {
+	defer func(cost int) { models.PasswordCost = cost }(models.PasswordCost)
+	if err := Configure("11", ""); err != nil || models.PasswordCost != 11 {
+		t.Errorf("cost 11: %v, cost is %d", err, models.PasswordCost)
+	}
+	for _, cost := range []string{"3", "32", "high"} {
+		if err := Configure(cost, ""); err == nil {
+			t.Errorf("cost %q accepted", cost)
+		}
+	}
+}
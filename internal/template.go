@@ -1,10 +1,14 @@
 package internal
 
 import (
+	"maps"
 	"math/rand"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
@@ -29,3 +33,58 @@ func FormatAsTitle(title string) string {
 func FormatAsDate(createdAt time.Time) string {
 	return createdAt.Format(time.RFC822)
 }
+
+// pageWriter carries data for the layout of the page a request renders, set
+// by middleware before the handler runs.
+type pageWriter struct {
+	gin.ResponseWriter
+	data gin.H
+}
+
+// SetPageData makes value available to the templates of this request's
+// page as .key, next to what the handler passes (eg. the banner in
+// base.tmpl.html). The handler's own data wins.
+func SetPageData(c *gin.Context, key string, value any) {
+	w, ok := c.Writer.(*pageWriter)
+	if !ok {
+		w = &pageWriter{c.Writer, gin.H{}}
+		c.Writer = w
+	}
+	w.data[key] = value
+}
+
+// PageRender wraps the app's HTML renderer to add the data of SetPageData
+// to every page.
+type PageRender struct {
+	render.HTMLRender
+}
+
+func (p PageRender) Instance(name string, data any) render.Render {
+	return pageHTML{p.HTMLRender.Instance(name, data)}
+}
+
+type pageHTML struct {
+	instance render.Render
+}
+
+func (r pageHTML) WriteContentType(w http.ResponseWriter) {
+	r.instance.WriteContentType(w)
+}
+
+func (r pageHTML) Render(w http.ResponseWriter) error {
+	page, ok := w.(*pageWriter)
+	html, isHTML := r.instance.(render.HTML)
+	if !ok || !isHTML {
+		return r.instance.Render(w)
+	}
+	data := maps.Clone(page.data)
+	switch handlerData := html.Data.(type) {
+	case gin.H:
+		maps.Copy(data, handlerData)
+	case nil:
+	default:
+		return r.instance.Render(w)
+	}
+	html.Data = data
+	return html.Render(w)
+}
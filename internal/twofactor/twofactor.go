@@ -0,0 +1,155 @@
+// Package twofactor checks the time-based one-time passwords (RFC 6238) of
+// authenticator apps, and the recovery codes that stand in for them.
+package twofactor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	issuer = "SocialEcho"
+	period = 30
+	// Codes from one step either side of now are accepted, for clock drift
+	skew          = 1
+	recoveryCodes = 10
+)
+
+// ErrInvalidCode is returned for a wrong code, or one that was already used.
+var ErrInvalidCode = errors.New("invalid code")
+
+// NewSecret returns a random base32 secret for an authenticator.
+func NewSecret() (string, error) {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: issuer, AccountName: issuer})
+	if err != nil {
+		return "", err
+	}
+	return key.Secret(), nil
+}
+
+// URI returns the otpauth:// URI authenticator apps read from a QR code.
+func URI(secret string, account string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {"6"},
+		"period":    {"30"},
+	}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
+
+// QRCode renders uri as a PNG data URI, for an <img> tag.
+func QRCode(uri string) (string, error) {
+	key, err := otp.NewKeyFromURL(uri)
+	if err != nil {
+		return "", err
+	}
+	image, err := key.Image(240, 240)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, image); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+// Check returns the time step code is valid for at now.
+func Check(secret string, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != 6 {
+		return 0, false
+	}
+	step := now.Unix() / period
+	for offset := int64(-skew); offset <= skew; offset++ {
+		expected, err := hotp.GenerateCodeCustom(secret, uint64(step+offset), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step + offset, true
+		}
+	}
+	return 0, false
+}
+
+// Verify checks a code from userId's authenticator, or one of their recovery
+// codes, and uses it up.
+func Verify(ctx context.Context, userId string, code string) error {
+	twoFactor, err := database.ReadTwoFactor(ctx, userId)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	if !twoFactor.Enabled() {
+		return ErrInvalidCode
+	}
+	if step, ok := Check(twoFactor.Secret, code, time.Now()); ok {
+		err = database.UseTwoFactorStep(ctx, userId, step)
+	} else {
+		err = database.UseRecoveryCode(ctx, userId, HashRecoveryCode(code))
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrInvalidCode
+	}
+	return err
+}
+
+// Enabled reports whether userId has to give a code to log in.
+func Enabled(ctx context.Context, userId string) (bool, error) {
+	twoFactor, err := database.ReadTwoFactor(ctx, userId)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.Enabled(), nil
+}
+
+// NewRecoveryCodes replaces userId's recovery codes and returns the new
+// ones, which are only kept as hashes.
+func NewRecoveryCodes(ctx context.Context, userId string) ([]string, error) {
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:]
+		hashes[i] = HashRecoveryCode(code)
+	}
+	if err := database.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode hashes a recovery code however it was typed in.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
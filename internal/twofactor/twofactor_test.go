@@ -0,0 +1,148 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+// codeAt is what an authenticator shows for secret in time step.
+func codeAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := hotp.GenerateCodeCustom(secret, uint64(step), hotp.ValidateOpts{
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enable turns two-factor authentication on for a new user on a new
+// in-memory store, returning its secret.
+func enable(t *testing.T, userId string) string {
+	t.Helper()
+	ctx := context.Background()
+	database.Use(database.NewMemoryStore())
+	if err := database.CreateUser(ctx, &models.User{Id: userId, Username: userId, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := database.CreateTwoFactor(ctx, &models.TwoFactor{UserId: userId, Secret: secret, EnabledAt: now, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestCheck(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	step := now.Unix() / period
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := codeAt(t, secret, step+offset)
+		got, ok := Check(secret, code[:3]+" "+code[3:], now)
+		if want := offset >= -skew && offset <= skew; ok != want {
+			t.Errorf("code %d steps away accepted: %v, want %v", offset, ok, want)
+		} else if ok && got != step+offset {
+			t.Errorf("code %d steps away is for step %d, want %d", offset, got, step+offset)
+		}
+	}
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Check(secret, code, now); ok {
+			t.Errorf("%q accepted", code)
+		}
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	ctx := context.Background()
+	secret := enable(t, "alice")
+	step := time.Now().Unix() / period
+
+	if err := Verify(ctx, "alice", codeAt(t, secret, step)); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	// The same code again, eg. seen over the user's shoulder
+	if err := Verify(ctx, "alice", codeAt(t, secret, step)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("replayed code: %v, want %v", err, ErrInvalidCode)
+	}
+	// An older code that's still in the window
+	if err := Verify(ctx, "alice", codeAt(t, secret, step-1)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("code older than the last used: %v, want %v", err, ErrInvalidCode)
+	}
+	// A newer one still works
+	if err := Verify(ctx, "alice", codeAt(t, secret, step+1)); err != nil {
+		t.Errorf("next code: %v", err)
+	}
+}
+
+func TestVerifyRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	enable(t, "alice")
+	codes, err := NewRecoveryCodes(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodes {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodes)
+	}
+
+	// However it's typed in, a code works once
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if err := Verify(ctx, "alice", typed); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if err := Verify(ctx, "alice", codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("used recovery code: %v, want %v", err, ErrInvalidCode)
+	}
+	// New codes replace the old ones
+	if _, err := NewRecoveryCodes(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ctx, "alice", codes[1]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("replaced recovery code: %v, want %v", err, ErrInvalidCode)
+	}
+}
+
+func TestVerifyWithoutTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	secret := enable(t, "alice")
+	if err := Verify(ctx, "bob", codeAt(t, secret, time.Now().Unix()/period)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("user without two-factor: %v, want %v", err, ErrInvalidCode)
+	}
+	if enabled, err := Enabled(ctx, "bob"); err != nil || enabled {
+		t.Errorf("Enabled for a user without two-factor: %v %v", enabled, err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := otp.NewKeyFromURL(URI(secret, "alice@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Secret() != secret || key.Issuer() != issuer || key.AccountName() != "alice@example.com" || key.Period() != period {
+		t.Errorf("key %s", key)
+	}
+	if image, err := QRCode(key.String()); err != nil || !strings.HasPrefix(image, "data:image/png;base64,") {
+		t.Errorf("QR code %.40q %v", image, err)
+	}
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publicURL is the app's external base URL, eg. https://socialecho.example,
+// used for every absolute link we hand out (OAuth redirect URIs, emails).
+// When it isn't configured links on pages are worked out from each request,
+// and mails with links in them aren't sent.
+var publicURL string
+
+// ErrNoPublicURL is returned for a link in an email without PUBLIC_URL. The
+// request's Host header is up to whoever sent it, so a link built from it
+// could take the recipient anywhere.
+var ErrNoPublicURL = errors.New("PUBLIC_URL must be set to mail links")
+
+// Proxies whose X-Forwarded-Proto and X-Forwarded-Host headers we believe
+var trustedProxies []*net.IPNet
+
+// ConfigureURLs sets the public base URL and the trusted proxies, given as
+// comma separated IPs or CIDRs. Both may be empty.
+func ConfigureURLs(base string, proxies string) error {
+	base = strings.TrimSuffix(strings.TrimSpace(base), "/")
+	if base != "" {
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("PUBLIC_URL %q must be an absolute http(s) URL", base)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("PUBLIC_URL %q must not have a query or fragment", base)
+		}
+	}
+	networks, err := parseProxies(proxies)
+	if err != nil {
+		return err
+	}
+	publicURL, trustedProxies = base, networks
+	return nil
+}
+
+// TrustedProxies returns the configured proxies in the form
+// gin.Engine.SetTrustedProxies takes.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, network := range trustedProxies {
+		proxies = append(proxies, network.String())
+	}
+	return proxies
+}
+
+func parseProxies(proxies string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES: invalid IP %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES: invalid CIDR %q", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// fromTrustedProxy reports whether the request came straight from one of
+// the trusted proxies.
+func fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns the first value of a X-Forwarded-* header, which the
+// proxy nearest to the client set.
+func forwarded(c *gin.Context, header string) string {
+	value, _, _ := strings.Cut(c.GetHeader(header), ",")
+	return strings.TrimSpace(value)
+}
+
+// BaseURL returns the external base URL of the app, without a trailing
+// slash. Forwarded headers are only used when the request came through a
+// trusted proxy, otherwise anyone could make us link to their host. Links
+// that leave the page, like in emails, use MailURL instead.
+func BaseURL(c *gin.Context) string {
+	if publicURL != "" {
+		return publicURL
+	}
+	scheme, host := "http", c.Request.Host
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if fromTrustedProxy(c) {
+		if proto := strings.ToLower(forwarded(c, "X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := forwarded(c, "X-Forwarded-Host"); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	return scheme + "://" + host
+}
+
+// AbsoluteURL joins path, which starts with a slash, onto the base URL.
+func AbsoluteURL(c *gin.Context, path string) string {
+	return BaseURL(c) + path
+}
+
+// MailURL joins path, which starts with a slash, onto PUBLIC_URL for a link
+// in an email. It never falls back to the request's host.
+func MailURL(path string) (string, error) {
+	if publicURL == "" {
+		return "", ErrNoPublicURL
+	}
+	return publicURL + path, nil
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"html/template"
+	"log"
 	"net/http"
 	"os"
+	"strings"
 
+	"github.com/Aniket52kr/GO-Assignment/database"
 	"github.com/Aniket52kr/GO-Assignment/internal"
 	socials "github.com/Aniket52kr/GO-Assignment/internal/auth"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/Aniket52kr/GO-Assignment/internal/password"
 	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/Aniket52kr/GO-Assignment/routes"
 	"github.com/gin-contrib/sessions"
@@ -20,56 +25,123 @@ func index(c *gin.Context) {
 }
 
 func notFound(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No such API endpoint."})
+		return
+	}
 	c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
 		"error":   "404 Not Found",
 		"message": "The requested page was not found.",
 	})
 }
 
+func methodNotAllowed(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "This API endpoint doesn't take " + c.Request.Method + "."})
+		return
+	}
+	c.HTML(http.StatusMethodNotAllowed, "error.tmpl.html", gin.H{
+		"error":   "405 Method Not Allowed",
+		"message": "The requested page can't be used this way.",
+	})
+}
+
 func main() {
 	godotenv.Load(".env")
+
+	// Schema management: ./main migrate up|down|status [steps]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := database.Migrate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 
+	// Pick the storage backend (DB_DRIVER=mysql|memory)
+	if err := database.Open(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Outgoing mail goes through a queue to the MAIL_DRIVER backend
+	if err := mail.Open(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Absolute links use PUBLIC_URL, or the request's host as seen through
+	// TRUSTED_PROXIES. Links in emails only ever use PUBLIC_URL.
+	if err := internal.ConfigureURLs(os.Getenv("PUBLIC_URL"), os.Getenv("TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err)
+	}
+	if os.Getenv("PUBLIC_URL") == "" {
+		log.Println("PUBLIC_URL is not set, mails with links in them won't be sent")
+	}
+
+	// New password hashes use BCRYPT_COST, and BREACHED_PASSWORDS can point
+	// at a bigger list of leaked passwords than the bundled one
+	if err := password.Configure(os.Getenv("BCRYPT_COST"), os.Getenv("BREACHED_PASSWORDS")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Which actions wait for a verified email, and for how long new
+	// accounts get to do them anyway
+	if err := middleware.ConfigureVerification(os.Getenv("VERIFY_REQUIRED"), os.Getenv("VERIFY_GRACE")); err != nil {
+		log.Fatal(err)
+	}
+
 	app := gin.Default()
+	if err := app.SetTrustedProxies(internal.TrustedProxies()); err != nil {
+		log.Fatal(err)
+	}
 	app.RedirectTrailingSlash = true
 	app.HandleMethodNotAllowed = true
 	app.NoRoute(notFound)
+	app.NoMethod(methodNotAllowed)
 
 	app.Static("/static", "./static")
 	app.SetFuncMap(template.FuncMap{
 		"formatAsTitle": internal.FormatAsTitle,
 		"formatAsDate":  internal.FormatAsDate,
 	})
-	app.LoadHTMLGlob("templates/*")
+	app.LoadHTMLGlob("templates/*.html")
+	app.HTMLRender = internal.PageRender{HTMLRender: app.HTMLRender}
 
 	store := cookie.NewStore([]byte(os.Getenv("SECRET_KEY")))
 	app.Use(sessions.Sessions("SocialEcho", store))
 	app.Use(middleware.RecoveryMiddleware())
+	app.Use(middleware.VerificationBanner())
 
 	// public routes:-
 	app.GET("/", index)
 	app.GET("/signup", routes.SignUp)
 	app.GET("/login", routes.Login)
 	app.GET("/logout", routes.Logout)
-	app.GET("/feed", middleware.AuthMiddleware(), routes.UserFeed)
-	app.GET("/feed/more", middleware.AuthMiddleware(), routes.LoadMoreFeed)
+	app.GET("/feed", middleware.AuthMiddleware(middleware.ScopeRead), routes.UserFeed)
+	app.GET("/feed/more", middleware.AuthMiddleware(middleware.ScopeRead), routes.LoadMoreFeed)
 
 	// Oauth and verification routes:-
 	auth := app.Group("/auth")
 	{
-
-		auth.GET("/signup/github", socials.GitHubSignUp)
-		auth.GET("/signup/google", socials.GoogleSignUp)
-		auth.GET("/login/github", socials.GitHubLogin)
-		auth.GET("/login/google", socials.GoogleLogin)
-
-		auth.GET("/github", socials.GitHubAuth)
-		auth.GET("/google", socials.GoogleAuth)
+		auth.GET("/:provider", socials.Begin)
+		auth.GET("/:provider/callback", socials.Callback)
 		auth.GET("/verify", middleware.AuthMiddleware(), routes.SendVerificationMail)
 		auth.GET("/verify/:id", routes.Verify)
+		auth.GET("/forgot", routes.ForgotPassword)
+		auth.GET("/reset/:token", routes.ResetPassword)
+		auth.GET("/email/:token", routes.ConfirmEmail)
+		auth.GET("/2fa", routes.TwoFactorLogin)
 
+		auth.POST("/:provider/link", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), socials.BeginLink)
 		auth.POST("/signup", routes.SignUp)
 		auth.POST("/login", routes.Login)
+		auth.POST("/forgot", routes.ForgotPassword)
+		auth.POST("/reset/:token", routes.ResetPassword)
+		auth.POST("/2fa", routes.TwoFactorLogin)
+		auth.POST("/2fa/passkey/begin", routes.BeginPasskeyTwoFactor)
+		auth.POST("/2fa/passkey/finish", routes.FinishPasskeyTwoFactor)
+		auth.POST("/passkey/begin", routes.BeginPasskeyLogin)
+		auth.POST("/passkey/finish", routes.FinishPasskeyLogin)
 	}
 
 	// user group routes:-
@@ -77,44 +149,103 @@ func main() {
 	user.GET("/:username", routes.GetUserByName)
 	user.GET("/:username/posts", routes.GetUserPosts)
 	user.GET("/:username/posts/more", routes.LoadMorePosts)
+	// API tokens work here too, but never on the settings
+	user.GET("/", middleware.AuthMiddleware(middleware.ScopeRead), routes.GetUser)
+	user.POST("/:username/toggle-follow", middleware.AuthMiddleware(middleware.ScopeFollow), middleware.RequireVerified("follow"), routes.ToggleFollow)
 	user.Use(middleware.AuthMiddleware())
 	{
-		user.GET("/", routes.GetUser)
 		user.GET("/settings/avatar", routes.UpdateAvatar)
 		user.GET("/settings/username", routes.UpdateUsername)
-		user.GET("/settings/password", routes.UpdatePassword)
-		user.GET("/settings/delete", routes.DeleteUser)
+		user.GET("/settings/email", middleware.TwoFactorMiddleware(), routes.UpdateEmail)
+		user.GET("/settings/password", middleware.TwoFactorMiddleware(), routes.UpdatePassword)
+		user.GET("/settings/logins", routes.Logins)
+		user.GET("/settings/sessions", routes.Sessions)
+		user.GET("/settings/2fa", routes.TwoFactor)
+		user.GET("/settings/2fa/confirm", routes.ConfirmTwoFactor)
+		user.GET("/settings/passkeys", middleware.TwoFactorMiddleware(), routes.Passkeys)
+		user.GET("/settings/tokens", middleware.TwoFactorMiddleware(), routes.APITokens)
+		user.GET("/settings/delete", middleware.TwoFactorMiddleware(), routes.DeleteUser)
 
-		user.POST("/:username/toggle-follow", routes.ToggleFollow)
 		user.POST("/settings/avatar", routes.UpdateAvatar)
 		user.POST("/settings/username", routes.UpdateUsername)
-		user.POST("/settings/password", routes.UpdatePassword)
-		user.POST("/settings/delete", routes.DeleteUser)
+		user.POST("/settings/email", middleware.TwoFactorMiddleware(), routes.UpdateEmail)
+		user.POST("/settings/password", middleware.TwoFactorMiddleware(), routes.UpdatePassword)
+		user.POST("/settings/logins/:provider/unlink", middleware.TwoFactorMiddleware(), routes.Unlink)
+		user.POST("/settings/sessions/logout-others", routes.LogoutOtherSessions)
+		user.POST("/settings/sessions/:id/logout", routes.LogoutSession)
+		user.POST("/settings/2fa/setup", routes.SetUpTwoFactor)
+		user.POST("/settings/2fa/enable", routes.EnableTwoFactor)
+		user.POST("/settings/2fa/disable", routes.DisableTwoFactor)
+		user.POST("/settings/2fa/recovery", routes.NewRecoveryCodes)
+		user.POST("/settings/2fa/confirm", routes.ConfirmTwoFactor)
+		user.POST("/settings/passkeys/begin", middleware.TwoFactorMiddleware(), routes.BeginPasskey)
+		user.POST("/settings/passkeys/finish", middleware.TwoFactorMiddleware(), routes.FinishPasskey)
+		user.POST("/settings/passkeys/:id/delete", middleware.TwoFactorMiddleware(), routes.DeletePasskey)
+		user.POST("/settings/tokens", middleware.TwoFactorMiddleware(), routes.CreateAPIToken)
+		user.POST("/settings/tokens/:id/delete", middleware.TwoFactorMiddleware(), routes.DeleteAPIToken)
+		user.POST("/settings/delete", middleware.TwoFactorMiddleware(), routes.DeleteUser)
 	}
 
 	// search group routes:-
 	search := app.Group("/search")
 	{
-		search.GET("/", routes.SearchUser)
-		search.GET("/more", routes.LoadMoreUsers)
+		search.GET("/", routes.Search)
+		search.GET("/more", routes.LoadMoreResults)
 
-		search.POST("/", routes.SearchUser)
-		search.POST("/:username/toggle-follow", middleware.AuthMiddleware(), routes.ToggleSearchFollow)
+		search.POST("/", routes.Search)
+		search.POST("/:username/toggle-follow", middleware.AuthMiddleware(middleware.ScopeFollow), middleware.RequireVerified("follow"), routes.ToggleSearchFollow)
 	}
 
 	// post group routes:-
 	post := app.Group("/post")
 	post.GET("/:id", routes.GetPost)
+	// API tokens work here too
+	post.GET("/:id/toggle-vote", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("vote"), routes.ToggleVote)
+	post.GET("/:id/delete", middleware.AuthMiddleware(middleware.ScopePost), routes.DeletePost)
+	post.GET("/:id/comment/delete", middleware.AuthMiddleware(middleware.ScopePost), routes.DeleteComment)
+	post.POST("/", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("post"), routes.NewPost)
+	post.POST("/:id/comment", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("comment"), routes.Comment)
 	post.Use(middleware.AuthMiddleware())
 	{
-		post.GET("/", routes.NewPost)
-		post.GET("/:id/toggle-vote", routes.ToggleVote)
-		post.GET("/:id/delete", routes.DeletePost)
+		post.GET("/", middleware.RequireVerified("post"), routes.NewPost)
 		post.GET("/:id/comments", routes.LoadMoreComments)
-		post.GET("/:id/comment/delete", routes.DeleteComment)
+	}
+
+	// admin routes:-
+	admin := app.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(middleware.ScopeAdmin), middleware.AdminMiddleware())
+	{
+		admin.GET("/mail", routes.PreviewMail)
+		admin.GET("/mail/:name", routes.PreviewMail)
+		admin.GET("/audit", routes.AuditLog)
+	}
+
+	// JSON API routes, with API tokens or the cookie:-
+	api := app.Group("/api/v1")
+	{
+		read := middleware.OptionalToken(middleware.ScopeRead)
+		api.GET("/me", middleware.AuthMiddleware(middleware.ScopeRead), routes.APIMe)
+		api.GET("/feed", middleware.AuthMiddleware(middleware.ScopeRead), routes.APIFeed)
+		api.GET("/users/:username", read, routes.APIUser)
+		api.GET("/users/:username/posts", read, routes.APIUserPosts)
+		api.GET("/users/:username/followers", read, routes.APIFollowers)
+		api.GET("/users/:username/following", read, routes.APIFollowing)
+		api.GET("/posts/:id", read, routes.APIPost)
+		api.GET("/posts/:id/comments", read, routes.APIComments)
+		api.GET("/posts/:id/votes", read, routes.APIVotes)
+		api.GET("/search/users", read, routes.APISearchUsers)
+		api.GET("/search/posts", read, routes.APISearchPosts)
 
-		post.POST("/", routes.NewPost)
-		post.POST("/:id/comment", routes.Comment)
+		api.PUT("/users/:username/follow", middleware.AuthMiddleware(middleware.ScopeFollow), middleware.RequireVerified("follow"), routes.APIFollow)
+		api.DELETE("/users/:username/follow", middleware.AuthMiddleware(middleware.ScopeFollow), routes.APIFollow)
+		api.POST("/posts", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("post"), routes.APICreatePost)
+		api.PATCH("/posts/:id", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("post"), routes.APIUpdatePost)
+		api.DELETE("/posts/:id", middleware.AuthMiddleware(middleware.ScopePost), routes.APIDeletePost)
+		api.POST("/posts/:id/comments", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("comment"), routes.APICreateComment)
+		api.PATCH("/posts/:id/comments/:commentId", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("comment"), routes.APIUpdateComment)
+		api.DELETE("/posts/:id/comments/:commentId", middleware.AuthMiddleware(middleware.ScopePost), routes.APIDeleteComment)
+		api.PUT("/posts/:id/vote", middleware.AuthMiddleware(middleware.ScopePost), middleware.RequireVerified("vote"), routes.APIVote)
+		api.DELETE("/posts/:id/vote", middleware.AuthMiddleware(middleware.ScopePost), routes.APIVote)
 	}
 
 	// Load custom port from .env or fallback to 8081
@@ -2,10 +2,16 @@ package middleware
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/models"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -21,6 +27,8 @@ var (
 	issuer          string
 	secretKey       []byte
 	errInvalidToken = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+	errNotLoggedIn  = errors.New("not logged in")
 )
 
 func init() {
@@ -29,54 +37,160 @@ func init() {
 	secretKey = []byte(os.Getenv("SECRET_KEY"))
 }
 
-func CreateToken(id string) (string, error) {
+// CreateToken issues an access token for session sessionId of user id.
+func CreateToken(id string, sessionId string) (string, error) {
+	now := time.Now()
 	claims := JWTClaims{
 		id,
 		jwt.StandardClaims{
-			Issuer:   issuer,
-			IssuedAt: time.Now().Unix(),
+			Id:        sessionId,
+			Issuer:    issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTTL).Unix(),
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secretKey)
 }
 
+// ParseToken checks an access token. If the token is only expired it
+// returns errTokenExpired along with the claims, to be refreshed.
 func ParseToken(token string) (*JWTClaims, error) {
-	parsedToken, err := jwt.ParseWithClaims(token, &JWTClaims{}, func(t *jwt.Token) (interface{}, error) {
+	claims := &JWTClaims{}
+	parsedToken, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errInvalidToken
+		}
 		return secretKey, nil
 	})
-	if err != nil {
-		return nil, err
+	var validation *jwt.ValidationError
+	if errors.As(err, &validation) && validation.Errors == jwt.ValidationErrorExpired {
+		return claims, errTokenExpired
 	}
-	if claims, ok := parsedToken.Claims.(*JWTClaims); ok && parsedToken.Valid {
-		return claims, nil
+	if err != nil || !parsedToken.Valid {
+		return nil, errInvalidToken
 	}
-	return nil, errInvalidToken
+	return claims, nil
 }
 
-func AuthMiddleware() func(c *gin.Context) {
+// AuthMiddleware lets through logged in users. Where scopes are given a
+// personal API token with one of them works too, sent as "Authorization:
+// Bearer <token>" instead of the cookie; elsewhere tokens are refused.
+func AuthMiddleware(scopes ...string) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		token := session.Get("Authorization")
-		if token == nil {
-			c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
-				"error":   "401 Unauthorized",
-				"message": "User not logged in.",
-			})
-			c.Abort()
+		if token, ok := bearerToken(c); ok {
+			tokenAuth(c, token, scopes)
 			return
 		}
-		parsedToken, err := ParseToken(token.(string))
-		if err != nil {
-			c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
-				"error":   "401 Unauthorized",
-				"message": "Invalid authorization token, try logging in again.",
-			})
-			c.Abort()
-			return
+		if RequireLogin(c) {
+			c.Next()
+		}
+	}
+}
+
+// RequireLogin checks the login cookie like AuthMiddleware, for handlers
+// that only need a login some of the time, eg. the OAuth callback when
+// linking. It sends the error itself and returns false when the request
+// isn't logged in.
+func RequireLogin(c *gin.Context) bool {
+	err := login(c)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errNotLoggedIn):
+		abort(c, http.StatusUnauthorized, "User not logged in.")
+	case errors.Is(err, errInvalidToken):
+		abort(c, http.StatusUnauthorized, "Invalid authorization token, try logging in again.")
+	case errors.Is(err, errSessionEnded):
+		session := sessions.Default(c)
+		session.Clear()
+		session.Save()
+		abort(c, http.StatusUnauthorized, "Your session has ended, log in again.")
+	default:
+		databaseError(c, err, "")
+	}
+	return false
+}
+
+// login checks the login cookie against its server-side session, refreshing
+// an expired access token, and puts the user where UserId finds them. It's
+// only done once per request.
+func login(c *gin.Context) error {
+	if _, ok := c.Get("sessionId"); ok {
+		return nil
+	}
+	session := sessions.Default(c)
+	token, _ := session.Get("Authorization").(string)
+	if token == "" {
+		return errNotLoggedIn
+	}
+	var current *models.Session
+	refreshed := false
+	claims, err := ParseToken(token)
+	if err == nil {
+		current, err = activeSession(c.Request.Context(), claims)
+	} else if errors.Is(err, errTokenExpired) {
+		current, refreshed, err = refresh(c, claims)
+	}
+	if err != nil {
+		return err
+	}
+
+	if now := time.Now(); now.Sub(current.LastSeenAt) > touchEvery || current.IP != c.ClientIP() {
+		if err := database.TouchSession(c.Request.Context(), current.Id, c.ClientIP(), internal.Location(c), now); err != nil {
+			log.Println("Touch session error:", err)
 		}
-		session.Set("userId", parsedToken.UserId)
+	}
+	c.Set("sessionId", current.Id)
+	c.Set("userId", current.UserId)
+	// Only write the cookie when it changed, a response racing a refresh
+	// mustn't put the old tokens back
+	if refreshed || session.Get("userId") != current.UserId {
+		session.Set("userId", current.UserId)
 		session.Save()
+	}
+	return nil
+}
+
+// optionalLogin is login for requests anyone can make: one that isn't
+// logged in, or whose login doesn't check out, goes on logged out.
+// RequireLogin reports why later where it's needed.
+func optionalLogin(c *gin.Context) {
+	err := login(c)
+	if err != nil && !errors.Is(err, errNotLoggedIn) && !errors.Is(err, errInvalidToken) && !errors.Is(err, errSessionEnded) {
+		log.Println("Login error:", err)
+	}
+}
+
+// UserId returns the user a request is logged in as, with the cookie or an
+// API token, "" if it isn't. It's set by AuthMiddleware and OptionalToken.
+func UserId(c *gin.Context) string {
+	return c.GetString("userId")
+}
+
+// admins are the users whose ids are listed in ADMIN_USERS, comma separated.
+var admins = sync.OnceValue(func() map[string]bool {
+	ids := map[string]bool{}
+	for _, id := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+})
+
+// IsAdmin reports whether userId is an admin.
+func IsAdmin(userId string) bool {
+	return admins()[userId]
+}
+
+// AdminMiddleware lets through the admins. It goes after AuthMiddleware.
+func AdminMiddleware() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !IsAdmin(UserId(c)) {
+			abort(c, http.StatusForbidden, "Only admins can see this page.")
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/lockout"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// The cookie holds a short-lived access token and a refresh token for the
+// server-side session. When the access token expires AuthMiddleware trades
+// the refresh token for a new pair, so a copied cookie stops working the
+// first time either copy is refreshed.
+const (
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 30 * 24 * time.Hour
+	// The refresh token a rotation replaced still lets through requests the
+	// browser sent before it got the new cookie
+	rotateGrace = time.Minute
+	// How often last seen is written back for a busy session
+	touchEvery = time.Minute
+)
+
+var errSessionEnded = errors.New("session ended")
+
+// StartSession logs userId in on this device.
+func StartSession(c *gin.Context, userId string) error {
+	ctx := c.Request.Context()
+	now := time.Now()
+	if err := database.DeleteExpiredSessions(ctx, userId, now); err != nil {
+		return err
+	}
+	secret := newSecret()
+	s := &models.Session{
+		Id:          uuid.NewString(),
+		UserId:      userId,
+		RefreshHash: hashSecret(secret),
+		Device:      internal.Truncate(c.Request.UserAgent(), 255),
+		IP:          c.ClientIP(),
+		Location:    internal.Location(c),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		RotatedAt:   now,
+		ExpiresAt:   now.Add(refreshTTL),
+	}
+	if err := database.CreateSession(ctx, s); err != nil {
+		return err
+	}
+	// They got in, earlier failed attempts no longer count against them
+	if err := lockout.Succeed(ctx, userId); err != nil {
+		return err
+	}
+	token, err := CreateToken(userId, s.Id)
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	clearTwoFactor(session)
+	session.Set("Authorization", token)
+	session.Set("Refresh", s.Id+"."+secret)
+	session.Set("userId", userId)
+	return session.Save()
+}
+
+// EndSession logs this device out, deleting its server-side session and
+// clearing the cookie.
+func EndSession(c *gin.Context) error {
+	session := sessions.Default(c)
+	id, _, _ := splitRefresh(session.Get("Refresh"))
+	userId, _ := session.Get("userId").(string)
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
+	session.Save()
+	if id == "" || userId == "" {
+		return nil
+	}
+	if err := database.DeleteSession(c.Request.Context(), userId, id); err != nil && !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// activeSession returns the server-side session an access token was issued
+// for, or errSessionEnded if it was logged out or has expired.
+func activeSession(ctx context.Context, claims *JWTClaims) (*models.Session, error) {
+	s, err := database.ReadSession(ctx, claims.Id)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, errSessionEnded
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.UserId != claims.UserId || !s.ExpiresAt.After(time.Now()) {
+		return nil, errSessionEnded
+	}
+	return s, nil
+}
+
+// refresh checks the cookie's refresh token against the session of an
+// expired access token and rotates both, reporting whether the cookie
+// changed.
+func refresh(c *gin.Context, claims *JWTClaims) (*models.Session, bool, error) {
+	ctx := c.Request.Context()
+	session := sessions.Default(c)
+	id, secret, ok := splitRefresh(session.Get("Refresh"))
+	if !ok || id != claims.Id {
+		return nil, false, errSessionEnded
+	}
+	s, err := activeSession(ctx, claims)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hash := hashSecret(secret)
+	now := time.Now()
+	switch {
+	case equal(hash, s.RefreshHash):
+		next := newSecret()
+		err := database.RotateSession(ctx, s.Id, hash, hashSecret(next), now, now.Add(refreshTTL))
+		if errors.Is(err, database.ErrNotFound) {
+			// A concurrent request rotated it first, its response carries
+			// the new cookie
+			return s, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		token, err := CreateToken(s.UserId, s.Id)
+		if err != nil {
+			return nil, false, err
+		}
+		session.Set("Authorization", token)
+		session.Set("Refresh", s.Id+"."+next)
+		return s, true, nil
+	case s.PreviousHash != "" && equal(hash, s.PreviousHash) && now.Sub(s.RotatedAt) < rotateGrace:
+		return s, false, nil
+	default:
+		// A refresh token that was already used came back, so someone else
+		// has a copy of the cookie: log the session out for both of them
+		if err := database.DeleteSession(ctx, s.UserId, s.Id); err != nil && !errors.Is(err, database.ErrNotFound) {
+			return nil, false, err
+		}
+		return nil, false, errSessionEnded
+	}
+}
+
+// splitRefresh splits a refresh token into its session id and secret.
+func splitRefresh(value any) (string, string, bool) {
+	token, _ := value.(string)
+	id, secret, ok := strings.Cut(token, ".")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func equal(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
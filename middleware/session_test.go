@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// newTestServer serves a few routes around the middleware on a new
+// in-memory store with the user alice. Their paths start with /api/ so
+// errors come back as JSON.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	database.Use(database.NewMemoryStore())
+	if err := database.CreateUser(context.Background(), &models.User{Id: "alice-id", Username: "alice", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	app := gin.New()
+	app.Use(sessions.Sessions("SocialEcho", cookie.NewStore([]byte("test secret"))))
+	app.POST("/api/login", func(c *gin.Context) {
+		if err := StartSession(c, "alice-id"); err != nil {
+			t.Error(err)
+		}
+		c.Status(http.StatusNoContent)
+	})
+	app.POST("/api/logout", func(c *gin.Context) {
+		if err := EndSession(c); err != nil {
+			t.Error(err)
+		}
+		c.Status(http.StatusNoContent)
+	})
+	// Swaps the access token for an expired one, as if 15 minutes went by
+	app.POST("/api/expire", func(c *gin.Context) {
+		session := sessions.Default(c)
+		token, _ := session.Get("Authorization").(string)
+		claims, err := ParseToken(token)
+		if err != nil && !errors.Is(err, errTokenExpired) {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		claims.ExpiresAt = time.Now().Add(-time.Second).Unix()
+		expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secretKey)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		session.Set("Authorization", expired)
+		session.Save()
+		c.Status(http.StatusNoContent)
+	})
+	me := func(c *gin.Context) {
+		c.String(http.StatusOK, UserId(c))
+	}
+	app.GET("/api/me", AuthMiddleware(), me)
+	app.GET("/api/feed", AuthMiddleware(ScopeRead), me)
+	app.POST("/api/posts", AuthMiddleware(ScopePost), me)
+	app.GET("/api/posts", OptionalToken(ScopeRead), me)
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// copyCookies returns a browser with the cookies browser has now, like an
+// attacker who stole them.
+func copyCookies(t *testing.T, server *httptest.Server, browser *http.Client) *http.Client {
+	t.Helper()
+	u, _ := url.Parse(server.URL)
+	thief := newBrowser(t)
+	thief.Jar.SetCookies(u, browser.Jar.Cookies(u))
+	return thief
+}
+
+func status(t *testing.T, browser *http.Client, method string, link string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := browser.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// logIn starts a session for alice in a new browser.
+func logIn(t *testing.T, server *httptest.Server) *http.Client {
+	t.Helper()
+	browser := newBrowser(t)
+	if got := status(t, browser, http.MethodPost, server.URL+"/api/login"); got != http.StatusNoContent {
+		t.Fatalf("login: %d", got)
+	}
+	return browser
+}
+
+// rotate expires the browser's access token and makes a request, which
+// trades its refresh token for a new one.
+func rotate(t *testing.T, server *httptest.Server, browser *http.Client) {
+	t.Helper()
+	status(t, browser, http.MethodPost, server.URL+"/api/expire")
+	if got := status(t, browser, http.MethodGet, server.URL+"/api/me"); got != http.StatusOK {
+		t.Fatalf("request with an expired access token: %d, want 200", got)
+	}
+}
+
+func TestSessionRefresh(t *testing.T) {
+	server := newTestServer(t)
+	browser := logIn(t, server)
+	if got := status(t, browser, http.MethodGet, server.URL+"/api/me"); got != http.StatusOK {
+		t.Fatalf("logged in: %d", got)
+	}
+	rotate(t, server, browser)
+	rotate(t, server, browser)
+
+	found, err := database.ReadSessions(context.Background(), "alice-id")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("sessions after refreshing: %v %v", found, err)
+	}
+}
+
+func TestSessionRefreshReuse(t *testing.T) {
+	server := newTestServer(t)
+	browser := logIn(t, server)
+	status(t, browser, http.MethodPost, server.URL+"/api/expire")
+	stolen := copyCookies(t, server, browser)
+
+	// Requests sent with the old cookie while the refresh was on its way
+	// still get through
+	rotate(t, server, browser)
+	if got := status(t, copyCookies(t, server, stolen), http.MethodGet, server.URL+"/api/me"); got != http.StatusOK {
+		t.Errorf("refresh token just replaced: %d, want 200", got)
+	}
+
+	// Once it's two rotations old, it's a copy of the cookie being used:
+	// the session ends for both
+	rotate(t, server, browser)
+	if got := status(t, stolen, http.MethodGet, server.URL+"/api/me"); got != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: %d, want 401", got)
+	}
+	if got := status(t, browser, http.MethodGet, server.URL+"/api/me"); got != http.StatusUnauthorized {
+		t.Errorf("owner after the reuse: %d, want 401", got)
+	}
+	if found, _ := database.ReadSessions(context.Background(), "alice-id"); len(found) != 0 {
+		t.Errorf("session survived the reuse: %+v", found)
+	}
+}
+
+func TestSessionLogout(t *testing.T) {
+	server := newTestServer(t)
+	browser := logIn(t, server)
+	stolen := copyCookies(t, server, browser)
+	other := logIn(t, server)
+
+	status(t, browser, http.MethodPost, server.URL+"/api/logout")
+	// The copy stops working even though its access token hasn't expired
+	if got := status(t, stolen, http.MethodGet, server.URL+"/api/me"); got != http.StatusUnauthorized {
+		t.Errorf("copy of a logged out cookie: %d, want 401", got)
+	}
+	if got := status(t, other, http.MethodGet, server.URL+"/api/me"); got != http.StatusOK {
+		t.Errorf("other session after logging one out: %d, want 200", got)
+	}
+}
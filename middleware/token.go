@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/gin-gonic/gin"
+)
+
+// What a personal API token can be allowed to do
+const (
+	ScopeRead   = "read"   // feeds and profiles
+	ScopePost   = "post"   // posts, comments and votes
+	ScopeFollow = "follow" // following and unfollowing
+	ScopeAdmin  = "admin"  // the /admin pages, for admins only
+)
+
+// Scopes lists them in the order the settings page shows them.
+var Scopes = []string{ScopeRead, ScopePost, ScopeFollow, ScopeAdmin}
+
+// Tokens start with a prefix so they're easy to spot, eg. by secret scanners
+const apiTokenPrefix = "se_"
+
+// NewAPIToken returns a new personal API token and the hash to store for
+// it. The token itself is only shown to the user once.
+func NewAPIToken() (string, string) {
+	token := apiTokenPrefix + newSecret()
+	return token, hashSecret(token)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// tokenAuth logs in the request with its API token, for the route that
+// takes one of scopes. The session and its cookie aren't touched, the user
+// is only in the context for UserId.
+func tokenAuth(c *gin.Context, token string, scopes []string) {
+	if len(scopes) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API tokens can't be used here."})
+		return
+	}
+	ctx := c.Request.Context()
+	found, err := database.ReadAPIToken(ctx, hashSecret(token))
+	if errors.Is(err, database.ErrNotFound) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API token."})
+		return
+	}
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	allowed := false
+	for _, scope := range scopes {
+		allowed = allowed || found.HasScope(scope)
+	}
+	if !allowed {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": `This API token needs the "` + strings.Join(scopes, `" or "`) + `" scope.`})
+		return
+	}
+	if now := time.Now(); now.Sub(found.LastUsedAt) > touchEvery {
+		if err := database.UseAPIToken(ctx, found.Id, now); err != nil {
+			log.Println("Use API token error:", err)
+		}
+	}
+	c.Set("userId", found.UserId)
+	c.Set("apiTokenId", found.Id)
+	c.Next()
+}
+
+// OptionalToken checks the API token of requests that send one, or else the
+// login cookie, for public routes that show more to a logged in user. Others
+// go through logged out.
+func OptionalToken(scopes ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok {
+			tokenAuth(c, token, scopes)
+			return
+		}
+		optionalLogin(c)
+		c.Next()
+	}
+}
+
+// wantsJSON reports whether errors should be JSON rather than a page: for
+// the JSON API, scripts using an API token and AJAX.
+func wantsJSON(c *gin.Context) bool {
+	_, token := c.Get("apiTokenId")
+	return token || strings.HasPrefix(c.Request.URL.Path, "/api/") ||
+		c.GetHeader("X-Requested-With") == "XMLHttpRequest"
+}
+
+// abort ends the request with an error page, or JSON where wantsJSON.
+func abort(c *gin.Context, status int, message string) {
+	if wantsJSON(c) {
+		c.AbortWithStatusJSON(status, gin.H{"error": message})
+		return
+	}
+	c.HTML(status, "error.tmpl.html", gin.H{
+		"error":   fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		"message": message,
+	})
+	c.Abort()
+}
+
+// databaseError is internal.DatabaseError, or its JSON twin where wantsJSON.
+func databaseError(c *gin.Context, err error, message string) {
+	if wantsJSON(c) {
+		internal.DatabaseErrorJSON(c, err, message)
+		return
+	}
+	internal.DatabaseError(c, err, message)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// newToken gives alice an API token with scopes.
+func newToken(t *testing.T, scopes ...string) (string, *models.APIToken) {
+	t.Helper()
+	token, hash := NewAPIToken()
+	stored := &models.APIToken{
+		Id:        "token-" + hash[:8],
+		UserId:    "alice-id",
+		Name:      "test",
+		TokenHash: hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := database.CreateAPIToken(context.Background(), stored); err != nil {
+		t.Fatal(err)
+	}
+	return token, stored
+}
+
+// bearer sends a request with an Authorization header.
+func bearer(t *testing.T, server *httptest.Server, method string, path string, authorization string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", authorization)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	server := newTestServer(t)
+	read, _ := newToken(t, ScopeRead)
+	post, _ := newToken(t, ScopePost, ScopeFollow)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"read on a read route", "GET", "/api/feed", read, http.StatusOK},
+		{"read on a post route", "POST", "/api/posts", read, http.StatusForbidden},
+		{"post on a post route", "POST", "/api/posts", post, http.StatusOK},
+		{"post on a read route", "GET", "/api/feed", post, http.StatusForbidden},
+		// Routes without scopes are for the cookie only, eg. settings
+		{"read where tokens can't be used", "GET", "/api/me", read, http.StatusForbidden},
+		{"read on an optional route", "GET", "/api/posts", read, http.StatusOK},
+		{"post on an optional route", "GET", "/api/posts", post, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := bearer(t, server, tt.method, tt.path, "Bearer "+tt.token)
+			if res.StatusCode != tt.status {
+				t.Fatalf("%d %s, want %d", res.StatusCode, body, tt.status)
+			}
+			if tt.status == http.StatusOK && body != "alice-id" {
+				t.Errorf("logged in as %q, want alice-id", body)
+			}
+		})
+	}
+
+	res, _ := bearer(t, server, "GET", "/api/feed", "Bearer "+post)
+	if got := res.Header.Get("WWW-Authenticate"); !strings.Contains(got, `error="insufficient_scope"`) || !strings.Contains(got, `scope="read"`) {
+		t.Errorf("WWW-Authenticate %q for a missing scope", got)
+	}
+}
+
+func TestAPITokenInvalid(t *testing.T) {
+	server := newTestServer(t)
+	token, stored := newToken(t, ScopeRead)
+
+	// The scheme is case-insensitive
+	if res, body := bearer(t, server, "GET", "/api/feed", "bearer "+token); res.StatusCode != http.StatusOK {
+		t.Errorf("lowercase scheme: %d %s", res.StatusCode, body)
+	}
+	for _, authorization := range []string{"Bearer se_unknown", "Bearer " + token + "x", "Bearer " + stored.TokenHash} {
+		res, _ := bearer(t, server, "GET", "/api/feed", authorization)
+		if res.StatusCode != http.StatusUnauthorized || !strings.Contains(res.Header.Get("WWW-Authenticate"), `error="invalid_token"`) {
+			t.Errorf("%q: %d %q, want 401 invalid_token", authorization, res.StatusCode, res.Header.Get("WWW-Authenticate"))
+		}
+	}
+	// Also on routes that work logged out, a bad token isn't ignored
+	if res, _ := bearer(t, server, "GET", "/api/posts", "Bearer se_unknown"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unknown token on an optional route: %d, want 401", res.StatusCode)
+	}
+
+	if err := database.DeleteAPIToken(context.Background(), "alice-id", stored.Id); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := bearer(t, server, "GET", "/api/feed", "Bearer "+token); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked token: %d, want 401", res.StatusCode)
+	}
+}
+
+func TestAPITokenLastUsed(t *testing.T) {
+	server := newTestServer(t)
+	token, stored := newToken(t, ScopeRead)
+	if !stored.LastUsedAt.IsZero() {
+		t.Fatal("new token already used")
+	}
+	before := time.Now()
+	bearer(t, server, "GET", "/api/feed", "Bearer "+token)
+	found, err := database.ReadAPIToken(context.Background(), stored.TokenHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.LastUsedAt.Before(before.Add(-time.Second)) {
+		t.Errorf("last used at %s, want after %s", found.LastUsedAt, before)
+	}
+}
+
+func TestNewAPIToken(t *testing.T) {
+	token, hash := NewAPIToken()
+	other, _ := NewAPIToken()
+	if !strings.HasPrefix(token, apiTokenPrefix) || token == other {
+		t.Errorf("tokens %q and %q", token, other)
+	}
+	// Only the hash is stored
+	if hash == token || hash != hashSecret(token) {
+		t.Errorf("hash %q of %q", hash, token)
+	}
+}
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/lockout"
+	"github.com/Aniket52kr/GO-Assignment/internal/twofactor"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// How long the code can be entered after the password
+	pendingTTL = 5 * time.Minute
+	// Wrong codes allowed before the password has to be given again
+	maxCodeAttempts = 5
+	// How long a code confirms sensitive settings changes for
+	confirmTTL = 10 * time.Minute
+)
+
+// LogIn logs userId in on this device and redirects to next, unless they
+// have two-factor authentication on: then the session waits for their code
+// on /auth/2fa instead.
+func LogIn(c *gin.Context, userId string, next string) {
+	enabled, err := twofactor.Enabled(c.Request.Context(), userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	if enabled {
+		session := sessions.Default(c)
+		session.Set("pendingUserId", userId)
+		session.Set("pendingNext", next)
+		session.Set("pendingUntil", time.Now().Add(pendingTTL).Unix())
+		session.Set("pendingAttempts", 0)
+		session.Save()
+		c.Redirect(http.StatusFound, "/auth/2fa")
+		return
+	}
+	if err := StartSession(c, userId); err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.Redirect(http.StatusFound, next)
+}
+
+// PendingLogin returns the user whose password was accepted and who still
+// has to give a code, with the number of wrong codes so far.
+func PendingLogin(c *gin.Context) (string, int, bool) {
+	session := sessions.Default(c)
+	userId, _ := session.Get("pendingUserId").(string)
+	until, _ := session.Get("pendingUntil").(int64)
+	attempts, _ := session.Get("pendingAttempts").(int)
+	if userId == "" || time.Now().Unix() > until || attempts >= maxCodeAttempts {
+		return "", 0, false
+	}
+	return userId, attempts, true
+}
+
+// FailLogin counts a wrong code against the pending login.
+func FailLogin(c *gin.Context, attempts int) {
+	session := sessions.Default(c)
+	session.Set("pendingAttempts", attempts+1)
+	session.Save()
+}
+
+// FinishLogin starts the session of a pending login whose code was right,
+// and returns where to go next.
+func FinishLogin(c *gin.Context, userId string) (string, error) {
+	session := sessions.Default(c)
+	next, _ := session.Get("pendingNext").(string)
+	if err := StartSession(c, userId); err != nil {
+		return "", err
+	}
+	ConfirmTwoFactor(c)
+	return SafeNext(next), nil
+}
+
+// ConfirmTwoFactor records that the code was just given on this session.
+func ConfirmTwoFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Set("twoFactorAt", time.Now().Unix())
+	session.Save()
+}
+
+// Confirmed reports whether a code was given on this session in the last
+// few minutes.
+func Confirmed(c *gin.Context) bool {
+	at, _ := sessions.Default(c).Get("twoFactorAt").(int64)
+	return time.Since(time.Unix(at, 0)) < confirmTTL
+}
+
+// ConfirmIdentity checks it's really the user before a change to how they
+// log in, so a stolen session can't add a way back in or take one away. A
+// code given in the last few minutes does, otherwise password has to be
+// their current one; accounts without a password have to have logged in in
+// the last few minutes. It renders the error page when it returns false.
+func ConfirmIdentity(c *gin.Context, password string) bool {
+	if Confirmed(c) {
+		return true
+	}
+	ctx := c.Request.Context()
+	userId := UserId(c)
+	oauth, err := database.IsOAuthUser(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return false
+	}
+	if oauth {
+		session, err := database.ReadSession(ctx, c.GetString("sessionId"))
+		if err != nil {
+			internal.DatabaseError(c, err, "")
+			return false
+		}
+		if time.Since(session.CreatedAt) < confirmTTL {
+			return true
+		}
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "Log out and in again to confirm it's you, then try again.",
+		})
+		return false
+	}
+	user, err := database.ReadUserById(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return false
+	}
+	ok, wait, err := lockout.CheckPassword(c, user, password)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return false
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		c.HTML(http.StatusTooManyRequests, "error.tmpl.html", gin.H{
+			"error":   "429 Too Many Requests",
+			"message": "Too many failed attempts, try again in " + lockout.Describe(wait) + ".",
+		})
+		return false
+	}
+	if !ok {
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "Incorrect current password.",
+		})
+	}
+	return ok
+}
+
+// clearTwoFactor forgets a pending login and any earlier confirmation, so
+// nothing carries over to the next user of the browser.
+func clearTwoFactor(session sessions.Session) {
+	for _, key := range []string{"pendingUserId", "pendingNext", "pendingUntil", "pendingAttempts", "twoFactorAt"} {
+		session.Delete(key)
+	}
+}
+
+// SafeNext only lets through paths on this site, for redirects after a form.
+func SafeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/feed"
+	}
+	return next
+}
+
+// TwoFactorMiddleware asks users with two-factor authentication on for a
+// fresh code before sensitive settings changes. It goes after
+// AuthMiddleware.
+func TwoFactorMiddleware() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		enabled, err := twofactor.Enabled(c.Request.Context(), UserId(c))
+		if err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		if !enabled || Confirmed(c) {
+			c.Next()
+			return
+		}
+		if c.Request.Method == http.MethodGet {
+			c.Redirect(http.StatusFound, "/user/settings/2fa/confirm?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+			c.Abort()
+			return
+		}
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "Confirm it's you with a code from your authenticator app first, then try again.",
+		})
+		c.Abort()
+	}
+}
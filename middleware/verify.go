@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+)
+
+// The actions that can be held back until the email is verified, and how
+// the error page words them
+var verifyActions = map[string]string{
+	"post":    "post",
+	"comment": "comment",
+	"vote":    "vote",
+	"follow":  "follow people",
+}
+
+var (
+	// All of them by default
+	verifyRequired = map[string]bool{"post": true, "comment": true, "vote": true, "follow": true}
+	// How long after signing up the actions are allowed anyway
+	verifyGrace time.Duration
+)
+
+// ConfigureVerification sets which actions need a verified email, comma
+// separated ("none" for none, empty for all), and the grace period after
+// signing up, eg. "24h" (empty for none).
+func ConfigureVerification(actions string, grace string) error {
+	required := verifyRequired
+	if actions = strings.TrimSpace(actions); actions != "" {
+		required = map[string]bool{}
+		for _, action := range strings.Split(actions, ",") {
+			action = strings.ToLower(strings.TrimSpace(action))
+			if action == "none" {
+				continue
+			}
+			if _, ok := verifyActions[action]; !ok {
+				return fmt.Errorf("VERIFY_REQUIRED: unknown action %q", action)
+			}
+			required[action] = true
+		}
+	}
+	var period time.Duration
+	if grace = strings.TrimSpace(grace); grace != "" {
+		var err error
+		if period, err = time.ParseDuration(grace); err != nil || period < 0 {
+			return fmt.Errorf("VERIFY_GRACE %q must be a duration like 24h", grace)
+		}
+	}
+	verifyRequired, verifyGrace = required, period
+	return nil
+}
+
+// verifyDeadline returns until when user can do the actions without
+// verifying, the zero time if they can't or don't need to.
+func verifyDeadline(user *models.User) time.Time {
+	deadline := user.CreatedAt.Add(verifyGrace)
+	if user.Verified || len(verifyRequired) == 0 || !time.Now().Before(deadline) {
+		return time.Time{}
+	}
+	return deadline
+}
+
+// RequireVerified holds action (eg. "post") back from users who haven't
+// verified their email, once their grace period is over, if the policy
+// says so. It goes after AuthMiddleware.
+func RequireVerified(action string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !verifyRequired[action] {
+			c.Next()
+			return
+		}
+		user, err := database.ReadUserById(c.Request.Context(), UserId(c))
+		if err != nil {
+			databaseError(c, err, "User not found.")
+			return
+		}
+		if user.Verified || !verifyDeadline(user).IsZero() {
+			c.Next()
+			return
+		}
+		abort(c, http.StatusForbidden, "Verify your email to "+verifyActions[action]+", the link is in the mail we sent you. You can send it again from your settings.")
+	}
+}
+
+// VerificationBanner has base.tmpl.html remind logged in users who haven't
+// verified their email yet, with the end of their grace period if they're
+// in it. The cookie is checked against its session first, the same way
+// AuthMiddleware does it and only once per request.
+func VerificationBanner() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		// Only pages need it, not forms, AJAX and scripts
+		_, bearer := bearerToken(c)
+		if c.Request.Method != http.MethodGet || bearer || wantsJSON(c) {
+			c.Next()
+			return
+		}
+		optionalLogin(c)
+		id := UserId(c)
+		if id == "" {
+			c.Next()
+			return
+		}
+		user, err := database.ReadUserById(c.Request.Context(), id)
+		if err != nil {
+			if !errors.Is(err, database.ErrNotFound) {
+				log.Println(err)
+			}
+			c.Next()
+			return
+		}
+		if !user.Verified {
+			internal.SetPageData(c, "unverified", true)
+			if deadline := verifyDeadline(user); !deadline.IsZero() {
+				internal.SetPageData(c, "verifyBy", deadline)
+			}
+		}
+		c.Next()
+	}
+}
@@ -17,6 +17,7 @@ type Comment struct {
 	Id        string
 	Body      string `form:"body" binding:"required"`
 	Username  string
+	Avatar    *string
 	Self      bool
 	CreatedAt time.Time
 }
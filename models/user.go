@@ -1,11 +1,16 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// PasswordCost is the bcrypt cost of new password hashes. Hashes made with
+// a lower one are replaced at the next login.
+var PasswordCost = bcrypt.DefaultCost
+
 type User struct {
 	Email     *string `form:"email" binding:"required"`
 	Username  string  `form:"username" binding:"required"`
@@ -16,6 +21,127 @@ type User struct {
 	CreatedAt time.Time
 }
 
+type UserSummary struct {
+	User
+	Followers int
+	Following int
+	Posts     int
+}
+
+type Identity struct {
+	Provider  string
+	Subject   string
+	UserId    string
+	CreatedAt time.Time
+}
+
+type PasswordReset struct {
+	TokenHash string
+	UserId    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// EmailChange is a new address waiting to be confirmed from its inbox.
+type EmailChange struct {
+	TokenHash string
+	UserId    string
+	Email     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Session is a login on one device. The refresh token is only kept as a
+// hash; the one it replaced stays valid for a moment after rotating, for
+// requests that were already in flight.
+type Session struct {
+	Id           string
+	UserId       string
+	RefreshHash  string
+	PreviousHash string
+	Device       string // User-Agent
+	IP           string
+	Location     string // eg. "Lyon, FR", empty if unknown
+	CreatedAt    time.Time
+	LastSeenAt   time.Time
+	RotatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// TwoFactor is a user's TOTP authenticator. EnabledAt is zero until the
+// user confirms the enrollment with a code.
+type TwoFactor struct {
+	UserId    string
+	Secret    string // base32
+	LastStep  int64  // time step of the last code used
+	EnabledAt time.Time
+	CreatedAt time.Time
+}
+
+func (t *TwoFactor) Enabled() bool {
+	return !t.EnabledAt.IsZero()
+}
+
+// Credential is a passkey: a WebAuthn public key credential registered by
+// one of the user's authenticators.
+type Credential struct {
+	Id              []byte
+	UserId          string
+	Name            string
+	PublicKey       []byte // COSE encoded
+	AttestationType string
+	Transports      []string // eg. "usb", "internal", "hybrid"
+	AAGUID          []byte   // the authenticator model
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool // synced to other devices
+	CreatedAt       time.Time
+	LastUsedAt      time.Time // zero if never used to log in
+}
+
+// APIToken is a personal access token for scripts, limited to its scopes
+// (eg. "read", "post"). Only a hash of the token is kept.
+type APIToken struct {
+	Id         string
+	UserId     string
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt time.Time // zero if never used
+}
+
+// HasScope reports whether the token was given scope.
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// MailSends counts the mails sent under a key, like a verification mail
+// to a user.
+type MailSends struct {
+	Key        string
+	Sent       int
+	LastSentAt time.Time
+}
+
+// LoginThrottle counts the failed logins for an IP or account.
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// AuditEvent is an entry of the security audit log, eg. a failed login.
+type AuditEvent struct {
+	Id        int64
+	UserId    string // empty if the username didn't match anyone
+	Event     string
+	Username  string // as typed in
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
 type DiscordUser struct {
 	Email     *string `json:"email"`
 	Username  string  `json:"username"`
@@ -29,6 +155,7 @@ type GitHubUser struct {
 	Username string  `json:"login"`
 	Verified bool
 	Avatar   *string `json:"avatar_url"`
+	GitHubId int64   `json:"id"`
 }
 
 type GoogleUser struct {
@@ -36,6 +163,7 @@ type GoogleUser struct {
 	Username string  `json:"given_name"`
 	Avatar   *string `json:"picture"`
 	Verified bool    `json:"email_verified"`
+	GoogleId string  `json:"sub"`
 }
 
 type Login struct {
@@ -44,7 +172,7 @@ type Login struct {
 }
 
 func (u *User) HashPassword() error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), PasswordCost)
 	if err != nil {
 		return err
 	}
@@ -56,3 +184,10 @@ func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
+
+// NeedsRehash reports whether the password hash was made with a lower cost
+// than PasswordCost.
+func (u *User) NeedsRehash() bool {
+	cost, err := bcrypt.Cost([]byte(u.Password))
+	return err == nil && cost < PasswordCost
+}
@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/gin-gonic/gin"
+)
+
+// preview an email template with sample data:-
+func PreviewMail(c *gin.Context) {
+	name := c.Param("name")
+	if name == "" {
+		name = "verify"
+	}
+	locale := c.DefaultQuery("locale", mail.Locales()[0])
+	data := mail.Sample(name)
+	if data == nil {
+		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
+			"error":   "404 Not Found",
+			"message": "Email template not found.",
+		})
+		return
+	}
+	msg, err := mail.Compose("preview@example.com", locale, name, data)
+	if err != nil {
+		log.Println(err)
+		c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
+			"error":   "500 Internal Server Error",
+			"message": "Unable to render the template: " + err.Error(),
+		})
+		return
+	}
+	c.HTML(http.StatusOK, "mailPreview.tmpl.html", gin.H{
+		"names":   mail.Names(),
+		"locales": mail.Locales(),
+		"name":    name,
+		"locale":  locale,
+		"message": msg,
+	})
+}
+
+// latest entries of the security audit log:-
+func AuditLog(c *gin.Context) {
+	events, err := database.ReadAuditEvents(c.Request.Context(), 100)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.HTML(http.StatusOK, "audit.tmpl.html", gin.H{
+		"events": events,
+	})
+}
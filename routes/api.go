@@ -0,0 +1,374 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+)
+
+// The most rows an API list can be asked for with ?limit=
+const maxAPILimit = 50
+
+// The longest post or comment body, as long as the columns allow
+const maxBodyLength = 320
+
+// The JSON shapes below are the only way models reach a response, so a new
+// model field (eg. a secret) is never sent by accident.
+
+// apiUser is a user as others see them, there's never an email or a password
+// hash in it.
+type apiUser struct {
+	Id        string    `json:"id"`
+	Username  string    `json:"username"`
+	Avatar    *string   `json:"avatar"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+	Followers int       `json:"followers"`
+	Following int       `json:"following"`
+	Posts     int       `json:"posts"`
+	// Whether the user asking follows them, left out when logged out and
+	// for themselves
+	Follows *bool `json:"follows,omitempty"`
+}
+
+// apiMe is the user asking, with their own email.
+type apiMe struct {
+	apiUser
+	Email *string `json:"email"`
+}
+
+type apiAuthor struct {
+	Username string  `json:"username"`
+	Avatar   *string `json:"avatar"`
+}
+
+type apiPost struct {
+	Id        string    `json:"id"`
+	Author    apiAuthor `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	// Only when reading a single post
+	Votes *int  `json:"votes,omitempty"`
+	Voted *bool `json:"voted,omitempty"`
+}
+
+type apiComment struct {
+	Id        string    `json:"id"`
+	PostId    string    `json:"post_id"`
+	Author    apiAuthor `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	// Whether the user asking wrote it
+	Self bool `json:"self"`
+}
+
+type apiPagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// apiBody is what creating or editing a post or comment sends.
+type apiBody struct {
+	Body string `json:"body"`
+}
+
+func toAPIUser(user models.UserSummary) apiUser {
+	return apiUser{
+		Id:        user.Id,
+		Username:  user.Username,
+		Avatar:    user.Avatar,
+		Verified:  user.Verified,
+		CreatedAt: user.CreatedAt,
+		Followers: user.Followers,
+		Following: user.Following,
+		Posts:     user.Posts,
+	}
+}
+
+func toAPIPost(post models.Post) apiPost {
+	return apiPost{
+		Id:        post.Id,
+		Author:    apiAuthor{post.Username, post.Avatar},
+		Body:      post.Body,
+		CreatedAt: post.CreatedAt,
+	}
+}
+
+func toAPIPosts(posts []models.Post) []apiPost {
+	out := make([]apiPost, 0, len(posts))
+	for _, post := range posts {
+		out = append(out, toAPIPost(post))
+	}
+	return out
+}
+
+// toAPIComments converts comments, marking the ones userId ("" if logged
+// out) wrote.
+func toAPIComments(comments []models.Comment, userId string) []apiComment {
+	out := make([]apiComment, 0, len(comments))
+	for _, comment := range comments {
+		out = append(out, apiComment{
+			Id:        comment.Id,
+			PostId:    comment.PostId,
+			Author:    apiAuthor{comment.Username, comment.Avatar},
+			Body:      comment.Body,
+			CreatedAt: comment.CreatedAt,
+			Self:      userId != "" && userId == comment.UserId,
+		})
+	}
+	return out
+}
+
+// apiError ends the request with {"error": message}, the shape of every
+// JSON error.
+func apiError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": message})
+}
+
+// apiList sends a page of data along with where the next one starts.
+func apiList(c *gin.Context, data any, limit int, next string) {
+	c.JSON(http.StatusOK, gin.H{
+		"data":       data,
+		"pagination": apiPagination{Limit: limit, NextCursor: next, HasMore: next != ""},
+	})
+}
+
+// apiLimit reads ?limit=, pageSize when it's missing.
+func apiLimit(c *gin.Context) (int, bool) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return pageSize, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxAPILimit {
+		apiError(c, http.StatusBadRequest, "limit must be a number from 1 to "+strconv.Itoa(maxAPILimit)+".")
+		return 0, false
+	}
+	return limit, true
+}
+
+// readAPIBody reads the body of a new or edited post or comment. Only JSON
+// is accepted: a cross-site form can't send it, so cookie logins are safe
+// from forged requests.
+func readAPIBody(c *gin.Context) (string, bool) {
+	if c.ContentType() != "application/json" {
+		apiError(c, http.StatusUnsupportedMediaType, "Send a JSON body with Content-Type: application/json.")
+		return "", false
+	}
+	var body apiBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apiError(c, http.StatusBadRequest, "Invalid JSON body.")
+		return "", false
+	}
+	text := strings.TrimSpace(body.Body)
+	if text == "" {
+		apiError(c, http.StatusBadRequest, "body is required.")
+		return "", false
+	}
+	if utf8.RuneCountInString(text) > maxBodyLength {
+		apiError(c, http.StatusBadRequest, "body can't be longer than "+strconv.Itoa(maxBodyLength)+" characters.")
+		return "", false
+	}
+	return text, true
+}
+
+// readAPIUser reads user's counts, and whether userId ("" if logged out)
+// follows them.
+func readAPIUser(ctx context.Context, user *models.User, userId string) (apiUser, error) {
+	summary := models.UserSummary{User: *user}
+	var err error
+	if summary.Followers, err = database.ReadFollowersCount(ctx, user.Id); err != nil {
+		return apiUser{}, err
+	}
+	if summary.Following, err = database.ReadFollowingCount(ctx, user.Id); err != nil {
+		return apiUser{}, err
+	}
+	if summary.Posts, err = database.ReadPostsCount(ctx, user.Id); err != nil {
+		return apiUser{}, err
+	}
+	out := toAPIUser(summary)
+	if userId != "" && userId != user.Id {
+		follows, err := database.Followed(ctx, userId, user.Id)
+		if err != nil {
+			return apiUser{}, err
+		}
+		out.Follows = &follows
+	}
+	return out, nil
+}
+
+// the user asking:-
+func APIMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := database.ReadUserById(ctx, middleware.UserId(c))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	out, err := readAPIUser(ctx, user, user.Id)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": apiMe{apiUser: out, Email: user.Email}})
+}
+
+// a user by name:-
+func APIUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := database.ReadUserByName(ctx, c.Param("username"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	out, err := readAPIUser(ctx, user, middleware.UserId(c))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// a user's posts, newest first:-
+func APIUserPosts(c *gin.Context) {
+	limit, ok := apiLimit(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	user, err := database.ReadUserByName(ctx, c.Param("username"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	posts, next, err := database.ReadPosts(ctx, user.Id, c.Query("cursor"), limit)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	apiList(c, toAPIPosts(posts), limit, next)
+}
+
+// apiFollows sends the usernames read returns for the user in the URL.
+func apiFollows(c *gin.Context, read func(context.Context, string) ([]string, error)) {
+	ctx := c.Request.Context()
+	user, err := database.ReadUserByName(ctx, c.Param("username"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	usernames, err := read(ctx, user.Id)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	if usernames == nil {
+		usernames = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": usernames})
+}
+
+// who follows a user:-
+func APIFollowers(c *gin.Context) {
+	apiFollows(c, database.ReadFollowers)
+}
+
+// who a user follows:-
+func APIFollowing(c *gin.Context) {
+	apiFollows(c, database.ReadFollowing)
+}
+
+// follow (PUT) or unfollow (DELETE) a user:-
+func APIFollow(c *gin.Context) {
+	userId := middleware.UserId(c)
+	ctx := c.Request.Context()
+	user, err := database.ReadUserByName(ctx, c.Param("username"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	if user.Id == userId {
+		apiError(c, http.StatusBadRequest, "You can't follow yourself.")
+		return
+	}
+	follow := c.Request.Method == http.MethodPut
+	changed, err := database.SetFollow(ctx, userId, user.Id, follow)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	if follow && changed {
+		notifyFollowed(c, userId, user)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"follows": follow}})
+}
+
+// posts of the people the user asking follows:-
+func APIFeed(c *gin.Context) {
+	limit, ok := apiLimit(c)
+	if !ok {
+		return
+	}
+	posts, next, err := database.ReadFeedPosts(c.Request.Context(), middleware.UserId(c), c.Query("cursor"), limit)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	apiList(c, toAPIPosts(posts), limit, next)
+}
+
+// apiSearchQuery reads ?q=, in the search bar's syntax.
+func apiSearchQuery(c *gin.Context) (database.SearchQuery, bool) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		apiError(c, http.StatusBadRequest, "q is required, eg. ?q=golang.")
+		return database.SearchQuery{}, false
+	}
+	return database.ParseSearchQuery(q), true
+}
+
+// search people:-
+func APISearchUsers(c *gin.Context) {
+	limit, ok := apiLimit(c)
+	if !ok {
+		return
+	}
+	query, ok := apiSearchQuery(c)
+	if !ok {
+		return
+	}
+	users, next, err := searchUsers(c.Request.Context(), middleware.UserId(c), query, c.Query("cursor"), limit)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	apiList(c, users, limit, next)
+}
+
+// search posts:-
+func APISearchPosts(c *gin.Context) {
+	limit, ok := apiLimit(c)
+	if !ok {
+		return
+	}
+	query, ok := apiSearchQuery(c)
+	if !ok {
+		return
+	}
+	posts, next, err := database.SearchPosts(c.Request.Context(), query, c.Query("cursor"), limit)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	apiList(c, toAPIPosts(posts), limit, next)
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// TestAPINoSecrets reads every kind of API response about bob and checks
+// none of it has his password hash or email.
+func TestAPINoSecrets(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "alice")
+	signUp(t, server, "bob")
+	ctx := context.Background()
+	alice, _ := database.ReadUserByName(ctx, "alice")
+	bob, _ := database.ReadUserByName(ctx, "bob")
+	if _, err := database.SetFollow(ctx, alice.Id, bob.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.SetFollow(ctx, bob.Id, alice.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	posts := writePosts(t, "bob", 2)
+	if err := database.CreateComment(ctx, bob.Id, posts[0], &models.Comment{Id: "c1", Body: "comment", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	token := newAPIToken(t, "alice", "read")
+
+	for _, path := range []string{
+		"/api/v1/users/bob",
+		"/api/v1/users/bob/posts",
+		"/api/v1/users/bob/followers",
+		"/api/v1/users/bob/following",
+		"/api/v1/users/alice/followers",
+		"/api/v1/posts/" + posts[0],
+		"/api/v1/posts/" + posts[0] + "/comments",
+		"/api/v1/search/users?q=bob",
+		"/api/v1/search/posts?q=post",
+		"/api/v1/feed",
+		"/api/v1/me",
+	} {
+		res, body := bearerGet(t, server.URL+path, token)
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: %d %s", path, res.StatusCode, body)
+			continue
+		}
+		for _, secret := range []string{bob.Password, alice.Password, "$2a$", *bob.Email} {
+			if strings.Contains(body, secret) {
+				t.Errorf("%s has %q in it:\n%s", path, secret, body)
+			}
+		}
+		if strings.Contains(strings.ToLower(body), "password") {
+			t.Errorf("%s has a password field:\n%s", path, body)
+		}
+	}
+}
+
+// TestAPIUserFields pins the fields of a user, so adding one to the
+// response is a decision rather than an accident.
+func TestAPIUserFields(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "alice")
+	signUp(t, server, "bob")
+	token := newAPIToken(t, "alice", "read")
+
+	fields := func(path string) []string {
+		t.Helper()
+		res, body := bearerGet(t, server.URL+path, token)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, res.StatusCode, body)
+		}
+		var out struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(body), &out); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for key := range out.Data {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	user := []string{"avatar", "created_at", "followers", "following", "follows", "id", "posts", "username", "verified"}
+	if got := fields("/api/v1/users/bob"); !slices.Equal(got, user) {
+		t.Errorf("user fields %v, want %v", got, user)
+	}
+	// Only the user asking gets their email, and there's nothing to follow
+	me := []string{"avatar", "created_at", "email", "followers", "following", "id", "posts", "username", "verified"}
+	if got := fields("/api/v1/me"); !slices.Equal(got, me) {
+		t.Errorf("me fields %v, want %v", got, me)
+	}
+}
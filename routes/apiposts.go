@@ -0,0 +1,260 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// readAPIPost reads a post with its author and votes, and whether userId
+// ("" if logged out) voted on it.
+func readAPIPost(ctx context.Context, id string, userId string) (apiPost, error) {
+	post, err := database.ReadPost(ctx, id)
+	if err != nil {
+		return apiPost{}, err
+	}
+	author, err := database.ReadUserById(ctx, post.UserId)
+	if err != nil {
+		return apiPost{}, err
+	}
+	post.Username, post.Avatar = author.Username, author.Avatar
+	voters, err := database.ReadVotes(ctx, post.Id)
+	if err != nil {
+		return apiPost{}, err
+	}
+	out := toAPIPost(*post)
+	votes := len(voters)
+	out.Votes = &votes
+	if userId != "" {
+		voted, err := database.Voted(ctx, userId, post.Id)
+		if err != nil {
+			return apiPost{}, err
+		}
+		out.Voted = &voted
+	}
+	return out, nil
+}
+
+// readOwnPost reads the post in the URL, if the user asking wrote it.
+func readOwnPost(c *gin.Context) (*models.Post, bool) {
+	post, err := database.ReadPost(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return nil, false
+	}
+	if post.UserId != middleware.UserId(c) {
+		apiError(c, http.StatusForbidden, "You can only change your own posts.")
+		return nil, false
+	}
+	return post, true
+}
+
+// readOwnComment reads the comment in the URL, if it's on the post in the
+// URL and the user asking wrote it.
+func readOwnComment(c *gin.Context) (*models.Comment, bool) {
+	comment, err := database.ReadComment(c.Request.Context(), c.Param("commentId"))
+	if err == nil && comment.PostId != c.Param("id") {
+		err = database.ErrNotFound
+	}
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Comment not found.")
+		return nil, false
+	}
+	if comment.UserId != middleware.UserId(c) {
+		apiError(c, http.StatusForbidden, "You can only change your own comments.")
+		return nil, false
+	}
+	return comment, true
+}
+
+// a post:-
+func APIPost(c *gin.Context) {
+	post, err := readAPIPost(c.Request.Context(), c.Param("id"), middleware.UserId(c))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": post})
+}
+
+// write a post:-
+func APICreatePost(c *gin.Context) {
+	body, ok := readAPIBody(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	userId := middleware.UserId(c)
+	post := models.Post{Id: uuid.NewString(), Body: body, CreatedAt: time.Now()}
+	if err := database.CreatePost(ctx, userId, &post); err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	out, err := readAPIPost(ctx, post.Id, userId)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	c.Header("Location", "/api/v1/posts/"+post.Id)
+	c.JSON(http.StatusCreated, gin.H{"data": out})
+}
+
+// edit a post:-
+func APIUpdatePost(c *gin.Context) {
+	post, ok := readOwnPost(c)
+	if !ok {
+		return
+	}
+	body, ok := readAPIBody(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := database.UpdatePost(ctx, post.Id, body); err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	out, err := readAPIPost(ctx, post.Id, post.UserId)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// delete a post:-
+func APIDeletePost(c *gin.Context) {
+	post, ok := readOwnPost(c)
+	if !ok {
+		return
+	}
+	if err := database.DeletePost(c.Request.Context(), post.Id); err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// a post's comments, newest first:-
+func APIComments(c *gin.Context) {
+	limit, ok := apiLimit(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	post, err := database.ReadPost(ctx, c.Param("id"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	comments, next, err := database.ReadComments(ctx, post.Id, c.Query("cursor"), limit)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	apiList(c, toAPIComments(comments, middleware.UserId(c)), limit, next)
+}
+
+// comment on a post:-
+func APICreateComment(c *gin.Context) {
+	body, ok := readAPIBody(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	userId := middleware.UserId(c)
+	comment := models.Comment{Id: uuid.NewString(), Body: body, CreatedAt: time.Now()}
+	if err := database.CreateComment(ctx, userId, c.Param("id"), &comment); err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	author, err := database.ReadUserById(ctx, userId)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	comment.UserId, comment.PostId = userId, c.Param("id")
+	comment.Username, comment.Avatar = author.Username, author.Avatar
+	c.Header("Location", "/api/v1/posts/"+comment.PostId+"/comments/"+comment.Id)
+	c.JSON(http.StatusCreated, gin.H{"data": toAPIComments([]models.Comment{comment}, userId)[0]})
+}
+
+// edit a comment:-
+func APIUpdateComment(c *gin.Context) {
+	comment, ok := readOwnComment(c)
+	if !ok {
+		return
+	}
+	body, ok := readAPIBody(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := database.UpdateComment(ctx, comment.Id, body); err != nil {
+		internal.DatabaseErrorJSON(c, err, "Comment not found.")
+		return
+	}
+	author, err := database.ReadUserById(ctx, comment.UserId)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	comment.Body = body
+	comment.Username, comment.Avatar = author.Username, author.Avatar
+	c.JSON(http.StatusOK, gin.H{"data": toAPIComments([]models.Comment{*comment}, comment.UserId)[0]})
+}
+
+// delete a comment:-
+func APIDeleteComment(c *gin.Context) {
+	comment, ok := readOwnComment(c)
+	if !ok {
+		return
+	}
+	if err := database.DeleteComment(c.Request.Context(), comment.Id); err != nil {
+		internal.DatabaseErrorJSON(c, err, "Comment not found.")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// who voted on a post:-
+func APIVotes(c *gin.Context) {
+	ctx := c.Request.Context()
+	post, err := database.ReadPost(ctx, c.Param("id"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	voters, err := database.ReadVotes(ctx, post.Id)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	if voters == nil {
+		voters = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": voters})
+}
+
+// vote (PUT) or take back a vote (DELETE) on a post:-
+func APIVote(c *gin.Context) {
+	ctx := c.Request.Context()
+	post, err := database.ReadPost(ctx, c.Param("id"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	vote := c.Request.Method == http.MethodPut
+	if _, err := database.SetVote(ctx, middleware.UserId(c), post.Id, vote); err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found.")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"voted": vote}})
+}
@@ -1,12 +1,19 @@
 package routes
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/auth"
+	"github.com/Aniket52kr/GO-Assignment/internal/lockout"
+	"github.com/Aniket52kr/GO-Assignment/internal/password"
 	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/Aniket52kr/GO-Assignment/models"
 	"github.com/gin-contrib/sessions"
@@ -21,6 +28,15 @@ var (
 	secretKey []byte
 )
 
+// dummyUser stands in for usernames that match nobody, so checking their
+// password takes as long as for a real account. It's made on first use,
+// after the bcrypt cost is configured.
+var dummyUser = sync.OnceValue(func() *models.User {
+	user := &models.User{Password: uuid.NewString()}
+	user.HashPassword()
+	return user
+})
+
 func init() {
 	godotenv.Load(".env")
 	issuer = os.Getenv("ISSUER")
@@ -31,7 +47,8 @@ func SignUp(c *gin.Context) {
 	switch c.Request.Method {
 	case "GET":
 		c.HTML(http.StatusOK, "auth.tmpl.html", gin.H{
-			"type": "signup",
+			"type":      "signup",
+			"providers": auth.Enabled(),
 		})
 	case "POST":
 		var user models.User
@@ -59,21 +76,7 @@ func SignUp(c *gin.Context) {
 			user.Email = nil
 		}
 
-		// Check for existing username
-		if database.ReadUserByName(user.Username) != nil {
-			c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
-				"error":   "403 Forbidden",
-				"message": "Username already taken.",
-			})
-			return
-		}
-
-		// Check for existing email
-		if user.Email != nil && database.ReadUserByEmail(*user.Email) != nil {
-			c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
-				"error":   "403 Forbidden",
-				"message": "An account already exists with this email.",
-			})
+		if !checkPassword(c, user.Password, &user) {
 			return
 		}
 
@@ -90,20 +93,28 @@ func SignUp(c *gin.Context) {
 			return
 		}
 
-		if ok := database.CreateUser(&user); !ok {
-			log.Println("Database create user error")
-			c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
-				"error":   "500 Internal Server Error",
-				"message": "Failed to create user account.",
-			})
+		// Check for existing username and email and create the account in one
+		// transaction, so concurrent signups can't both pass the checks
+		ctx := c.Request.Context()
+		if err := database.WithTx(ctx, func(tx database.Store) error {
+			if err := database.UsernameAvailable(ctx, tx, user.Username); err != nil {
+				return err
+			}
+			if user.Email != nil {
+				if err := database.EmailAvailable(ctx, tx, *user.Email); err != nil {
+					return err
+				}
+			}
+			return tx.CreateUser(ctx, &user)
+		}); err != nil {
+			internal.DatabaseError(c, err, internal.ConflictMessage(err))
 			return
 		}
 
-		token, _ := middleware.CreateToken(user.Id)
-		session := sessions.Default(c)
-		session.Set("Authorization", token)
-		session.Set("userId", user.Id)
-		session.Save()
+		if err := middleware.StartSession(c, user.Id); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
 
 		c.Redirect(http.StatusFound, "/auth/verify?signup=true")
 	}
@@ -113,7 +124,8 @@ func Login(c *gin.Context) {
 	switch c.Request.Method {
 	case "GET":
 		c.HTML(http.StatusOK, "auth.tmpl.html", gin.H{
-			"type": "login",
+			"type":      "login",
+			"providers": auth.Enabled(),
 		})
 	case "POST":
 		var login models.Login
@@ -136,31 +148,99 @@ func Login(c *gin.Context) {
 			return
 		}
 
-		user := database.ReadUserByName(login.Username)
-		if user == nil {
-			c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
-				"error":   "401 Unauthorized",
-				"message": "User does not exist.",
-			})
+		user, err := database.ReadUserByName(c.Request.Context(), login.Username)
+		if errors.Is(err, database.ErrNotFound) {
+			user = dummyUser()
+		} else if err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+
+		account := lockout.Account(user.Id, login.Username)
+		if wait, err := lockout.Attempt(c, account); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		} else if wait > 0 {
+			tooManyAttempts(c, wait)
 			return
 		}
 
-		if !user.CheckPassword(login.Password) {
+		// Same message either way, so it doesn't tell which usernames exist
+		if !user.CheckPassword(login.Password) || user == dummyUser() {
+			if err := lockout.Fail(c, account, user.Id, login.Username, "login_failed"); err != nil {
+				internal.DatabaseError(c, err, "")
+				return
+			}
 			c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 				"error":   "401 Unauthorized",
-				"message": "Incorrect password.",
+				"message": "Incorrect username or password.",
 			})
 			return
 		}
+		if err := lockout.Pass(c, account); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
 
-		token, _ := middleware.CreateToken(user.Id)
-		session := sessions.Default(c)
-		session.Set("Authorization", token)
-		session.Set("userId", user.Id)
-		session.Save()
+		// The cost was raised since this hash was made
+		if user.NeedsRehash() {
+			rehashed := models.User{Password: login.Password}
+			if err := rehashed.HashPassword(); err != nil {
+				log.Println(err)
+			} else if err := database.UpdateUser(c.Request.Context(), user.Id, map[string]any{"password": rehashed.Password}); err != nil {
+				log.Println(err)
+			}
+		}
+
+		middleware.LogIn(c, user.Id, "/feed")
+	}
+}
 
-		c.Redirect(http.StatusFound, "/feed")
+// checkPassword renders the error page if newPassword isn't allowed for
+// user by the password policy.
+func checkPassword(c *gin.Context, newPassword string, user *models.User) bool {
+	inputs := []string{user.Username}
+	if user.Email != nil {
+		inputs = append(inputs, *user.Email)
+	}
+	if err := password.Check(newPassword, inputs...); err != nil {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": password.Message(err),
+		})
+		return false
 	}
+	return true
+}
+
+// currentPassword checks the current password posted as field before a
+// settings change, rendering the error page if it's wrong.
+func currentPassword(c *gin.Context, user *models.User, field string) bool {
+	ok, wait, err := lockout.CheckPassword(c, user, c.PostForm(field))
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return false
+	}
+	if wait > 0 {
+		tooManyAttempts(c, wait)
+		return false
+	}
+	if !ok {
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "Incorrect current password.",
+		})
+	}
+	return ok
+}
+
+// tooManyAttempts renders the error page for a login that has to wait.
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+	c.HTML(http.StatusTooManyRequests, "error.tmpl.html", gin.H{
+		"error":   "429 Too Many Requests",
+		"message": "Too many failed attempts, try again in " + lockout.Describe(wait) + ".",
+	})
 }
 
 func Logout(c *gin.Context) {
@@ -175,9 +255,10 @@ func Logout(c *gin.Context) {
 		return
 	}
 
-	session.Clear()
-	session.Options(sessions.Options{MaxAge: -1})
-	session.Save()
+	if err := middleware.EndSession(c); err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
 
 	c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
 		"message": "Logged out successfully.",
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+)
+
+func TestSignUp(t *testing.T) {
+	server := newTestServer(t)
+	browser := newBrowser(t)
+
+	// Logged out to begin with
+	if res, _ := get(t, browser, server.URL+"/feed"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("feed before signup: %d, want 401", res.StatusCode)
+	}
+	res, body := postForm(t, browser, server.URL+"/auth/signup", url.Values{
+		"email":    {"alice@example.com"},
+		"username": {"alice"},
+		"password": {testPassword},
+	})
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") != "/auth/verify?signup=true" {
+		t.Fatalf("signup: %d %s %s", res.StatusCode, res.Header.Get("Location"), body)
+	}
+
+	user, err := database.ReadUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Verified || user.Password == testPassword || *user.Email != "alice@example.com" {
+		t.Errorf("stored user %+v", user)
+	}
+	// And logged in straight away
+	if res, body := get(t, browser, server.URL+"/feed"); res.StatusCode != http.StatusOK {
+		t.Errorf("feed after signup: %d %s", res.StatusCode, body)
+	}
+}
+
+func TestSignUpRejects(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "alice")
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		status  int
+		message string
+	}{
+		{"taken username", url.Values{"email": {"other@example.com"}, "username": {"alice"}, "password": {testPassword}}, http.StatusConflict, "Username already taken."},
+		{"taken email", url.Values{"email": {"alice@example.com"}, "username": {"bob"}, "password": {testPassword}}, http.StatusConflict, "An account already exists with this email."},
+		{"weak password", url.Values{"email": {"bob@example.com"}, "username": {"bob"}, "password": {"password"}}, http.StatusBadRequest, ""},
+		{"missing username", url.Values{"email": {"bob@example.com"}, "password": {testPassword}}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := postForm(t, newBrowser(t), server.URL+"/auth/signup", tt.form)
+			if res.StatusCode != tt.status || !strings.Contains(body, tt.message) {
+				t.Errorf("got %d, want %d %q in:\n%s", res.StatusCode, tt.status, tt.message, body)
+			}
+		})
+	}
+	if _, err := database.ReadUserByName(context.Background(), "bob"); err == nil {
+		t.Error("a rejected signup made an account")
+	}
+}
+
+func TestLogIn(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "alice")
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		status   int
+	}{
+		{"wrong password", "alice", "plum garage violin tundras", http.StatusUnauthorized},
+		{"unknown user", "nobody", testPassword, http.StatusUnauthorized},
+		{"right password", "alice", testPassword, http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browser := newBrowser(t)
+			res, body := postForm(t, browser, server.URL+"/auth/login", url.Values{
+				"username": {tt.username},
+				"password": {tt.password},
+			})
+			if res.StatusCode != tt.status {
+				t.Fatalf("login: %d, want %d\n%s", res.StatusCode, tt.status, body)
+			}
+			feed := http.StatusUnauthorized
+			if tt.status == http.StatusFound {
+				if location := res.Header.Get("Location"); location != "/feed" {
+					t.Errorf("login went to %q, want /feed", location)
+				}
+				feed = http.StatusOK
+			} else if !strings.Contains(body, "Incorrect username or password.") {
+				t.Errorf("login error doesn't say what's wrong:\n%s", body)
+			}
+			if res, _ := get(t, browser, server.URL+"/feed"); res.StatusCode != feed {
+				t.Errorf("feed after login: %d, want %d", res.StatusCode, feed)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+)
+
+// How long the link sent to a new address stays usable
+const emailChangeTTL = 24 * time.Hour
+
+var errEmailChangeExpired = errors.New("email change expired")
+
+// validEmail only accepts a bare address, not "Name <address>".
+func validEmail(address string) bool {
+	parsed, err := netmail.ParseAddress(address)
+	return err == nil && parsed.Address == address && len(address) <= 320
+}
+
+// change the account's email address:-
+func UpdateEmail(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	oauth, err := database.IsOAuthUser(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	user, err := database.ReadUserById(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	switch c.Request.Method {
+	case "GET":
+		var pending string
+		change, err := database.ReadPendingEmailChange(ctx, user.Id)
+		if err == nil && time.Now().Before(change.ExpiresAt) {
+			pending = change.Email
+		} else if err != nil && !errors.Is(err, database.ErrNotFound) {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		c.HTML(http.StatusOK, "update.tmpl.html", gin.H{
+			"type":    "email",
+			"oauth":   oauth,
+			"current": user.Email,
+			"pending": pending,
+		})
+	case "POST":
+		address := strings.TrimSpace(c.PostForm("email"))
+		if !validEmail(address) {
+			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+				"error":   "400 Bad Request",
+				"message": "Enter a valid email address.",
+			})
+			return
+		}
+		// Whoever controls the email can reset the password, so it's as
+		// sensitive as the password itself
+		if !oauth && !currentPassword(c, user, "current") {
+			return
+		}
+		if user.Email != nil && strings.EqualFold(*user.Email, address) {
+			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+				"error":   "400 Bad Request",
+				"message": "This already is your email address.",
+			})
+			return
+		}
+		token, err := newLinkToken()
+		if err != nil {
+			log.Println(err)
+			c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
+				"error":   "500 Internal Server Error",
+				"message": "Unable to change email, try again later.",
+			})
+			return
+		}
+		link, err := internal.MailURL("/auth/email/" + token)
+		if err != nil {
+			log.Println(err)
+			c.HTML(http.StatusServiceUnavailable, "error.tmpl.html", gin.H{
+				"error":   "503 Service Unavailable",
+				"message": "Unable to send confirmation mail, try again later.",
+			})
+			return
+		}
+		now := time.Now()
+		// A new request replaces any earlier one
+		if err := database.WithTx(ctx, func(tx database.Store) error {
+			if err := database.EmailAvailable(ctx, tx, address); err != nil {
+				return err
+			}
+			if err := tx.DeleteEmailChanges(ctx, user.Id); err != nil {
+				return err
+			}
+			return tx.CreateEmailChange(ctx, &models.EmailChange{
+				TokenHash: hashLinkToken(token),
+				UserId:    user.Id,
+				Email:     address,
+				ExpiresAt: now.Add(emailChangeTTL),
+				CreatedAt: now,
+			})
+		}); err != nil {
+			internal.DatabaseError(c, err, internal.ConflictMessage(err))
+			return
+		}
+		if err := mail.Send(address, mail.Locale(c.GetHeader("Accept-Language")), "email_change", gin.H{
+			"Username": user.Username,
+			"Email":    address,
+			"Link":     link,
+		}); err != nil {
+			log.Println(err)
+			c.HTML(http.StatusServiceUnavailable, "error.tmpl.html", gin.H{
+				"error":   "503 Service Unavailable",
+				"message": "Unable to send confirmation mail, try again later.",
+			})
+			return
+		}
+		// The old address hears about it while it's still the account's
+		internal.SecurityAlert(c, user.Id, "email_change_requested", address)
+		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+			"message": "Confirmation mail sent to " + address + ", your email stays the same until you open the link in it.",
+		})
+	}
+}
+
+// readEmailChange looks up the change for token with read and checks it
+// hasn't expired.
+func readEmailChange(ctx context.Context, read func(context.Context, string) (*models.EmailChange, error), token string) (*models.EmailChange, error) {
+	change, err := read(ctx, hashLinkToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(change.ExpiresAt) {
+		return nil, errEmailChangeExpired
+	}
+	return change, nil
+}
+
+// switch to the new address through the link sent to it:-
+func ConfirmEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	token := c.Param("token")
+	var address string
+	// Use up the link and swap the address in one transaction
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		change, err := readEmailChange(ctx, tx.ReadEmailChange, token)
+		if err != nil {
+			return err
+		}
+		address = change.Email
+		// Deleting fails if a concurrent confirmation got here first
+		if err := tx.DeleteEmailChange(ctx, change.TokenHash); err != nil {
+			return err
+		}
+		if err := tx.DeleteEmailChanges(ctx, change.UserId); err != nil {
+			return err
+		}
+		// Reset links mailed to the old address no longer work
+		if err := tx.DeletePasswordResets(ctx, change.UserId); err != nil {
+			return err
+		}
+		// Opening the link proved the new address is theirs
+		return tx.UpdateUser(ctx, change.UserId, map[string]any{"email": change.Email, "verified": true})
+	}); errors.Is(err, database.ErrNotFound) || errors.Is(err, errEmailChangeExpired) {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Email change link is invalid or has expired, request a new one.",
+		})
+		return
+	} else if err != nil {
+		// The address was taken by another account since it was requested
+		internal.DatabaseError(c, err, "An account already exists with this email.")
+		return
+	}
+	c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+		"message": "Email changed to " + address + ".",
+	})
+}
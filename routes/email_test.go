@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+)
+
+func TestEmailChange(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	browser := signUp(t, server, "alice")
+
+	// It takes the current password
+	res, _ := postForm(t, browser, server.URL+"/user/settings/email", url.Values{"email": {"alice@example.net"}, "current": {otherPassword}})
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("change with a wrong password: %d, want 403", res.StatusCode)
+	}
+	res, body := postForm(t, browser, server.URL+"/user/settings/email", url.Values{"email": {"alice@example.net"}, "current": {testPassword}})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("change: %d %s", res.StatusCode, body)
+	}
+	msg := box.next(t)
+	if msg.To != "alice@example.net" {
+		t.Errorf("confirmation went to %s, want the new address", msg.To)
+	}
+	confirm := link(t, msg, "/auth/email/")
+
+	// Nothing changes until the link is opened
+	ctx := context.Background()
+	if user, _ := database.ReadUserByName(ctx, "alice"); *user.Email != "alice@example.com" {
+		t.Errorf("email changed to %s before confirming", *user.Email)
+	}
+	// A reset link sent to the old address meanwhile
+	forgot(t, server, "alice@example.com", "192.0.2.1")
+	reset := link(t, box.next(t), "/auth/reset/")
+
+	if res, body := get(t, newBrowser(t), server.URL+confirm); res.StatusCode != http.StatusOK {
+		t.Fatalf("confirm: %d %s", res.StatusCode, body)
+	}
+	user, _ := database.ReadUserByName(ctx, "alice")
+	if *user.Email != "alice@example.net" || !user.Verified {
+		t.Errorf("after confirming: email %s, verified %v", *user.Email, user.Verified)
+	}
+	// Both links are used up
+	if res, _ := get(t, newBrowser(t), server.URL+confirm); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("confirming twice: %d, want 400", res.StatusCode)
+	}
+	if res, _ := get(t, newBrowser(t), server.URL+reset); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("reset link sent to the old address: %d, want 400", res.StatusCode)
+	}
+}
+
+func TestEmailChangeReplacesLink(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	browser := signUp(t, server, "alice")
+
+	postForm(t, browser, server.URL+"/user/settings/email", url.Values{"email": {"alice@example.net"}, "current": {testPassword}})
+	first := link(t, box.next(t), "/auth/email/")
+	postForm(t, browser, server.URL+"/user/settings/email", url.Values{"email": {"alice@example.org"}, "current": {testPassword}})
+	second := link(t, box.next(t), "/auth/email/")
+
+	if res, _ := get(t, newBrowser(t), server.URL+first); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("replaced link: %d, want 400", res.StatusCode)
+	}
+	if res, _ := get(t, newBrowser(t), server.URL+second); res.StatusCode != http.StatusOK {
+		t.Errorf("new link: %d, want 200", res.StatusCode)
+	}
+	if user, _ := database.ReadUserByName(context.Background(), "alice"); *user.Email != "alice@example.org" {
+		t.Errorf("email is %s, want alice@example.org", *user.Email)
+	}
+}
+
+func TestEmailChangeTaken(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	alice := signUp(t, server, "alice")
+	bob := signUp(t, server, "bob")
+
+	res, body := postForm(t, alice, server.URL+"/user/settings/email", url.Values{"email": {"bob@example.com"}, "current": {testPassword}})
+	if res.StatusCode != http.StatusConflict || !strings.Contains(body, "An account already exists with this email.") {
+		t.Errorf("change to a taken address: %d %s", res.StatusCode, body)
+	}
+	box.none(t)
+
+	// Taken after the link was sent
+	postForm(t, alice, server.URL+"/user/settings/email", url.Values{"email": {"carol@example.com"}, "current": {testPassword}})
+	confirm := link(t, box.next(t), "/auth/email/")
+	postForm(t, bob, server.URL+"/user/settings/email", url.Values{"email": {"carol@example.com"}, "current": {testPassword}})
+	get(t, newBrowser(t), server.URL+link(t, box.next(t), "/auth/email/"))
+	if res, _ := get(t, newBrowser(t), server.URL+confirm); res.StatusCode != http.StatusConflict {
+		t.Errorf("confirming a taken address: %d, want 409", res.StatusCode)
+	}
+	if user, _ := database.ReadUserByName(context.Background(), "alice"); *user.Email != "alice@example.com" {
+		t.Errorf("email is %s, want it unchanged", *user.Email)
+	}
+}
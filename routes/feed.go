@@ -4,44 +4,44 @@ import (
 	"net/http"
 
 	"github.com/Aniket52kr/GO-Assignment/database"
-	"github.com/gin-contrib/sessions"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-var feedLimit = 10
+// pageSize is the number of rows in a page of the feed, posts, comments and
+// search results.
+const pageSize = 10
 
 func UserFeed(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
-	feedLimit = 10
-	posts := database.ReadFeedPosts(id.(string), 10, 0)
-	for index := range posts {
-		author := database.ReadUserById(posts[index].UserId)
-		posts[index].Username = author.Username
-		posts[index].Avatar = author.Avatar
+	ctx := c.Request.Context()
+	posts, next, err := database.ReadFeedPosts(ctx, id, "", pageSize)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
 	}
 	c.HTML(http.StatusOK, "feed.tmpl.html", gin.H{
-		"posts": posts,
+		"posts":      posts,
+		"nextCursor": next,
 	})
 }
 
 // Return feed posts for loading through AJAX
 func LoadMoreFeed(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	posts := database.ReadFeedPosts(id.(string), 10, feedLimit)
-	feedLimit += 10
-	for index := range posts {
-		author := database.ReadUserById(posts[index].UserId)
-		posts[index].Username = author.Username
-		posts[index].Avatar = author.Avatar
+	id := middleware.UserId(c)
+	ctx := c.Request.Context()
+	posts, next, err := database.ReadFeedPosts(ctx, id, c.Query("cursor"), pageSize)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
 	}
-	c.JSON(http.StatusOK, posts)
+	c.JSON(http.StatusOK, gin.H{"posts": toAPIPosts(posts), "next_cursor": next})
 }
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/models"
+)
+
+// writePosts gives username n posts a minute apart, returning their ids
+// newest first.
+func writePosts(t *testing.T, username string, n int) []string {
+	t.Helper()
+	ctx := context.Background()
+	user, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Hour)
+	ids := make([]string, n)
+	for i := range n {
+		post := models.Post{Id: username + strconv.Itoa(i), Body: "post", CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		if err := database.CreatePost(ctx, user.Id, &post); err != nil {
+			t.Fatal(err)
+		}
+		ids[n-1-i] = post.Id
+	}
+	return ids
+}
+
+// walk reads every page of a paginated JSON list, starting at link, and
+// returns the ids in it and how many pages it took.
+func walk(t *testing.T, browser *http.Client, link string, page func(body []byte) ([]string, string)) ([]string, int) {
+	t.Helper()
+	var ids []string
+	pages, cursor := 0, ""
+	for {
+		res, body := get(t, browser, link+"&cursor="+cursor)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("page %d: %d %s", pages, res.StatusCode, body)
+		}
+		got, next := page([]byte(body))
+		ids = append(ids, got...)
+		pages++
+		if next == "" || pages > len(ids) {
+			return ids, pages
+		}
+		cursor = url.QueryEscape(next)
+	}
+}
+
+func equalIds(t *testing.T, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLoadMoreFeed(t *testing.T) {
+	server := newTestServer(t)
+	browser := signUp(t, server, "alice")
+	signUp(t, server, "bob")
+	want := writePosts(t, "bob", 25)
+	alice, _ := database.ReadUserByName(context.Background(), "alice")
+	bob, _ := database.ReadUserByName(context.Background(), "bob")
+	if _, err := database.SetFollow(context.Background(), alice.Id, bob.Id, true); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, pages := walk(t, browser, server.URL+"/feed/more?", func(body []byte) ([]string, string) {
+		var page struct {
+			Posts      []apiPost `json:"posts"`
+			NextCursor string    `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, post := range page.Posts {
+			ids = append(ids, post.Id)
+		}
+		return ids, page.NextCursor
+	})
+	equalIds(t, ids, want)
+	if pages != 3 {
+		t.Errorf("took %d pages of %d, want 3", pages, pageSize)
+	}
+}
+
+func TestAPIUserPostsPages(t *testing.T) {
+	server := newTestServer(t)
+	browser := newBrowser(t)
+	signUp(t, server, "bob")
+	want := writePosts(t, "bob", 5)
+
+	ids, pages := walk(t, browser, server.URL+"/api/v1/users/bob/posts?limit=2", func(body []byte) ([]string, string) {
+		var page struct {
+			Data       []apiPost     `json:"data"`
+			Pagination apiPagination `json:"pagination"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Pagination.Limit != 2 || page.Pagination.HasMore != (page.Pagination.NextCursor != "") {
+			t.Errorf("pagination %+v", page.Pagination)
+		}
+		var ids []string
+		for _, post := range page.Data {
+			ids = append(ids, post.Id)
+		}
+		return ids, page.Pagination.NextCursor
+	})
+	equalIds(t, ids, want)
+	if pages != 3 {
+		t.Errorf("took %d pages, want 3", pages)
+	}
+
+	for _, query := range []string{"?cursor=bogus", "?limit=0", "?limit=51", "?limit=two"} {
+		if res, body := get(t, browser, server.URL+"/api/v1/users/bob/posts"+query); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", query, res.StatusCode, body)
+		}
+	}
+}
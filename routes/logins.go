@@ -0,0 +1,160 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/auth"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// loginMethod is a row of the login methods settings page.
+type loginMethod struct {
+	Name   string
+	Title  string
+	Icon   string
+	Linked bool
+	Since  time.Time
+}
+
+var errLastLogin = errors.New("last login method")
+
+// list the ways the user can log in:-
+func Logins(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	oauth, err := database.IsOAuthUser(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	identities, err := database.ReadIdentities(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	credentials, err := database.ReadCredentials(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+
+	linked := map[string]time.Time{}
+	for _, identity := range identities {
+		linked[identity.Provider] = identity.CreatedAt
+	}
+	var methods []loginMethod
+	for _, p := range auth.Enabled() {
+		since, ok := linked[p.Name()]
+		methods = append(methods, loginMethod{p.Name(), p.Title(), p.Icon(), ok, since})
+		delete(linked, p.Name())
+	}
+	// Providers that have since been switched off can still be removed
+	for _, identity := range identities {
+		if _, ok := linked[identity.Provider]; ok {
+			methods = append(methods, loginMethod{
+				identity.Provider, internal.FormatAsTitle(identity.Provider), "fa-solid fa-link", true, identity.CreatedAt,
+			})
+		}
+	}
+	count := len(identities) + len(credentials)
+	if !oauth {
+		count++
+	}
+	c.HTML(http.StatusOK, "logins.tmpl.html", gin.H{
+		"password":  !oauth,
+		"confirmed": middleware.Confirmed(c),
+		"methods":   methods,
+		"passkeys":  len(credentials),
+		"count":     count,
+	})
+}
+
+// remove a login method:-
+func Unlink(c *gin.Context) {
+	userId := middleware.UserId(c)
+	if userId == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	// The password is asked for even without two-factor authentication
+	if !middleware.ConfirmIdentity(c, c.PostForm("current")) {
+		return
+	}
+	ctx := c.Request.Context()
+	provider := c.Param("provider")
+	// Remove and count under the user's lock, so two removals at once can't
+	// both leave the other one as the last method
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		if err := tx.LockUser(ctx, userId); err != nil {
+			return err
+		}
+		if err := removeLogin(ctx, tx, userId, provider); err != nil {
+			return err
+		}
+		methods, err := database.LoginMethods(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+		if methods == 0 {
+			return errLastLogin
+		}
+		return nil
+	}); errors.Is(err, errLastLogin) {
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "You can't remove your only way to log in, link another one first.",
+		})
+		return
+	} else if err != nil {
+		internal.DatabaseError(c, err, "Login method not found.")
+		return
+	}
+	title := "Password"
+	if provider != "password" {
+		title = internal.FormatAsTitle(provider)
+		if p, ok := auth.Lookup(provider); ok {
+			title = p.Title()
+		}
+	}
+	internal.SecurityAlert(c, userId, "login_removed", title)
+	c.Redirect(http.StatusFound, "/user/settings/logins")
+}
+
+func removeLogin(ctx context.Context, tx database.Store, userId string, provider string) error {
+	if provider != "password" {
+		return tx.DeleteIdentity(ctx, userId, provider)
+	}
+	if oauth, err := tx.IsOAuthUser(ctx, userId); err != nil {
+		return err
+	} else if oauth {
+		return database.ErrNotFound
+	}
+	// Replace the password with one nobody knows, the o_users row is what
+	// marks the account as having none
+	user := models.User{Password: uuid.NewString()}
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+	if err := tx.UpdateUser(ctx, userId, map[string]any{"password": user.Password}); err != nil {
+		return err
+	}
+	return tx.CreateOAuthUser(ctx, userId)
+}
@@ -0,0 +1,247 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/Aniket52kr/GO-Assignment/internal/password"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A password the policy accepts
+const testPassword = "plum garage violin tundra"
+
+// Where links in the mails point
+const testPublicURL = "http://socialecho.test"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Hashing at the real cost would make every signup take a while
+	if err := password.Configure(strconv.Itoa(bcrypt.MinCost), ""); err != nil {
+		panic(err)
+	}
+	// The email templates are found from the repository root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	err := mail.LoadTemplates()
+	if err := errors.Join(err, os.Chdir("routes")); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestServer serves the routes under test like main does, on a new
+// in-memory store.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	database.Use(database.NewMemoryStore())
+	app := gin.New()
+	app.SetFuncMap(template.FuncMap{
+		"formatAsTitle": internal.FormatAsTitle,
+		"formatAsDate":  internal.FormatAsDate,
+	})
+	app.LoadHTMLGlob("../templates/*.html")
+	app.HTMLRender = internal.PageRender{HTMLRender: app.HTMLRender}
+	app.Use(sessions.Sessions("SocialEcho", cookie.NewStore([]byte("test secret"))))
+
+	app.POST("/auth/signup", SignUp)
+	app.POST("/auth/login", Login)
+	app.POST("/auth/forgot", ForgotPassword)
+	app.GET("/auth/reset/:token", ResetPassword)
+	app.POST("/auth/reset/:token", ResetPassword)
+	app.GET("/auth/email/:token", ConfirmEmail)
+	app.GET("/auth/verify", middleware.AuthMiddleware(), SendVerificationMail)
+	app.GET("/auth/verify/:id", Verify)
+	app.POST("/auth/passkey/begin", BeginPasskeyLogin)
+	app.POST("/auth/passkey/finish", FinishPasskeyLogin)
+	app.POST("/auth/2fa/passkey/begin", BeginPasskeyTwoFactor)
+	app.POST("/auth/2fa/passkey/finish", FinishPasskeyTwoFactor)
+	app.POST("/user/settings/passkeys/begin", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), BeginPasskey)
+	app.POST("/user/settings/passkeys/finish", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), FinishPasskey)
+	app.GET("/user/settings/tokens", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), APITokens)
+	app.POST("/user/settings/tokens", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), CreateAPIToken)
+	app.POST("/user/settings/tokens/:id/delete", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), DeleteAPIToken)
+	app.POST("/user/settings/email", middleware.AuthMiddleware(), middleware.TwoFactorMiddleware(), UpdateEmail)
+	app.GET("/feed", middleware.AuthMiddleware(middleware.ScopeRead), UserFeed)
+	app.GET("/feed/more", middleware.AuthMiddleware(middleware.ScopeRead), LoadMoreFeed)
+	app.GET("/api/v1/me", middleware.AuthMiddleware(middleware.ScopeRead), APIMe)
+	app.GET("/api/v1/feed", middleware.AuthMiddleware(middleware.ScopeRead), APIFeed)
+	app.GET("/api/v1/users/:username", middleware.OptionalToken(middleware.ScopeRead), APIUser)
+	app.GET("/api/v1/users/:username/posts", middleware.OptionalToken(middleware.ScopeRead), APIUserPosts)
+	app.GET("/api/v1/users/:username/followers", middleware.OptionalToken(middleware.ScopeRead), APIFollowers)
+	app.GET("/api/v1/users/:username/following", middleware.OptionalToken(middleware.ScopeRead), APIFollowing)
+	app.GET("/api/v1/posts/:id", middleware.OptionalToken(middleware.ScopeRead), APIPost)
+	app.GET("/api/v1/posts/:id/comments", middleware.OptionalToken(middleware.ScopeRead), APIComments)
+	app.GET("/api/v1/search/users", middleware.OptionalToken(middleware.ScopeRead), APISearchUsers)
+	app.GET("/api/v1/search/posts", middleware.OptionalToken(middleware.ScopeRead), APISearchPosts)
+
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newBrowser returns a client that keeps its cookies and doesn't follow
+// redirects, so tests can check where they go.
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// do sends a request and returns the response with its body read.
+func do(t *testing.T, client *http.Client, method string, link string, body io.Reader, contentType string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, link, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return send(t, client, req)
+}
+
+// send sends req and returns the response with its body read.
+func send(t *testing.T, client *http.Client, req *http.Request) (*http.Response, string) {
+	t.Helper()
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(data)
+}
+
+func get(t *testing.T, client *http.Client, link string) (*http.Response, string) {
+	t.Helper()
+	return do(t, client, http.MethodGet, link, nil, "")
+}
+
+func postForm(t *testing.T, client *http.Client, link string, form url.Values) (*http.Response, string) {
+	t.Helper()
+	return do(t, client, http.MethodPost, link, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
+}
+
+// signUp makes an account and returns a browser logged in to it.
+func signUp(t *testing.T, server *httptest.Server, username string) *http.Client {
+	t.Helper()
+	browser := newBrowser(t)
+	res, body := postForm(t, browser, server.URL+"/auth/signup", url.Values{
+		"email":    {username + "@example.com"},
+		"username": {username},
+		"password": {testPassword},
+	})
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("signup: %d %s", res.StatusCode, body)
+	}
+	return browser
+}
+
+// mailbox is a Mailer that keeps what the app sends for the test to read.
+type mailbox chan mail.Message
+
+// newMailbox sends the app's mail to a new mailbox, with testPublicURL
+// for the links in it.
+func newMailbox(t *testing.T) mailbox {
+	t.Helper()
+	if err := internal.ConfigureURLs(testPublicURL, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { internal.ConfigureURLs("", "") })
+	box := make(mailbox, 16)
+	mail.Use(box)
+	return box
+}
+
+func (box mailbox) Send(ctx context.Context, msg mail.Message) error {
+	box <- msg
+	return nil
+}
+
+// next waits for the next mail sent, which goes out from the queue.
+func (box mailbox) next(t *testing.T) mail.Message {
+	t.Helper()
+	select {
+	case msg := <-box:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail was sent")
+		return mail.Message{}
+	}
+}
+
+// none checks that no mail was sent.
+func (box mailbox) none(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-box:
+		t.Errorf("unexpected mail %q to %s", msg.Subject, msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// link returns the path of the link to path in msg, eg. "/auth/reset/<token>".
+func link(t *testing.T, msg mail.Message, path string) string {
+	t.Helper()
+	found := regexp.MustCompile(regexp.QuoteMeta(testPublicURL+path) + `[^\s"<]+`).FindString(msg.Text)
+	if found == "" {
+		t.Fatalf("no %s link in mail %q:\n%s", path, msg.Subject, msg.Text)
+	}
+	return strings.TrimPrefix(found, testPublicURL)
+}
+
+// newAPIToken gives the user called username an API token with scopes.
+func newAPIToken(t *testing.T, username string, scopes ...string) string {
+	t.Helper()
+	ctx := context.Background()
+	user, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, hash := middleware.NewAPIToken()
+	if err := database.CreateAPIToken(ctx, &models.APIToken{
+		Id:        uuid.NewString(),
+		UserId:    user.Id,
+		Name:      "test",
+		TokenHash: hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/passkey"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+)
+
+// passkeyRow is a row of the passkeys settings page.
+type passkeyRow struct {
+	models.Credential
+	Key string // the credential id, base64url encoded for the URL
+}
+
+// list the user's passkeys:-
+func Passkeys(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	credentials, err := database.ReadCredentials(c.Request.Context(), id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	var rows []passkeyRow
+	for _, credential := range credentials {
+		rows = append(rows, passkeyRow{credential, base64.RawURLEncoding.EncodeToString(credential.Id)})
+	}
+	c.HTML(http.StatusOK, "passkeys.tmpl.html", gin.H{
+		"passkeys": rows,
+	})
+}
+
+// start adding a passkey:-
+func BeginPasskey(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not logged in."})
+		return
+	}
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		name = internal.DescribeDevice(c.Request.UserAgent())
+	}
+	creation, err := passkey.BeginRegistration(c, id, internal.Truncate(name, 64))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found.")
+		return
+	}
+	c.JSON(http.StatusOK, creation)
+}
+
+// save the passkey the browser created:-
+func FinishPasskey(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not logged in."})
+		return
+	}
+	credential, err := passkey.FinishRegistration(c, id)
+	if errors.Is(err, passkey.ErrInvalidPasskey) {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The passkey couldn't be added, try again."})
+		return
+	}
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "This passkey is already added.")
+		return
+	}
+	internal.SecurityAlert(c, id, "login_linked", `Passkey "`+credential.Name+`"`)
+	c.JSON(http.StatusOK, gin.H{"redirect": "/user/settings/passkeys"})
+}
+
+// remove a passkey:-
+func DeletePasskey(c *gin.Context) {
+	userId := middleware.UserId(c)
+	if userId == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	key, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
+			"error":   "404 Not Found",
+			"message": "Passkey not found.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	var name string
+	// Same as unlinking a provider, the account must keep a way to log in
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		if err := tx.LockUser(ctx, userId); err != nil {
+			return err
+		}
+		credential, err := tx.ReadCredential(ctx, key)
+		if err != nil {
+			return err
+		}
+		name = credential.Name
+		if err := tx.DeleteCredential(ctx, userId, key); err != nil {
+			return err
+		}
+		methods, err := database.LoginMethods(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+		if methods == 0 {
+			return errLastLogin
+		}
+		return nil
+	}); errors.Is(err, errLastLogin) {
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "You can't remove your only way to log in, link another one first.",
+		})
+		return
+	} else if err != nil {
+		internal.DatabaseError(c, err, "Passkey not found.")
+		return
+	}
+	internal.SecurityAlert(c, userId, "login_removed", `Passkey "`+name+`"`)
+	c.Redirect(http.StatusFound, "/user/settings/passkeys")
+}
+
+// start logging in with a passkey instead of a password:-
+func BeginPasskeyLogin(c *gin.Context) {
+	assertion, err := passkey.BeginLogin(c, passkey.Login, "")
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, assertion)
+}
+
+// log in with the passkey the browser picked:-
+func FinishPasskeyLogin(c *gin.Context) {
+	userId, err := passkey.FinishLogin(c, passkey.Login, "")
+	if errors.Is(err, passkey.ErrInvalidPasskey) {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "That passkey didn't work, try again or log in with your password."})
+		return
+	}
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	if err := middleware.StartSession(c, userId); err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	// The passkey verified the user on their device, that's both factors
+	middleware.ConfirmTwoFactor(c)
+	c.JSON(http.StatusOK, gin.H{"redirect": "/feed"})
+}
+
+// start the second login step with a passkey instead of a code:-
+func BeginPasskeyTwoFactor(c *gin.Context) {
+	userId, _, ok := middleware.PendingLogin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Your login has expired, log in again."})
+		return
+	}
+	assertion, err := passkey.BeginLogin(c, passkey.SecondFactor, userId)
+	if errors.Is(err, passkey.ErrInvalidPasskey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You have no passkeys, enter a code instead."})
+		return
+	}
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, assertion)
+}
+
+// finish the second login step with a passkey:-
+func FinishPasskeyTwoFactor(c *gin.Context) {
+	userId, attempts, ok := middleware.PendingLogin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Your login has expired, log in again."})
+		return
+	}
+	if _, err := passkey.FinishLogin(c, passkey.SecondFactor, userId); errors.Is(err, passkey.ErrInvalidPasskey) {
+		log.Println(err)
+		middleware.FailLogin(c, attempts)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "That passkey didn't work, try again or enter a code."})
+		return
+	} else if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	next, err := middleware.FinishLogin(c, userId)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redirect": next})
+}
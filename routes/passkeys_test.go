@@ -0,0 +1,416 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// authenticator is a software passkey: a P-256 key pair with a counter. It
+// answers the options of the passkey routes the way a browser passes on
+// what a hardware authenticator says.
+type authenticator struct {
+	t         *testing.T
+	origin    string
+	id        []byte
+	key       *ecdsa.PrivateKey
+	userId    []byte // the user handle stored with the credential
+	signCount uint32
+}
+
+func newAuthenticator(t *testing.T, server *httptest.Server) *authenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &authenticator{t: t, origin: server.URL, id: id, key: key}
+}
+
+// clientData is what the browser says it asked the authenticator.
+func (a *authenticator) clientData(kind string, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      kind,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func (a *authenticator) authData(rpId string, flags byte, attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// create answers the options of navigator.credentials.create().
+func (a *authenticator) create(options string) string {
+	a.t.Helper()
+	var creation struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RP        struct {
+				Id string `json:"id"`
+			} `json:"rp"`
+			User struct {
+				Id string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal([]byte(options), &creation); err != nil {
+		a.t.Fatalf("%v in %s", err, options)
+	}
+	userId, err := b64.DecodeString(creation.PublicKey.User.Id)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.userId = userId
+
+	coordinate := func(n []byte) []byte {
+		return append(make([]byte, 32-len(n)), n...)
+	}
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: coordinate(a.key.X.Bytes()),
+		YCoord: coordinate(a.key.Y.Bytes()),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	attested := make([]byte, 16) // no AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(append(attested, a.id...), publicKey...)
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(creation.PublicKey.RP.Id, flagUserPresent|flagUserVerified|flagAttested, attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]any{
+		"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", creation.PublicKey.Challenge)),
+		"attestationObject": b64.EncodeToString(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get answers the options of navigator.credentials.get(), after counting
+// the use.
+func (a *authenticator) get(options string) string {
+	a.t.Helper()
+	a.signCount++
+	return a.getCounted(options)
+}
+
+// getCounted answers with the counter as it is, eg. one that was set back.
+func (a *authenticator) getCounted(options string) string {
+	a.t.Helper()
+	var assertion struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RPId      string `json:"rpId"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal([]byte(options), &assertion); err != nil {
+		a.t.Fatalf("%v in %s", err, options)
+	}
+	clientData := a.clientData("webauthn.get", assertion.PublicKey.Challenge)
+	authData := a.authData(assertion.PublicKey.RPId, flagUserPresent|flagUserVerified, nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]any{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userId),
+	})
+}
+
+func (a *authenticator) credential(response map[string]any) string {
+	data, err := json.Marshal(map[string]any{
+		"id":       b64.EncodeToString(a.id),
+		"rawId":    b64.EncodeToString(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func postJSON(t *testing.T, client *http.Client, link string, body string) (*http.Response, string) {
+	t.Helper()
+	return do(t, client, http.MethodPost, link, strings.NewReader(body), "application/json")
+}
+
+// addPasskey registers a new software passkey on the logged in browser.
+func addPasskey(t *testing.T, server *httptest.Server, browser *http.Client) *authenticator {
+	t.Helper()
+	a := newAuthenticator(t, server)
+	res, options := postForm(t, browser, server.URL+"/user/settings/passkeys/begin", url.Values{"name": {"Laptop"}})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("begin registration: %d %s", res.StatusCode, options)
+	}
+	if res, body := postJSON(t, browser, server.URL+"/user/settings/passkeys/finish", a.create(options)); res.StatusCode != http.StatusOK {
+		t.Fatalf("finish registration: %d %s", res.StatusCode, body)
+	}
+	return a
+}
+
+// passkeyLogin logs a new browser in with a, returning it and the status.
+func passkeyLogin(t *testing.T, server *httptest.Server, answer func(options string) string) (*http.Client, int) {
+	t.Helper()
+	browser := newBrowser(t)
+	res, options := postJSON(t, browser, server.URL+"/auth/passkey/begin", "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("begin login: %d %s", res.StatusCode, options)
+	}
+	res, _ = postJSON(t, browser, server.URL+"/auth/passkey/finish", answer(options))
+	return browser, res.StatusCode
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	server := newTestServer(t)
+	browser := signUp(t, server, "alice")
+	a := addPasskey(t, server, browser)
+
+	alice, err := database.ReadUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a.userId) != alice.Id {
+		t.Errorf("user handle is %q, want the user id %q", a.userId, alice.Id)
+	}
+	credentials, err := database.ReadCredentials(context.Background(), alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 1 || !bytes.Equal(credentials[0].Id, a.id) || credentials[0].Name != "Laptop" {
+		t.Fatalf("stored passkeys %+v", credentials)
+	}
+
+	// The same authenticator can't be added twice, it's excluded
+	res, options := postForm(t, browser, server.URL+"/user/settings/passkeys/begin", nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(options, b64.EncodeToString(a.id)) {
+		t.Errorf("begin registration doesn't exclude the passkey: %d %s", res.StatusCode, options)
+	}
+
+	// Nor can a challenge be answered twice
+	b := newAuthenticator(t, server)
+	answer := b.create(options)
+	if res, body := postJSON(t, browser, server.URL+"/user/settings/passkeys/finish", answer); res.StatusCode != http.StatusOK {
+		t.Fatalf("finish registration: %d %s", res.StatusCode, body)
+	}
+	if res, _ := postJSON(t, browser, server.URL+"/user/settings/passkeys/finish", answer); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("replayed registration: %d, want 400", res.StatusCode)
+	}
+
+	// Logged out browsers can't add any
+	if res, _ := postForm(t, newBrowser(t), server.URL+"/user/settings/passkeys/begin", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("begin registration logged out: %d, want 401", res.StatusCode)
+	}
+}
+
+func TestPasskeyRegistrationRejectsOtherOrigin(t *testing.T) {
+	server := newTestServer(t)
+	browser := signUp(t, server, "alice")
+	a := newAuthenticator(t, server)
+	a.origin = "https://evil.example"
+	_, options := postForm(t, browser, server.URL+"/user/settings/passkeys/begin", nil)
+	if res, _ := postJSON(t, browser, server.URL+"/user/settings/passkeys/finish", a.create(options)); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("passkey from another origin: %d, want 400", res.StatusCode)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	server := newTestServer(t)
+	a := addPasskey(t, server, signUp(t, server, "alice"))
+
+	browser, status := passkeyLogin(t, server, a.get)
+	if status != http.StatusOK {
+		t.Fatalf("passkey login: %d", status)
+	}
+	if res, body := get(t, browser, server.URL+"/feed"); res.StatusCode != http.StatusOK {
+		t.Errorf("feed after passkey login: %d %s", res.StatusCode, body)
+	}
+
+	// A finish without a begin has no challenge to answer
+	if res, _ := postJSON(t, newBrowser(t), server.URL+"/auth/passkey/finish", a.get(`{"publicKey":{}}`)); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("finish without begin: %d, want 401", res.StatusCode)
+	}
+}
+
+func TestPasskeySignCountRegression(t *testing.T) {
+	server := newTestServer(t)
+	a := addPasskey(t, server, signUp(t, server, "alice"))
+	a.signCount = 10
+	if _, status := passkeyLogin(t, server, a.getCounted); status != http.StatusOK {
+		t.Fatalf("login at count 10: %d", status)
+	}
+
+	// A copy of the key that's behind, or reuses the last count, is refused
+	for _, count := range []uint32{10, 5} {
+		a.signCount = count
+		if _, status := passkeyLogin(t, server, a.getCounted); status != http.StatusUnauthorized {
+			t.Errorf("login at count %d after 10: %d, want 401", count, status)
+		}
+	}
+	credential, err := database.ReadCredential(context.Background(), a.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.SignCount != 10 {
+		t.Errorf("stored count is %d, want 10", credential.SignCount)
+	}
+
+	a.signCount = 10
+	if _, status := passkeyLogin(t, server, a.get); status != http.StatusOK {
+		t.Errorf("login at count 11: %d", status)
+	}
+}
+
+func TestPasskeyOfAnotherUser(t *testing.T) {
+	server := newTestServer(t)
+	signUp(t, server, "alice")
+	mallory := addPasskey(t, server, signUp(t, server, "mallory"))
+	alice, err := database.ReadUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mallory's passkey claiming to be for Alice
+	mallory.userId = []byte(alice.Id)
+	if _, status := passkeyLogin(t, server, mallory.get); status != http.StatusUnauthorized {
+		t.Errorf("login as alice with mallory's passkey: %d, want 401", status)
+	}
+}
+
+// enableTwoFactor turns two-factor authentication on for username.
+func enableTwoFactor(t *testing.T, username string) {
+	t.Helper()
+	ctx := context.Background()
+	user, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTwoFactor(ctx, &models.TwoFactor{UserId: user.Id, Secret: "JBSWY3DPEHPK3PXP", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.EnableTwoFactor(ctx, user.Id, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// passwordLogin logs a new browser in with username's password, up to the
+// second factor.
+func passwordLogin(t *testing.T, server *httptest.Server, username string) *http.Client {
+	t.Helper()
+	browser := newBrowser(t)
+	res, body := postForm(t, browser, server.URL+"/auth/login", url.Values{"username": {username}, "password": {testPassword}})
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") != "/auth/2fa" {
+		t.Fatalf("login: %d %s %s", res.StatusCode, res.Header.Get("Location"), body)
+	}
+	return browser
+}
+
+// secondFactor answers the second login step of browser with answer.
+func secondFactor(t *testing.T, server *httptest.Server, browser *http.Client, answer func(options string) string) (int, string) {
+	t.Helper()
+	res, options := postJSON(t, browser, server.URL+"/auth/2fa/passkey/begin", "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("begin second factor: %d %s", res.StatusCode, options)
+	}
+	res, body := postJSON(t, browser, server.URL+"/auth/2fa/passkey/finish", answer(options))
+	return res.StatusCode, body
+}
+
+func TestPasskeySecondFactor(t *testing.T) {
+	server := newTestServer(t)
+	a := addPasskey(t, server, signUp(t, server, "alice"))
+	enableTwoFactor(t, "alice")
+
+	browser := passwordLogin(t, server, "alice")
+	if res, _ := get(t, browser, server.URL+"/feed"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("feed before the second factor: %d, want 401", res.StatusCode)
+	}
+	status, body := secondFactor(t, server, browser, a.get)
+	if status != http.StatusOK || !strings.Contains(body, `"redirect":"/feed"`) {
+		t.Fatalf("second factor: %d %s", status, body)
+	}
+	if res, body := get(t, browser, server.URL+"/feed"); res.StatusCode != http.StatusOK {
+		t.Errorf("feed after the second factor: %d %s", res.StatusCode, body)
+	}
+
+	// Without a password first there's no login to finish
+	if res, _ := postJSON(t, newBrowser(t), server.URL+"/auth/2fa/passkey/begin", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("second factor without a password: %d, want 401", res.StatusCode)
+	}
+}
+
+func TestPasskeySecondFactorOfAnotherUser(t *testing.T) {
+	server := newTestServer(t)
+	addPasskey(t, server, signUp(t, server, "alice"))
+	mallory := addPasskey(t, server, signUp(t, server, "mallory"))
+	enableTwoFactor(t, "alice")
+
+	// Alice's password with Mallory's passkey as the second factor
+	browser := passwordLogin(t, server, "alice")
+	if status, body := secondFactor(t, server, browser, mallory.get); status != http.StatusUnauthorized {
+		t.Fatalf("second factor with mallory's passkey: %d %s, want 401", status, body)
+	}
+	if res, _ := get(t, browser, server.URL+"/feed"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("feed after a refused second factor: %d, want 401", res.StatusCode)
+	}
+
+	// And with the user handle changed to Alice's
+	alice, err := database.ReadUserByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory.userId = []byte(alice.Id)
+	if status, body := secondFactor(t, server, browser, mallory.get); status != http.StatusUnauthorized {
+		t.Errorf("second factor with mallory's passkey as alice: %d %s, want 401", status, body)
+	}
+}
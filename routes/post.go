@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/Aniket52kr/GO-Assignment/models"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -12,12 +14,9 @@ import (
 	"github.com/google/uuid"
 )
 
-var commentLimit = 10
-
 func NewPost(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
@@ -45,11 +44,8 @@ func NewPost(c *gin.Context) {
 		}
 		post.Id = uuid.NewString()
 		post.CreatedAt = time.Now()
-		if result := database.CreatePost(id.(string), &post); !result {
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to create post, try again later.",
-			})
+		if err := database.CreatePost(c.Request.Context(), id, &post); err != nil {
+			internal.DatabaseError(c, err, "User not found.")
 			return
 		}
 		c.Redirect(http.StatusFound, "/post/"+post.Id)
@@ -58,21 +54,21 @@ func NewPost(c *gin.Context) {
 
 func GetPost(c *gin.Context) {
 	var self, voted bool
+	ctx := c.Request.Context()
 	session := sessions.Default(c)
 	id := session.Get("userId")
 	postId := c.Param("id")
-	post := database.ReadPost(postId)
-	if post == nil {
-		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
-			"error":   "404 Not Found",
-			"message": "Post not found or doesn't exist.",
-		})
+	post, err := database.ReadPost(ctx, postId)
+	if err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
+		return
+	}
+	comments, next, err := database.ReadComments(ctx, post.Id, "", pageSize)
+	if err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
 		return
 	}
-	commentLimit = 10
-	comments := database.ReadComments(post.Id, 10, 0)
 	for index := range comments {
-		comments[index].Username = database.ReadUserById(comments[index].UserId).Username
 		// Enable delete comment if its current user's comment
 		if id != nil && id.(string) == comments[index].UserId {
 			comments[index].Self = true
@@ -80,63 +76,76 @@ func GetPost(c *gin.Context) {
 	}
 	if id != nil {
 		// Check if current user has voted on post
-		voted = database.Voted(id.(string), post.Id)
+		if voted, err = database.Voted(ctx, id.(string), post.Id); err != nil {
+			internal.DatabaseError(c, err, "Post not found or doesn't exist.")
+			return
+		}
 		// Enable delete post if its current user's post
 		if id.(string) == post.UserId {
 			self = true
 		}
 	}
+	author, err := database.ReadUserById(ctx, post.UserId)
+	if err != nil {
+		internal.DatabaseError(c, err, "Post author not found.")
+		return
+	}
+	voters, err := database.ReadVotes(ctx, post.Id)
+	if err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
+		return
+	}
 	c.HTML(http.StatusOK, "getPost.tmpl.html", gin.H{
-		"author":   database.ReadUserById(post.UserId),
-		"post":     post,
-		"self":     self,
-		"voted":    voted,
-		"voters":   database.ReadVotes(post.Id),
-		"comments": comments,
+		"author":     author,
+		"post":       post,
+		"self":       self,
+		"voted":      voted,
+		"voters":     voters,
+		"comments":   comments,
+		"nextCursor": next,
 	})
 }
 
 // Return comments for loading through AJAX
 func LoadMoreComments(c *gin.Context) {
+	ctx := c.Request.Context()
 	session := sessions.Default(c)
-	id := session.Get("userId")
+	id, _ := session.Get("userId").(string)
 	postId := c.Param("id")
-	comments := database.ReadComments(postId, 10, commentLimit)
-	commentLimit += 10
-	for index := range comments {
-		comments[index].Username = database.ReadUserById(comments[index].UserId).Username
-		// Enable delete comment if its current user's comment
-		if id != nil && id.(string) == comments[index].UserId {
-			comments[index].Self = true
-		}
+	comments, next, err := database.ReadComments(ctx, postId, c.Query("cursor"), pageSize)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "Post not found or doesn't exist.")
+		return
 	}
-	c.JSON(http.StatusOK, comments)
+	// Self enables deleting the current user's comments
+	c.JSON(http.StatusOK, gin.H{"comments": toAPIComments(comments, id), "next_cursor": next})
 }
 
 func DeletePost(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
+	ctx := c.Request.Context()
 	postId := c.Param("id")
-	post := database.ReadPost(postId)
-	if id.(string) != post.UserId {
+	post, err := database.ReadPost(ctx, postId)
+	if err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
+		return
+	}
+	if id != post.UserId {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "Cannot perform this task.",
 		})
 		return
 	}
-	if result := database.DeletePost(post.Id); !result {
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to delete post, try again later.",
-		})
+	if err := database.DeletePost(ctx, post.Id); err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
 		return
 	}
 	c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
@@ -145,9 +154,8 @@ func DeletePost(c *gin.Context) {
 }
 
 func ToggleVote(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
@@ -155,14 +163,16 @@ func ToggleVote(c *gin.Context) {
 		return
 	}
 	postId := c.Param("id")
-	database.ToggleVote(id.(string), postId)
+	if _, err := database.ToggleVote(c.Request.Context(), id, postId); err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
+		return
+	}
 	c.Redirect(http.StatusFound, "/post/"+postId)
 }
 
 func Comment(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
@@ -187,48 +197,39 @@ func Comment(c *gin.Context) {
 	postId := c.Param("id")
 	comment.Id = uuid.NewString()
 	comment.CreatedAt = time.Now()
-	if result := database.CreateComment(id.(string), postId, &comment); !result {
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to add comment, try again later.",
-		})
+	if err := database.CreateComment(c.Request.Context(), id, postId, &comment); err != nil {
+		internal.DatabaseError(c, err, "Post not found or doesn't exist.")
 		return
 	}
 	c.Redirect(http.StatusFound, "/post/"+postId)
 }
 
 func DeleteComment(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
+	ctx := c.Request.Context()
 	postId := c.Param("id")
 	commentId := c.Query("commentId")
-	comment := database.ReadComment(commentId)
-	if comment == nil {
-		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
-			"error":   "404 Not Found",
-			"message": "Comment not found.",
-		})
+	comment, err := database.ReadComment(ctx, commentId)
+	if err != nil {
+		internal.DatabaseError(c, err, "Comment not found.")
 		return
 	}
-	if id.(string) != comment.UserId {
+	if id != comment.UserId {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "Cannot perform this task.",
 		})
 		return
 	}
-	if result := database.DeleteComment(commentId); !result {
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to delete comment, try again later.",
-		})
+	if err := database.DeleteComment(ctx, commentId); err != nil {
+		internal.DatabaseError(c, err, "Comment not found.")
 		return
 	}
 	c.Redirect(http.StatusFound, "/post/"+postId)
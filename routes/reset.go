@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/lockout"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// How long a reset link stays usable
+const resetTTL = time.Hour
+
+// Shown whether or not the email belongs to an account, so the form can't
+// be used to find out who is registered
+const resetSent = "If an account exists for that email, a link to reset its password is on its way."
+
+var errResetExpired = errors.New("password reset expired")
+
+// Reset mails are limited per account like verification mails, and per IP
+// more loosely, as every request from it counts whether or not the email is
+// registered
+var resetIPLimit = mailLimit{10 * time.Second, 10, time.Hour}
+
+// resetKey counts the reset mails sent to userId.
+func resetKey(userId string) string {
+	return "reset:" + userId
+}
+
+// resetIPKey counts the reset requests made from ip.
+func resetIPKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// hashLinkToken is what's stored for the token of an emailed link (a
+// password reset or an email change), the token itself only exists in the
+// link.
+func hashLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newLinkToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// request a password reset link:-
+func ForgotPassword(c *gin.Context) {
+	switch c.Request.Method {
+	case "GET":
+		c.HTML(http.StatusOK, "reset.tmpl.html", gin.H{
+			"type": "forgot",
+		})
+	case "POST":
+		// Checked before the address, so the answer doesn't depend on it
+		resetURL, err := internal.MailURL("/auth/reset/")
+		if err != nil {
+			log.Println(err)
+			c.HTML(http.StatusServiceUnavailable, "error.tmpl.html", gin.H{
+				"error":   "503 Service Unavailable",
+				"message": "Password reset mails can't be sent, try again later.",
+			})
+			return
+		}
+		ctx := c.Request.Context()
+		if wait, err := reserveMail(ctx, resetIPKey(c.ClientIP()), resetIPLimit); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		} else if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			c.HTML(http.StatusTooManyRequests, "error.tmpl.html", gin.H{
+				"error":   "429 Too Many Requests",
+				"message": "Too many password reset requests, try again in " + lockout.Describe(wait) + ".",
+			})
+			return
+		}
+		address := strings.TrimSpace(c.PostForm("email"))
+		user, err := database.ReadUserByEmail(ctx, address)
+		if errors.Is(err, database.ErrNotFound) || address == "" {
+			c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+				"message": resetSent,
+			})
+			return
+		} else if err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		// Too soon for another mail to this account, the earlier link still
+		// works. Answered like any other request, so it doesn't tell that the
+		// email is registered.
+		if wait, err := reserveMail(ctx, resetKey(user.Id), resendLimit); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		} else if wait > 0 {
+			c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+				"message": resetSent,
+			})
+			return
+		}
+
+		token, err := newLinkToken()
+		if err != nil {
+			log.Println(err)
+			c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
+				"error":   "500 Internal Server Error",
+				"message": "Unable to reset password, try again later.",
+			})
+			return
+		}
+		now := time.Now()
+		// A new link replaces any earlier one
+		if err := database.WithTx(ctx, func(tx database.Store) error {
+			if err := tx.DeletePasswordResets(ctx, user.Id); err != nil {
+				return err
+			}
+			return tx.CreatePasswordReset(ctx, &models.PasswordReset{
+				TokenHash: hashLinkToken(token),
+				UserId:    user.Id,
+				ExpiresAt: now.Add(resetTTL),
+				CreatedAt: now,
+			})
+		}); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+
+		// A failure is only logged, so the answer is the same as for an
+		// unknown email. A registered one still takes longer to answer, as
+		// it means writing the reset to the database.
+		if err := mail.Send(*user.Email, mail.Locale(c.GetHeader("Accept-Language")), "reset", gin.H{
+			"Username": user.Username,
+			"Link":     resetURL + token,
+		}); err != nil {
+			log.Println(err)
+		}
+		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+			"message": resetSent,
+		})
+	}
+}
+
+// readReset looks up the reset for token with read and checks it hasn't
+// expired.
+func readReset(ctx context.Context, read func(context.Context, string) (*models.PasswordReset, error), token string) (*models.PasswordReset, error) {
+	reset, err := read(ctx, hashLinkToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		return nil, errResetExpired
+	}
+	return reset, nil
+}
+
+// choose a new password through an emailed link:-
+func ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+	token := c.Param("token")
+	switch c.Request.Method {
+	case "GET":
+		if _, err := readReset(ctx, database.ReadPasswordReset, token); err != nil {
+			resetError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "reset.tmpl.html", gin.H{
+			"type":  "reset",
+			"token": token,
+		})
+	case "POST":
+		newPassword := c.PostForm("password")
+		reset, err := readReset(ctx, database.ReadPasswordReset, token)
+		if err != nil {
+			resetError(c, err)
+			return
+		}
+		owner, err := database.ReadUserById(ctx, reset.UserId)
+		if err != nil {
+			internal.DatabaseError(c, err, "User not found.")
+			return
+		}
+		if !checkPassword(c, newPassword, owner) {
+			return
+		}
+		user := models.User{Password: newPassword}
+		if err := user.HashPassword(); err != nil {
+			log.Println(err)
+			c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
+				"error":   "500 Internal Server Error",
+				"message": "Failed to hash password.",
+			})
+			return
+		}
+		// Use up the link, set the password, log out every session and
+		// revoke every API token in one transaction
+		var userId string
+		if err := database.WithTx(ctx, func(tx database.Store) error {
+			reset, err := readReset(ctx, tx.ReadPasswordReset, token)
+			if err != nil {
+				return err
+			}
+			userId = reset.UserId
+			// Deleting fails if a concurrent reset got here first
+			if err := tx.DeletePasswordReset(ctx, reset.TokenHash); err != nil {
+				return err
+			}
+			if err := tx.DeletePasswordResets(ctx, reset.UserId); err != nil {
+				return err
+			}
+			if err := tx.UpdateUser(ctx, reset.UserId, map[string]any{"password": user.Password}); err != nil {
+				return err
+			}
+			if oauth, err := tx.IsOAuthUser(ctx, reset.UserId); err != nil {
+				return err
+			} else if oauth {
+				// The account now has a password to log in with
+				if err := tx.DeleteOAuthUser(ctx, reset.UserId); err != nil {
+					return err
+				}
+			}
+			// Log out every device and API client, the old password may have
+			// leaked
+			if err := tx.DeleteSessions(ctx, reset.UserId, ""); err != nil {
+				return err
+			}
+			return tx.DeleteAPITokens(ctx, reset.UserId)
+		}); err != nil {
+			resetError(c, err)
+			return
+		}
+		session := sessions.Default(c)
+		session.Clear()
+		session.Save()
+		internal.SecurityAlert(c, userId, "password_reset", "")
+		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+			"message": "Password reset successfully, log in with your new password.",
+		})
+	}
+}
+
+func resetError(c *gin.Context, err error) {
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, errResetExpired) {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Password reset link is invalid or has expired, request a new one.",
+		})
+		return
+	}
+	internal.DatabaseError(c, err, "")
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// A different password the policy accepts
+const otherPassword = "cobalt lantern meadow quiver"
+
+// forgot asks for a reset link for email as if from ip.
+func forgot(t *testing.T, server *httptest.Server, email string, ip string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/auth/forgot", strings.NewReader(url.Values{"email": {email}}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", ip)
+	return send(t, newBrowser(t), req)
+}
+
+func TestPasswordReset(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	old := signUp(t, server, "alice")
+	token := newAPIToken(t, "alice", "read")
+
+	res, body := forgot(t, server, "alice@example.com", "192.0.2.1")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, resetSent) {
+		t.Fatalf("forgot: %d %s", res.StatusCode, body)
+	}
+	msg := box.next(t)
+	if msg.To != "alice@example.com" {
+		t.Errorf("reset mail went to %s", msg.To)
+	}
+	reset := link(t, msg, "/auth/reset/")
+	browser := newBrowser(t)
+	if res, body := get(t, browser, server.URL+reset); res.StatusCode != http.StatusOK {
+		t.Fatalf("reset page: %d %s", res.StatusCode, body)
+	}
+	if res, body := postForm(t, browser, server.URL+reset, url.Values{"password": {otherPassword}}); res.StatusCode != http.StatusOK {
+		t.Fatalf("reset: %d %s", res.StatusCode, body)
+	}
+
+	// The link is used up
+	if res, _ := postForm(t, browser, server.URL+reset, url.Values{"password": {testPassword}}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("second reset with the same link: %d, want 400", res.StatusCode)
+	}
+	// Every session and API token is gone
+	if res, _ := get(t, old, server.URL+"/feed"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("feed on a session from before the reset: %d, want 401", res.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/users/alice/posts", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if res, _ := send(t, newBrowser(t), req); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("API token from before the reset: %d, want 401", res.StatusCode)
+	}
+	// Only the new password logs in
+	for password, status := range map[string]int{testPassword: http.StatusUnauthorized, otherPassword: http.StatusFound} {
+		if res, _ := postForm(t, newBrowser(t), server.URL+"/auth/login", url.Values{"username": {"alice"}, "password": {password}}); res.StatusCode != status {
+			t.Errorf("login with %q: %d, want %d", password, res.StatusCode, status)
+		}
+	}
+}
+
+func TestPasswordResetReplacesLink(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	signUp(t, server, "alice")
+	// No waiting between mails to the account
+	defer func(limit mailLimit) { resendLimit = limit }(resendLimit)
+	resendLimit = mailLimit{}
+
+	forgot(t, server, "alice@example.com", "192.0.2.1")
+	first := link(t, box.next(t), "/auth/reset/")
+	forgot(t, server, "alice@example.com", "192.0.2.2")
+	second := link(t, box.next(t), "/auth/reset/")
+
+	if res, _ := get(t, newBrowser(t), server.URL+first); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("replaced link: %d, want 400", res.StatusCode)
+	}
+	if res, _ := get(t, newBrowser(t), server.URL+second); res.StatusCode != http.StatusOK {
+		t.Errorf("new link: %d, want 200", res.StatusCode)
+	}
+}
+
+func TestPasswordResetLimits(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	signUp(t, server, "alice")
+
+	// An unknown email gets the same answer, and no mail
+	res, body := forgot(t, server, "nobody@example.com", "192.0.2.1")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, resetSent) {
+		t.Errorf("unknown email: %d %s", res.StatusCode, body)
+	}
+	box.none(t)
+
+	// The same IP has to wait before asking again
+	if res, _ := forgot(t, server, "alice@example.com", "192.0.2.1"); res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Errorf("second request from an IP: %d, want 429 with Retry-After", res.StatusCode)
+	}
+	box.none(t)
+
+	// Another IP gets a mail, then the account has to wait, without the
+	// answer telling
+	if res, _ := forgot(t, server, "alice@example.com", "192.0.2.2"); res.StatusCode != http.StatusOK {
+		t.Fatalf("first request for the account: %d", res.StatusCode)
+	}
+	box.next(t)
+	res, body = forgot(t, server, "alice@example.com", "192.0.2.3")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, resetSent) {
+		t.Errorf("second request for the account: %d %s", res.StatusCode, body)
+	}
+	box.none(t)
+}
@@ -1,94 +1,124 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/Aniket52kr/GO-Assignment/database"
-	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-var searchLimit = 10
-
-type search struct {
-	models.User
-	Followers int
-	Following int
-	Posts     int
-	Follows   any
-}
-
-// search user by name:-
-func SearchUser(c *gin.Context) {
+// search people and posts:-
+func Search(c *gin.Context) {
 	session := sessions.Default(c)
 	switch c.Request.Method {
 	case "GET":
-		searchLimit = 10
 		session.Delete("search")
 		session.Save()
 		c.HTML(http.StatusOK, "search.tmpl.html", nil)
 	case "POST":
-		id := session.Get("userId")
+		id, _ := session.Get("userId").(string)
 		if c.PostForm("search") != "" {
 			session.Set("search", c.PostForm("search"))
 			session.Save()
 		}
-		keyword := session.Get("search").(string)
-		searchLimit = 10
-		searchResult := database.ReadUsers(keyword, 10, 0)
-		var users []search
-		for _, result := range searchResult {
-			user := search{
-				User:      result,
-				Followers: database.ReadFollowersCount(result.Id),
-				Following: database.ReadFollowingCount(result.Id),
-				Posts:     database.ReadPostsCount(result.Id),
-			}
-			if id != nil && id.(string) != result.Id {
-				user.Follows = database.Followed(id.(string), result.Id)
-			}
-			users = append(users, user)
+		keyword, _ := session.Get("search").(string)
+		results, err := searchResults(c.Request.Context(), id, keyword, c.PostForm("type"), "")
+		if err != nil {
+			internal.DatabaseErrorJSON(c, err, "")
+			return
 		}
-		c.JSON(http.StatusOK, users)
+		c.JSON(http.StatusOK, results)
 	}
 }
 
-// Return users for loading through AJAX
-func LoadMoreUsers(c *gin.Context) {
+// Return search results for loading through AJAX
+func LoadMoreResults(c *gin.Context) {
 	session := sessions.Default(c)
-	id := session.Get("userId")
-	keyword := session.Get("search").(string)
-	searchResult := database.ReadUsers(keyword, 10, searchLimit)
-	searchLimit += 10
-	var users []search
-	for _, result := range searchResult {
-		user := search{
-			User:      result,
-			Followers: database.ReadFollowersCount(result.Id),
-			Following: database.ReadFollowingCount(result.Id),
-			Posts:     database.ReadPostsCount(result.Id),
+	id, _ := session.Get("userId").(string)
+	keyword, _ := session.Get("search").(string)
+	results, err := searchResults(c.Request.Context(), id, keyword, c.Query("type"), c.Query("cursor"))
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// searchResults runs keyword against the "posts" or (by default) "people"
+// tab and returns the page to send back.
+func searchResults(ctx context.Context, id string, keyword string, tab string, cursor string) (gin.H, error) {
+	query := database.ParseSearchQuery(keyword)
+	if tab == "posts" {
+		posts, next, err := database.SearchPosts(ctx, query, cursor, pageSize)
+		if err != nil {
+			return nil, err
 		}
-		if id != nil && id.(string) != result.Id {
-			user.Follows = database.Followed(id.(string), result.Id)
+		return gin.H{"posts": toAPIPosts(posts), "next_cursor": next}, nil
+	}
+	users, next, err := searchUsers(ctx, id, query, cursor, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"users": users, "next_cursor": next}, nil
+}
+
+// searchUsers reads a page of users matching query together with their
+// counts, and whether the current user (id, "" if logged out) follows them.
+func searchUsers(ctx context.Context, id string, query database.SearchQuery, cursor string, limit int) ([]apiUser, string, error) {
+	searchResult, next, err := database.SearchUsers(ctx, query, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	followed := map[string]bool{}
+	if id != "" {
+		ids := make([]string, len(searchResult))
+		for i, result := range searchResult {
+			ids[i] = result.Id
+		}
+		if followed, err = database.ReadFollowedIds(ctx, id, ids); err != nil {
+			return nil, "", err
+		}
+	}
+	users := make([]apiUser, 0, len(searchResult))
+	for _, result := range searchResult {
+		user := toAPIUser(result)
+		if id != "" && id != result.Id {
+			follows := followed[result.Id]
+			user.Follows = &follows
 		}
 		users = append(users, user)
 	}
-	c.JSON(http.StatusOK, users)
+	return users, next, nil
 }
 
 // toggle search follow:-
 func ToggleSearchFollow(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
+	ctx := c.Request.Context()
 	username := c.Param("username")
-	toFollow := database.ReadUserByName(username)
-	database.ToggleFollow(id.(string), toFollow.Id)
+	toFollow, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found")
+		return
+	}
+	follows, err := database.ToggleFollow(ctx, id, toFollow.Id)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found")
+		return
+	}
+	if follows {
+		notifyFollowed(c, id, toFollow)
+	}
+	c.JSON(http.StatusOK, gin.H{"follows": follows})
 }
@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// activeSession is a row of the active sessions settings page.
+type activeSession struct {
+	Id         string
+	Device     string
+	UserAgent  string
+	IP         string
+	Location   string
+	Current    bool
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// list the devices the user is logged in on:-
+func Sessions(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	found, err := database.ReadSessions(c.Request.Context(), id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	current := c.GetString("sessionId")
+	now := time.Now()
+	var active []activeSession
+	for _, s := range found {
+		if !s.ExpiresAt.After(now) {
+			continue
+		}
+		row := activeSession{
+			Id:         s.Id,
+			Device:     internal.DescribeDevice(s.Device),
+			UserAgent:  s.Device,
+			IP:         s.IP,
+			Location:   s.Location,
+			Current:    s.Id == current,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+		}
+		// This device goes first
+		if row.Current {
+			active = append([]activeSession{row}, active...)
+		} else {
+			active = append(active, row)
+		}
+	}
+	c.HTML(http.StatusOK, "sessions.tmpl.html", gin.H{
+		"sessions": active,
+	})
+}
+
+// log out one device:-
+func LogoutSession(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	if c.Param("id") == c.GetString("sessionId") {
+		if err := middleware.EndSession(c); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+			"message": "Logged out successfully.",
+		})
+		return
+	}
+	if err := database.DeleteSession(c.Request.Context(), id, c.Param("id")); err != nil {
+		internal.DatabaseError(c, err, "Session not found, it may have already ended.")
+		return
+	}
+	c.Redirect(http.StatusFound, "/user/settings/sessions")
+}
+
+// log out every device but this one:-
+func LogoutOtherSessions(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	if err := database.DeleteSessions(c.Request.Context(), id, c.GetString("sessionId")); err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.Redirect(http.StatusFound, "/user/settings/sessions")
+}
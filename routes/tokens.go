@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// How many API tokens an account can have
+const maxAPITokens = 20
+
+// scopesFor lists the scopes userId can give a token, admin only for admins.
+func scopesFor(userId string) []string {
+	if middleware.IsAdmin(userId) {
+		return middleware.Scopes
+	}
+	return slices.DeleteFunc(slices.Clone(middleware.Scopes), func(scope string) bool {
+		return scope == middleware.ScopeAdmin
+	})
+}
+
+func renderAPITokens(c *gin.Context, userId string, status int, created string) {
+	tokens, err := database.ReadAPITokens(c.Request.Context(), userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.HTML(status, "apiTokens.tmpl.html", gin.H{
+		"tokens":  tokens,
+		"scopes":  scopesFor(userId),
+		"created": created,
+	})
+}
+
+// list the user's API tokens:-
+func APITokens(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	renderAPITokens(c, id, http.StatusOK, "")
+}
+
+// create an API token, shown only this once:-
+func CreateAPIToken(c *gin.Context) {
+	userId := middleware.UserId(c)
+	if userId == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	name := internal.Truncate(strings.TrimSpace(c.PostForm("name")), 64)
+	if name == "" {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Give the token a name, eg. what script uses it.",
+		})
+		return
+	}
+	allowed := scopesFor(userId)
+	var scopes []string
+	for _, scope := range allowed {
+		if slices.Contains(c.PostFormArray("scopes"), scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
+			"error":   "400 Bad Request",
+			"message": "Pick at least one scope.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	existing, err := database.ReadAPITokens(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	if len(existing) >= maxAPITokens {
+		c.HTML(http.StatusConflict, "error.tmpl.html", gin.H{
+			"error":   "409 Conflict",
+			"message": "You have too many API tokens, revoke some first.",
+		})
+		return
+	}
+	token, hash := middleware.NewAPIToken()
+	if err := database.CreateAPIToken(ctx, &models.APIToken{
+		Id:        uuid.NewString(),
+		UserId:    userId,
+		Name:      name,
+		TokenHash: hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	internal.SecurityAlert(c, userId, "api_token_created", name)
+	renderAPITokens(c, userId, http.StatusCreated, token)
+}
+
+// revoke an API token:-
+func DeleteAPIToken(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	tokens, err := database.ReadAPITokens(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	index := slices.IndexFunc(tokens, func(token models.APIToken) bool {
+		return token.Id == c.Param("id")
+	})
+	if index < 0 {
+		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
+			"error":   "404 Not Found",
+			"message": "API token not found.",
+		})
+		return
+	}
+	if err := database.DeleteAPIToken(ctx, id, tokens[index].Id); err != nil {
+		internal.DatabaseError(c, err, "API token not found.")
+		return
+	}
+	internal.SecurityAlert(c, id, "api_token_revoked", tokens[index].Name)
+	c.Redirect(http.StatusFound, "/user/settings/tokens")
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+)
+
+// bearerGet sends a GET with an API token.
+func bearerGet(t *testing.T, link string, token string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return send(t, newBrowser(t), req)
+}
+
+func TestAPITokens(t *testing.T) {
+	server := newTestServer(t)
+	browser := signUp(t, server, "alice")
+	ctx := context.Background()
+
+	res, body := postForm(t, browser, server.URL+"/user/settings/tokens", url.Values{"name": {"CI bot"}, "scopes": {"read", "admin"}})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %s", res.StatusCode, body)
+	}
+	token := regexp.MustCompile(`se_[A-Za-z0-9_-]+`).FindString(body)
+	if token == "" {
+		t.Fatalf("new token not shown:\n%s", body)
+	}
+	user, _ := database.ReadUserByName(ctx, "alice")
+	stored, err := database.ReadAPITokens(ctx, user.Id)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("stored tokens: %+v %v", stored, err)
+	}
+	// Only its hash is kept, and admin isn't for everyone
+	if stored[0].TokenHash == token || strings.Contains(stored[0].TokenHash, token) {
+		t.Error("token stored as is")
+	}
+	if len(stored[0].Scopes) != 1 || stored[0].Scopes[0] != "read" {
+		t.Errorf("scopes %v, want [read]", stored[0].Scopes)
+	}
+	// It's shown once
+	res, body = get(t, browser, server.URL+"/user/settings/tokens")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "CI bot") || strings.Contains(body, token) || strings.Contains(body, stored[0].TokenHash) {
+		t.Errorf("token list: %d\n%s", res.StatusCode, body)
+	}
+	if res, _ := bearerGet(t, server.URL+"/api/v1/users/alice/posts", token); res.StatusCode != http.StatusOK {
+		t.Errorf("using the token: %d", res.StatusCode)
+	}
+	// Tokens can't reach the settings
+	if res, _ := bearerGet(t, server.URL+"/user/settings/tokens", token); res.StatusCode != http.StatusForbidden {
+		t.Errorf("settings with a token: %d, want 403", res.StatusCode)
+	}
+
+	// Someone else can't revoke it
+	bob := signUp(t, server, "bob")
+	if res, _ := postForm(t, bob, server.URL+"/user/settings/tokens/"+stored[0].Id+"/delete", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("revoking another user's token: %d, want 404", res.StatusCode)
+	}
+	if res, _ := postForm(t, browser, server.URL+"/user/settings/tokens/"+stored[0].Id+"/delete", nil); res.StatusCode != http.StatusFound {
+		t.Fatalf("revoke: %d", res.StatusCode)
+	}
+	if res, _ := bearerGet(t, server.URL+"/api/v1/users/alice/posts", token); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked token: %d, want 401", res.StatusCode)
+	}
+}
+
+func TestAPITokenRejects(t *testing.T) {
+	server := newTestServer(t)
+	browser := signUp(t, server, "alice")
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"no name", url.Values{"scopes": {"read"}}},
+		{"no scopes", url.Values{"name": {"bot"}}},
+		{"only admin", url.Values{"name": {"bot"}, "scopes": {"admin"}}},
+		{"unknown scope", url.Values{"name": {"bot"}, "scopes": {"everything"}}},
+	}
+	for _, tt := range tests {
+		if res, _ := postForm(t, browser, server.URL+"/user/settings/tokens", tt.form); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", tt.name, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package routes
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/lockout"
+	"github.com/Aniket52kr/GO-Assignment/internal/twofactor"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
+	"github.com/gin-gonic/gin"
+)
+
+var errTwoFactorOn = errors.New("two-factor authentication already on")
+
+// second login step for users with two-factor authentication:-
+func TwoFactorLogin(c *gin.Context) {
+	userId, attempts, ok := middleware.PendingLogin(c)
+	if !ok {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "Your login has expired, log in again.",
+		})
+		return
+	}
+	switch c.Request.Method {
+	case "GET":
+		credentials, err := database.ReadCredentials(c.Request.Context(), userId)
+		if err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		c.HTML(http.StatusOK, "twoFactor.tmpl.html", gin.H{
+			"type":     "login",
+			"passkeys": len(credentials) > 0,
+		})
+	case "POST":
+		// The attempts in the cookie start over with each password, so the
+		// account's failures are counted too
+		account := lockout.Account(userId, "")
+		if wait, err := lockout.Attempt(c, account); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		} else if wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+		err := twofactor.Verify(c.Request.Context(), userId, c.PostForm("code"))
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			middleware.FailLogin(c, attempts)
+			if err := lockout.Fail(c, account, userId, "", "two_factor_failed"); err != nil {
+				internal.DatabaseError(c, err, "")
+				return
+			}
+			message := "Incorrect code, try again."
+			if _, _, ok := middleware.PendingLogin(c); !ok {
+				message = "Too many incorrect codes, log in again."
+			}
+			c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+				"error":   "401 Unauthorized",
+				"message": message,
+			})
+			return
+		}
+		if err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		if err := lockout.Pass(c, account); err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		next, err := middleware.FinishLogin(c, userId)
+		if err != nil {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		c.Redirect(http.StatusFound, next)
+	}
+}
+
+// two-factor settings:-
+func TwoFactor(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	enabled, err := twofactor.Enabled(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	codes, err := database.CountRecoveryCodes(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.HTML(http.StatusOK, "twoFactor.tmpl.html", gin.H{
+		"type":    "settings",
+		"enabled": enabled,
+		"codes":   codes,
+	})
+}
+
+// start enrolling an authenticator app:-
+func SetUpTwoFactor(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	secret, err := twofactor.NewSecret()
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	// Start over if an earlier enrollment was never confirmed
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		existing, err := tx.ReadTwoFactor(ctx, id)
+		if err == nil && existing.Enabled() {
+			return errTwoFactorOn
+		} else if err == nil {
+			if err := tx.DeleteTwoFactor(ctx, id); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		return tx.CreateTwoFactor(ctx, &models.TwoFactor{
+			UserId:    id,
+			Secret:    secret,
+			CreatedAt: time.Now(),
+		})
+	}); errors.Is(err, errTwoFactorOn) {
+		c.HTML(http.StatusConflict, "error.tmpl.html", gin.H{
+			"error":   "409 Conflict",
+			"message": "Two-factor authentication is already on.",
+		})
+		return
+	} else if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	renderSetup(c, id, secret, http.StatusOK, "")
+}
+
+func renderSetup(c *gin.Context, userId string, secret string, status int, message string) {
+	user, err := database.ReadUserById(c.Request.Context(), userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	qr, err := twofactor.QRCode(twofactor.URI(secret, user.Username))
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.HTML(status, "twoFactor.tmpl.html", gin.H{
+		"type":    "setup",
+		"qr":      template.URL(qr), // a data: URI we made ourselves
+		"secret":  secret,
+		"message": message,
+	})
+}
+
+// confirm the enrollment with a first code:-
+func EnableTwoFactor(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	pending, err := database.ReadTwoFactor(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "Set up two-factor authentication first.")
+		return
+	}
+	if pending.Enabled() {
+		c.HTML(http.StatusConflict, "error.tmpl.html", gin.H{
+			"error":   "409 Conflict",
+			"message": "Two-factor authentication is already on.",
+		})
+		return
+	}
+	step, ok := twofactor.Check(pending.Secret, c.PostForm("code"), time.Now())
+	if !ok {
+		renderSetup(c, id, pending.Secret, http.StatusBadRequest, "That code didn't match, check your app's clock and try again.")
+		return
+	}
+	if err := database.EnableTwoFactor(ctx, id, step, time.Now()); err != nil {
+		internal.DatabaseError(c, err, "Set up two-factor authentication first.")
+		return
+	}
+	codes, err := twofactor.NewRecoveryCodes(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	middleware.ConfirmTwoFactor(c)
+	internal.SecurityAlert(c, id, "two_factor_enabled", "")
+	c.HTML(http.StatusOK, "twoFactor.tmpl.html", gin.H{
+		"type":  "codes",
+		"codes": codes,
+	})
+}
+
+// turn two-factor authentication off:-
+func DisableTwoFactor(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	if !checkCode(c, id) {
+		return
+	}
+	if err := database.DeleteTwoFactor(ctx, id); err != nil {
+		internal.DatabaseError(c, err, "Two-factor authentication is already off.")
+		return
+	}
+	internal.SecurityAlert(c, id, "two_factor_disabled", "")
+	c.Redirect(http.StatusFound, "/user/settings/2fa")
+}
+
+// replace the recovery codes:-
+func NewRecoveryCodes(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	if !checkCode(c, id) {
+		return
+	}
+	codes, err := twofactor.NewRecoveryCodes(c.Request.Context(), id)
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	}
+	c.HTML(http.StatusOK, "twoFactor.tmpl.html", gin.H{
+		"type":  "codes",
+		"codes": codes,
+	})
+}
+
+// ask for a code again before a sensitive settings change:-
+func ConfirmTwoFactor(c *gin.Context) {
+	id := middleware.UserId(c)
+	if id == "" {
+		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
+			"error":   "401 Unauthorized",
+			"message": "User not logged in.",
+		})
+		return
+	}
+	switch c.Request.Method {
+	case "GET":
+		c.HTML(http.StatusOK, "twoFactor.tmpl.html", gin.H{
+			"type": "confirm",
+			"next": middleware.SafeNext(c.Query("next")),
+		})
+	case "POST":
+		if !checkCode(c, id) {
+			return
+		}
+		middleware.ConfirmTwoFactor(c)
+		c.Redirect(http.StatusFound, middleware.SafeNext(c.PostForm("next")))
+	}
+}
+
+// checkCode verifies the code posted with a form, rendering the error page
+// if it's wrong.
+func checkCode(c *gin.Context, userId string) bool {
+	account := lockout.Account(userId, "")
+	if wait, err := lockout.Attempt(c, account); err != nil {
+		internal.DatabaseError(c, err, "")
+		return false
+	} else if wait > 0 {
+		tooManyAttempts(c, wait)
+		return false
+	}
+	err := twofactor.Verify(c.Request.Context(), userId, c.PostForm("code"))
+	if errors.Is(err, twofactor.ErrInvalidCode) {
+		if err := lockout.Fail(c, account, userId, "", "two_factor_failed"); err != nil {
+			internal.DatabaseError(c, err, "")
+			return false
+		}
+		c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
+			"error":   "403 Forbidden",
+			"message": "Incorrect code.",
+		})
+		return false
+	}
+	if err != nil {
+		internal.DatabaseError(c, err, "")
+		return false
+	}
+	if err := lockout.Pass(c, account); err != nil {
+		internal.DatabaseError(c, err, "")
+		return false
+	}
+	return true
+}
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -10,114 +12,156 @@ import (
 	"os"
 
 	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
+	"github.com/Aniket52kr/GO-Assignment/middleware"
+	"github.com/Aniket52kr/GO-Assignment/models"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-var postLimit = 5
-
 // get user:-
 func GetUser(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	userId := middleware.UserId(c)
+	if userId == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
-	userId := id.(string)
-	c.HTML(http.StatusOK, "user.tmpl.html", gin.H{
-		"settings":  true,
-		"user":      database.ReadUserById(userId),
-		"postCount": database.ReadPostsCount(userId),
-		"followers": database.ReadFollowers(userId),
-		"following": database.ReadFollowing(userId),
-		"posts":     database.ReadPosts(userId, 5, 0),
-		"oauth":     database.IsOAuthUser(userId),
-	})
+	ctx := c.Request.Context()
+	user, err := database.ReadUserById(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	profile, err := readProfile(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	oauth, err := database.IsOAuthUser(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	profile["settings"] = true
+	profile["user"] = user
+	profile["oauth"] = oauth
+	c.HTML(http.StatusOK, "user.tmpl.html", profile)
+}
+
+// readProfile loads the follower lists, post count and recent posts shown on
+// a profile page.
+func readProfile(ctx context.Context, userId string) (gin.H, error) {
+	postCount, err := database.ReadPostsCount(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := database.ReadFollowers(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	following, err := database.ReadFollowing(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	posts, _, err := database.ReadPosts(ctx, userId, "", 5)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"postCount": postCount,
+		"followers": followers,
+		"following": following,
+		"posts":     posts,
+	}, nil
 }
 
 // get user by name:-
 func GetUserByName(c *gin.Context) {
+	ctx := c.Request.Context()
 	username := c.Param("username")
 	session := sessions.Default(c)
 	id := session.Get("userId")
 	if id != nil {
-		user := database.ReadUserById(id.(string))
-		if username == user.Username {
+		current, err := database.ReadUserById(ctx, id.(string))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			internal.DatabaseError(c, err, "")
+			return
+		}
+		if current != nil && username == current.Username {
 			c.Redirect(http.StatusFound, "/user/")
 			return
 		}
 	}
-	user := database.ReadUserByName(username)
-	if user == nil {
-		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
-			"error":   "404 Not Found",
-			"message": "User not found",
-		})
+	user, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found")
 		return
 	}
 	user.Email = nil
-	followers := database.ReadFollowers(user.Id)
-	following := database.ReadFollowing(user.Id)
-	postCount := database.ReadPostsCount(user.Id)
-	posts := database.ReadPosts(user.Id, 5, 0)
+	profile, err := readProfile(ctx, user.Id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found")
+		return
+	}
+	profile["user"] = user
 
 	if id != nil {
-		c.HTML(http.StatusOK, "user.tmpl.html", gin.H{
-			"user":      user,
-			"postCount": postCount,
-			"followers": followers,
-			"following": following,
-			"posts":     posts,
-			"follows":   database.Followed(id.(string), user.Id),
-		})
-		return
+		follows, err := database.Followed(ctx, id.(string), user.Id)
+		if err != nil {
+			internal.DatabaseError(c, err, "User not found")
+			return
+		}
+		profile["follows"] = follows
 	}
-	c.HTML(http.StatusOK, "user.tmpl.html", gin.H{
-		"user":      user,
-		"postCount": postCount,
-		"followers": followers,
-		"following": following,
-		"posts":     posts,
-	})
+	c.HTML(http.StatusOK, "user.tmpl.html", profile)
 }
 
 // get user post:-
 func GetUserPosts(c *gin.Context) {
+	ctx := c.Request.Context()
 	username := c.Param("username")
-	user := database.ReadUserByName(username)
-	if user == nil {
-		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
-			"error":   "404 Not Found",
-			"message": "User not found",
-		})
+	user, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found")
+		return
+	}
+	posts, next, err := database.ReadPosts(ctx, user.Id, "", pageSize)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found")
 		return
 	}
-	postLimit = 10
-	posts := database.ReadPosts(user.Id, 10, 0)
 	c.HTML(http.StatusOK, "userPosts.tmpl.html", gin.H{
-		"user":  user,
-		"posts": posts,
+		"user":       user,
+		"posts":      posts,
+		"nextCursor": next,
 	})
 }
 
 // Return posts for loading through AJAX
 func LoadMorePosts(c *gin.Context) {
+	ctx := c.Request.Context()
 	username := c.Param("username")
-	user := database.ReadUserByName(username)
-	posts := database.ReadPosts(user.Id, 10, postLimit)
-	postLimit += 10
-	c.JSON(http.StatusOK, posts)
+	user, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found")
+		return
+	}
+	posts, next, err := database.ReadPosts(ctx, user.Id, c.Query("cursor"), pageSize)
+	if err != nil {
+		internal.DatabaseErrorJSON(c, err, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"posts": toAPIPosts(posts), "next_cursor": next})
 }
 
 // update user profile picture:-
 func UpdateAvatar(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
@@ -171,15 +215,13 @@ func UpdateAvatar(c *gin.Context) {
 			return
 		}
 		// Update user avatar URL
-		if result := database.UpdateUser(
-			id.(string),
+		if err := database.UpdateUser(
+			c.Request.Context(),
+			id,
 			map[string]any{"avatar": responseData["image"].(map[string]interface{})["url"]},
-		); !result {
+		); err != nil {
 			log.Println(responseData)
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to update avatar, try again later.",
-			})
+			internal.DatabaseError(c, err, "User not found.")
 			return
 		}
 		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
@@ -190,9 +232,8 @@ func UpdateAvatar(c *gin.Context) {
 
 // update user name:-
 func UpdateUsername(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
@@ -205,27 +246,23 @@ func UpdateUsername(c *gin.Context) {
 			"type": "username",
 		})
 	case "POST":
+		ctx := c.Request.Context()
 		newUsername := c.PostForm("username")
-		user := database.ReadUserById(id.(string))
-		if user.Username == newUsername {
-			c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
-				"error":   "403 Forbidden",
-				"message": "New username cannot be the same as current.",
-			})
+		user, err := database.ReadUserById(ctx, id)
+		if err != nil {
+			internal.DatabaseError(c, err, "User not found.")
 			return
 		}
-		if exists := database.ReadUserByName(newUsername); exists != nil {
+		if user.Username == newUsername {
 			c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
 				"error":   "403 Forbidden",
-				"message": "Username not available or already taken.",
+				"message": "New username cannot be the same as current.",
 			})
 			return
 		}
-		if result := database.UpdateUser(user.Id, map[string]any{"username": newUsername}); !result {
-			c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
-				"error":   "500 Internal Server Error",
-				"message": "Unable to change username, try again later.",
-			})
+		// The unique key on username rejects names that are already taken
+		if err := database.UpdateUser(ctx, user.Id, map[string]any{"username": newUsername}); err != nil {
+			internal.DatabaseError(c, err, "Username not available or already taken.")
 			return
 		}
 		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
@@ -236,23 +273,37 @@ func UpdateUsername(c *gin.Context) {
 
 // update password:-
 func UpdatePassword(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
+	ctx := c.Request.Context()
+	oauth, err := database.IsOAuthUser(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
 	switch c.Request.Method {
 	case "GET":
 		c.HTML(http.StatusOK, "update.tmpl.html", gin.H{
-			"type": "password",
+			"type":  "password",
+			"oauth": oauth,
 		})
 	case "POST":
 		newPassword := c.PostForm("password")
-		user := database.ReadUserById(id.(string))
+		user, err := database.ReadUserById(ctx, id)
+		if err != nil {
+			internal.DatabaseError(c, err, "User not found.")
+			return
+		}
+		// Users who signed up through OAuth have no password to give yet
+		if !oauth && !currentPassword(c, user, "current") {
+			return
+		}
 		if user.CheckPassword(newPassword) {
 			c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
 				"error":   "403 Forbidden",
@@ -260,56 +311,77 @@ func UpdatePassword(c *gin.Context) {
 			})
 			return
 		}
+		if !checkPassword(c, newPassword, user) {
+			return
+		}
 		// Create hash of new password and update it
 		user.Password = newPassword
-		user.HashPassword()
-		if result := database.UpdateUser(id.(string), map[string]any{"password": user.Password}); !result {
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to change password, try again later.",
+		if err := user.HashPassword(); err != nil {
+			log.Println("Password hashing error:", err)
+			c.HTML(http.StatusInternalServerError, "error.tmpl.html", gin.H{
+				"error":   "500 Internal Server Error",
+				"message": "Failed to hash password.",
 			})
 			return
 		}
+		if err := database.WithTx(ctx, func(tx database.Store) error {
+			if err := tx.UpdateUser(ctx, user.Id, map[string]any{"password": user.Password}); err != nil {
+				return err
+			}
+			// Setting a password adds password login to an OAuth account
+			if oauth, err := tx.IsOAuthUser(ctx, user.Id); err != nil {
+				return err
+			} else if oauth {
+				if err := tx.DeleteOAuthUser(ctx, user.Id); err != nil {
+					return err
+				}
+			}
+			// Other devices have to log in with the new password
+			return tx.DeleteSessions(ctx, user.Id, c.GetString("sessionId"))
+		}); err != nil {
+			internal.DatabaseError(c, err, "User not found.")
+			return
+		}
+		internal.SecurityAlert(c, user.Id, "password_changed", "")
 		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
-			"message": "Password updated successfully",
+			"message": "Password updated successfully, your other devices were logged out.",
 		})
 	}
 }
 
 // Delete user:-
 func DeleteUser(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
+	ctx := c.Request.Context()
+	oauth, err := database.IsOAuthUser(ctx, id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
 	switch c.Request.Method {
 	case "GET":
 		c.HTML(http.StatusOK, "delete.tmpl.html", gin.H{
-			"oauth": database.IsOAuthUser(id.(string)),
+			"oauth": oauth,
 		})
 	case "POST":
-		user := database.ReadUserById(id.(string))
+		user, err := database.ReadUserById(ctx, id)
+		if err != nil {
+			internal.DatabaseError(c, err, "User not found.")
+			return
+		}
 		// Password required for users who didn't sign up through OAuth
-		if !database.IsOAuthUser(user.Id) {
-			password := c.PostForm("password")
-			if !user.CheckPassword(password) {
-				c.HTML(http.StatusForbidden, "error.tmpl.html", gin.H{
-					"error":   "403 Forbidden",
-					"message": "Incorrect password.",
-				})
-				return
-			}
+		if !oauth && !currentPassword(c, user, "password") {
+			return
 		}
-		if result := database.DeleteUser(user.Id); !result {
-			c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-				"error":   "400 Bad Request",
-				"message": "Unable to delete account, try again later.",
-			})
+		if err := database.DeleteUser(ctx, user.Id); err != nil {
+			internal.DatabaseError(c, err, "User not found.")
 			return
 		}
 		session := sessions.Default(c)
@@ -324,17 +396,53 @@ func DeleteUser(c *gin.Context) {
 
 // follow user:-
 func ToggleFollow(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
+	ctx := c.Request.Context()
 	username := c.Param("username")
-	toFollow := database.ReadUserByName(username)
-	database.ToggleFollow(id.(string), toFollow.Id)
+	toFollow, err := database.ReadUserByName(ctx, username)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found")
+		return
+	}
+	follows, err := database.ToggleFollow(ctx, id, toFollow.Id)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found")
+		return
+	}
+	if follows {
+		notifyFollowed(c, id, toFollow)
+	}
 	c.Redirect(http.StatusFound, "/user/"+username)
 }
+
+// notifyFollowed mails a user that followerId started following them. Their
+// language isn't known, so it goes out in the default one.
+func notifyFollowed(c *gin.Context, followerId string, followed *models.User) {
+	if followed.Email == nil || !followed.Verified {
+		return
+	}
+	follower, err := database.ReadUserById(c.Request.Context(), followerId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	link, err := internal.MailURL("/user/" + url.PathEscape(follower.Username))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := mail.Send(*followed.Email, "", "follower", gin.H{
+		"Username": followed.Username,
+		"Follower": follower.Username,
+		"Link":     link,
+	}); err != nil {
+		log.Println(err)
+	}
+}
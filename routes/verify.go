@@ -2,41 +2,62 @@ package routes
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/Aniket52kr/GO-Assignment/database"
+	"github.com/Aniket52kr/GO-Assignment/internal"
+	"github.com/Aniket52kr/GO-Assignment/internal/lockout"
+	"github.com/Aniket52kr/GO-Assignment/internal/mail"
 	"github.com/Aniket52kr/GO-Assignment/middleware"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/jordan-wright/email"
-	"golang.org/x/oauth2"
-	"google.golang.org/api/gmail/v1"
-	"google.golang.org/api/option"
 )
 
-const verificationMail = `<html>
-<head></head>
-<body
-	style="
-	font-family: 'Courier New', Courier, monospace;
-	padding-left: 15px;
-	padding-top: 10px;
-	"
->
-	<h1>SocialEcho</h1>
-	<h2>Account Verification</h2>
-	<p>
-	Hi %s, please confirm that %s is your e-mail address by clicking this link %s within 48 hours.
-	</p>
-</body>
-</html>`
+// mailLimit spaces out the mails sent under a key: every apart, and after
+// count of them in a row until window has passed since the last.
+type mailLimit struct {
+	every  time.Duration
+	count  int
+	window time.Duration
+}
+
+var resendLimit = mailLimit{time.Minute, 5, time.Hour}
+
+// resendKey counts the verification mails sent to userId.
+func resendKey(userId string) string {
+	return "verify:" + userId
+}
+
+// reserveMail counts a mail about to be sent under key, or returns how long
+// until one can be if it's too soon, counting nothing. Counting it before
+// it's sent keeps requests at the same time from each sending one.
+func reserveMail(ctx context.Context, key string, l mailLimit) (time.Duration, error) {
+	var wait time.Duration
+	err := database.WithTx(ctx, func(tx database.Store) error {
+		sends, err := tx.LockMailSends(ctx, key)
+		if err != nil {
+			return err
+		}
+		if sends.Sent > 0 {
+			every := l.every
+			if sends.Sent >= l.count {
+				every = l.window
+			}
+			if wait = time.Until(sends.LastSentAt.Add(every)); wait > 0 {
+				return nil
+			}
+		}
+		now := time.Now()
+		_, err = tx.RecordMailSend(ctx, key, now, now.Add(-l.window))
+		return err
+	})
+	return max(wait, 0), err
+}
 
 // create verification Token:-
 func createVerificationToken(id string) (string, error) {
@@ -52,91 +73,62 @@ func createVerificationToken(id string) (string, error) {
 	return token.SignedString(secretKey)
 }
 
-// Create Token:-
-func oauth2Client() (*http.Client, error) {
-	credentials := oauth2.Config{
-		ClientID:     os.Getenv("CLIENT_ID"),
-		ClientSecret: os.Getenv("CLIENT_SECRET"),
-		Scopes:       []string{"https://mail.google.com/"},
-		Endpoint: oauth2.Endpoint{
-			TokenURL: os.Getenv("TOKEN_URI"),
-		},
-	}
-	expiry, _ := time.Parse(time.RFC3339, os.Getenv("EXPIRY"))
-	token := oauth2.Token{
-		AccessToken:  os.Getenv("TOKEN"),
-		RefreshToken: os.Getenv("REFRESH_TOKEN"),
-		Expiry:       expiry,
-	}
-	ctx := context.Background()
-	if !token.Valid() {
-		// Refresh the token
-		refreshedToken, err := credentials.TokenSource(ctx, &token).Token()
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-		os.Setenv("TOKEN", refreshedToken.AccessToken)
-		os.Setenv("REFRESH_TOKEN", refreshedToken.RefreshToken)
-		os.Setenv("EXPIRY", refreshedToken.Expiry.String())
-		return credentials.Client(ctx, refreshedToken), nil
-	}
-	return credentials.Client(ctx, &token), nil
-}
-
 // send varification email:-
 func SendVerificationMail(c *gin.Context) {
-	session := sessions.Default(c)
-	id := session.Get("userId")
-	if id == nil {
+	id := middleware.UserId(c)
+	if id == "" {
 		c.HTML(http.StatusUnauthorized, "error.tmpl.html", gin.H{
 			"error":   "401 Unauthorized",
 			"message": "User not logged in.",
 		})
 		return
 	}
-	client, err := oauth2Client()
+	ctx := c.Request.Context()
+	user, err := database.ReadUserById(ctx, id)
 	if err != nil {
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to send verification mail, try again later.",
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
+	if user.Verified {
+		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
+			"message": "Account already verified.",
 		})
 		return
 	}
-	service, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
+	if wait, err := reserveMail(ctx, resendKey(user.Id), resendLimit); err != nil {
+		internal.DatabaseError(c, err, "")
+		return
+	} else if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		c.HTML(http.StatusTooManyRequests, "error.tmpl.html", gin.H{
+			"error":   "429 Too Many Requests",
+			"message": "A verification mail was sent to " + *user.Email + " recently, check your inbox or try again in " + lockout.Describe(wait) + ".",
+		})
+		return
+	}
+	verificationId := uuid.NewString()
+	link, err := internal.MailURL("/auth/verify/" + verificationId)
 	if err != nil {
 		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
+		c.HTML(http.StatusServiceUnavailable, "error.tmpl.html", gin.H{
+			"error":   "503 Service Unavailable",
 			"message": "Unable to send verification mail, try again later.",
 		})
 		return
 	}
-
-	user := database.ReadUserById(id.(string))
 	verificationToken, _ := createVerificationToken(user.Id)
-	verificationId := uuid.NewString()
-	database.CreateVerificationId(verificationToken, verificationId)
-	message := &email.Email{
-		To:      []string{*user.Email},
-		From:    os.Getenv("EMAIL"),
-		Subject: "Verify your SocialEcho account",
-		HTML: []byte(fmt.Sprintf(
-			verificationMail,
-			user.Username,
-			*user.Email,
-			fmt.Sprintf("%s/auth/verify/%s", c.Request.Host, verificationId),
-		)),
-	}
-	byteMessage, _ := message.Bytes()
-	mailContent := gmail.Message{
-		Raw: base64.RawURLEncoding.EncodeToString(byteMessage),
+	if err := database.CreateVerificationId(ctx, verificationToken, verificationId); err != nil {
+		internal.DatabaseError(c, err, "")
+		return
 	}
-	if _, err := service.Users.Messages.Send("me", &mailContent).Do(); err != nil {
+	if err := mail.Send(*user.Email, mail.Locale(c.GetHeader("Accept-Language")), "verify", gin.H{
+		"Username": user.Username,
+		"Email":    *user.Email,
+		"Link":     link,
+	}); err != nil {
 		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
+		c.HTML(http.StatusServiceUnavailable, "error.tmpl.html", gin.H{
+			"error":   "503 Service Unavailable",
 			"message": "Unable to send verification mail, try again later.",
 		})
 		return
@@ -153,13 +145,12 @@ func SendVerificationMail(c *gin.Context) {
 
 // verify user account:-
 func Verify(c *gin.Context) {
+	ctx := c.Request.Context()
 	verificationId := c.Param("id")
-	verificationToken := database.ReadVerificationId(verificationId)
-	if verificationToken == "" {
-		c.HTML(http.StatusNotFound, "error.tmpl.html", gin.H{
-			"error":   "404 Not Found",
-			"message": "Verification token not found in database.",
-		})
+	verificationToken, err := database.ReadVerificationId(ctx, verificationId)
+	if err != nil {
+		internal.DatabaseError(c, err, "Verification token not found in database.")
+		return
 	}
 	parsedToken, err := middleware.ParseToken(verificationToken)
 	if err != nil {
@@ -171,19 +162,25 @@ func Verify(c *gin.Context) {
 		return
 	}
 	userId := parsedToken.UserId
-	user := database.ReadUserById(userId)
+	user, err := database.ReadUserById(ctx, userId)
+	if err != nil {
+		internal.DatabaseError(c, err, "User not found.")
+		return
+	}
 	if user.Verified {
 		c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
 			"message": "Account already verified.",
 		})
 		return
 	}
-	if result := database.UpdateUser(userId, map[string]any{"verified": true}); !result {
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "error.tmpl.html", gin.H{
-			"error":   "400 Bad Request",
-			"message": "Unable to verify account, try again later.",
-		})
+	// The link is used up along with verifying
+	if err := database.WithTx(ctx, func(tx database.Store) error {
+		if err := tx.DeleteVerificationId(ctx, verificationId); err != nil {
+			return err
+		}
+		return tx.UpdateUser(ctx, userId, map[string]any{"verified": true})
+	}); err != nil {
+		internal.DatabaseError(c, err, "Verification token not found in database.")
 		return
 	}
 	c.HTML(http.StatusOK, "response.tmpl.html", gin.H{
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Aniket52kr/GO-Assignment/database"
+)
+
+func TestVerify(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	browser := signUp(t, server, "alice")
+
+	if res, body := get(t, browser, server.URL+"/auth/verify?signup=true"); res.StatusCode != http.StatusOK {
+		t.Fatalf("send: %d %s", res.StatusCode, body)
+	}
+	msg := box.next(t)
+	if msg.To != "alice@example.com" {
+		t.Errorf("verification mail went to %s", msg.To)
+	}
+	verify := link(t, msg, "/auth/verify/")
+
+	if res, body := get(t, newBrowser(t), server.URL+verify); res.StatusCode != http.StatusOK {
+		t.Fatalf("verify: %d %s", res.StatusCode, body)
+	}
+	if user, _ := database.ReadUserByName(context.Background(), "alice"); !user.Verified {
+		t.Error("not verified after opening the link")
+	}
+	// The link is used up
+	if res, _ := get(t, newBrowser(t), server.URL+verify); res.StatusCode != http.StatusNotFound {
+		t.Errorf("opening the link again: %d, want 404", res.StatusCode)
+	}
+	// And there's nothing left to send
+	get(t, browser, server.URL+"/auth/verify")
+	box.none(t)
+}
+
+func TestVerifyResendLimit(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	browser := signUp(t, server, "alice")
+
+	get(t, browser, server.URL+"/auth/verify")
+	box.next(t)
+	res, _ := get(t, browser, server.URL+"/auth/verify")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "60" {
+		t.Errorf("sending again straight away: %d, Retry-After %q, want 429 after 60", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	box.none(t)
+}
+
+func TestVerifyResendLimitInARow(t *testing.T) {
+	server := newTestServer(t)
+	box := newMailbox(t)
+	browser := signUp(t, server, "alice")
+	ctx := context.Background()
+	user, _ := database.ReadUserByName(ctx, "alice")
+	// Mails sent a minute apart, the last one two minutes ago
+	start := time.Now().Add(-time.Duration(resendLimit.count+1) * time.Minute)
+	for i := 0; i < resendLimit.count; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		if _, err := database.RecordMailSend(ctx, resendKey(user.Id), at, at.Add(-resendLimit.window)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, _ := get(t, browser, server.URL+"/auth/verify")
+	// An hour after the last one
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") != "3480" {
+		t.Errorf("one more: %d, Retry-After %q, want 429 after 3480", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	box.none(t)
+}
+
+func TestVerifyNeedsPublicURL(t *testing.T) {
+	server := newTestServer(t)
+	browser := signUp(t, server, "alice")
+	// Without a public URL the link could only come from the Host header
+	if res, _ := get(t, browser, server.URL+"/auth/verify"); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("send without PUBLIC_URL: %d, want 503", res.StatusCode)
+	}
+}
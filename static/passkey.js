@@ -0,0 +1,93 @@
+// Passkeys: the server sends WebAuthn options as JSON with the binary fields
+// base64url encoded, the browser wants them as ArrayBuffers, and back again
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    const binary = atob(base64 + "===".slice((base64.length + 3) % 4));
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function passkeyError(message) {
+    const error = document.getElementById("passkey-error");
+    if (error != null) {
+        error.textContent = message;
+    } else {
+        alert(message);
+    }
+}
+
+async function passkeyRequest(url, body) {
+    const response = await fetch(url, { method: "POST", body: body, credentials: "same-origin" });
+    let data = {};
+    try {
+        data = await response.json();
+    } catch (e) {}
+    if (!response.ok) {
+        throw new Error(data.error || "Something went wrong, try again.");
+    }
+    return data;
+}
+
+// Add a passkey with the name in the form
+async function addPasskey(form) {
+    if (!window.PublicKeyCredential) {
+        passkeyError("This browser doesn't support passkeys.");
+        return;
+    }
+    try {
+        const options = (await passkeyRequest(form.action, new FormData(form))).publicKey;
+        options.challenge = base64urlToBuffer(options.challenge);
+        options.user.id = base64urlToBuffer(options.user.id);
+        (options.excludeCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+        const credential = await navigator.credentials.create({ publicKey: options });
+        const data = await passkeyRequest(form.dataset.finish, JSON.stringify({
+            id: credential.id,
+            rawId: bufferToBase64url(credential.rawId),
+            type: credential.type,
+            authenticatorAttachment: credential.authenticatorAttachment,
+            clientExtensionResults: credential.getClientExtensionResults(),
+            response: {
+                clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+                attestationObject: bufferToBase64url(credential.response.attestationObject),
+                transports: credential.response.getTransports ? credential.response.getTransports() : [],
+            },
+        }));
+        window.location = data.redirect;
+    } catch (e) {
+        passkeyError(e.name === "NotAllowedError" ? "Cancelled, or the passkey was already added." : e.message);
+    }
+}
+
+// Log in, or finish logging in, with a passkey
+async function usePasskey(beginUrl, finishUrl) {
+    if (!window.PublicKeyCredential) {
+        passkeyError("This browser doesn't support passkeys.");
+        return;
+    }
+    try {
+        const options = (await passkeyRequest(beginUrl)).publicKey;
+        options.challenge = base64urlToBuffer(options.challenge);
+        (options.allowCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+        const credential = await navigator.credentials.get({ publicKey: options });
+        const data = await passkeyRequest(finishUrl, JSON.stringify({
+            id: credential.id,
+            rawId: bufferToBase64url(credential.rawId),
+            type: credential.type,
+            authenticatorAttachment: credential.authenticatorAttachment,
+            clientExtensionResults: credential.getClientExtensionResults(),
+            response: {
+                clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+                authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+                signature: bufferToBase64url(credential.response.signature),
+                userHandle: credential.response.userHandle ? bufferToBase64url(credential.response.userHandle) : null,
+            },
+        }));
+        window.location = data.redirect;
+    } catch (e) {
+        passkeyError(e.name === "NotAllowedError" ? "Cancelled, try again." : e.message);
+    }
+}
@@ -1,73 +1,133 @@
-function loadUsers(str) {
-    var div = document.getElementById("users");
+var searchTab = "people";
+
+function escapeHTML(str) {
+    return $("<div>").text(str).html();
+}
+
+function renderUser(user) {
+    var content = `
+    <span class="avatar-small">`;
+    if (user.avatar) {
+        content += `<img src="${user.avatar}" />`;
+    } else {
+        content += `<img src="/static/images/avatar.jpg" />`;
+    }
+    content += `
+    </span>
+    <a href="/user/${user.username}">
+        <h3 style="display: inline-block">@${user.username}</h3>
+    </a>
+    &nbsp; `;
+    if (user.follows == true) {
+        content += `
+        <button id="follows-${user.username}" onclick="toggleFollow('${user.username}')">
+            Unfollow
+        </button>`;
+    } else if (user.follows == false) {
+        content += `
+        <button id="follows-${user.username}" onclick="toggleFollow('${user.username}')">
+            Follow
+        </button>`;
+    }
+    content += `
+    <p class="separator">
+        ${user.posts} posts &nbsp; ${user.followers} followers &nbsp; ${user.following}
+        following
+    </p>`;
+    return content;
+}
+
+function renderPost(post) {
+    var content = `<span class="avatar-small">`;
+    if (post.author.avatar) {
+        content += `<img src="${post.author.avatar}" />`;
+    } else {
+        content += `<img src="/static/images/avatar.jpg" />`;
+    }
+    content += `
+    </span>
+    <h3 style="display: inline-block">
+        <a href="/user/${post.author.username}">@${post.author.username}</a>
+    </h3>
+    <a href="/post/${post.id}">
+        <p>${escapeHTML(post.body)}</p>
+        <p class="separator">${post.created_at}</p>
+    </a>`;
+    return content;
+}
+
+// Render a page of results, followed by a "More" link if there is another
+function renderResults(data) {
+    var items = (searchTab == "posts" ? data.posts : data.users) || [];
+    var content = "";
+    items.forEach(function(item) {
+        content += searchTab == "posts" ? renderPost(item) : renderUser(item);
+    });
+    if (data.next_cursor) {
+        content += `
+        <div id="more" data-cursor="${data.next_cursor}">
+        <h3 style="padding-top: 10px">
+            <a onclick="loadMoreResults()">
+            <i class="fa-solid fa-circle-chevron-down"></i> More
+            </a>
+        </h3>
+        </div>`;
+    }
+    return content;
+}
+
+function setSearchTab(tab) {
+    searchTab = tab;
+    $(".tab").css("font-weight", "normal");
+    $(`#tab-${tab}`).css("font-weight", "bold");
+    loadResults(document.getElementById("search").value);
+}
+
+function loadResults(str) {
+    var div = document.getElementById("results");
     if (str.length == 0) {
-        div.innerHTML = `<p style="color: rgb(130, 130, 130)">No users found.</p>`;
+        div.innerHTML = `<p style="color: rgb(130, 130, 130)">No results found.</p>`;
         return;
     }
     $.ajax({
         url: "/search",
         type: "POST",
-        data: { search: str },
+        data: { search: str, type: searchTab },
         success: function(data) {
-            if (!data) {
-                div.innerHTML = `
-                <p style="color: rgb(130, 130, 130)">No users found.</p>`;
-                return;
-            }
-            var content = "";
-            data.forEach(function(user) {
-                content += `
-                <span class="avatar-small">`;
-                if (user.Avatar) {
-                    content += `<img src="${user.Avatar}" />`;
-                } else {
-                    content += `<img src="/static/images/avatar.jpg" />`;
-                }
-                content += `
-                </span>
-                <a href="/user/${user.Username}">
-                    <h3 style="display: inline-block">@${user.Username}</h3>
-                </a>
-                &nbsp; `;
-                if (user.Follows == true) {
-                    content += `
-                    <button id="follows-${user.Username}" onclick="toggleFollow('${user.Username}')">
-                        Unfollow
-                    </button>`;
-                } else if (user.Follows == false) {
-                    content += `
-                    <button id="follows-${user.Username}" onclick="toggleFollow('${user.Username}')">
-                        Follow
-                    </button>`;
-                }
-                content += `
-                    <p class="separator">
-                        ${user.Posts} posts &nbsp; ${user.Followers} followers &nbsp; ${user.Following}
-                        following
-                    </p>`;
-            });
-            if (data.length == 10) {
-                content += `
-                <div id="more">
-                <h3 style="padding-top: 10px">
-                    <a onclick="loadMoreUsers()">
-                    <i class="fa-solid fa-circle-chevron-down"></i> More
-                    </a>
-                </h3>
-                </div>`;
+            var content = renderResults(data);
+            if (!content) {
+                content = `<p style="color: rgb(130, 130, 130)">No results found.</p>`;
             }
             div.innerHTML = content;
         },
     });
 }
 
+// Load more results in search
+function loadMoreResults() {
+    $.ajax({
+        url: "/search/more",
+        type: "GET",
+        data: { cursor: $("#more").attr("data-cursor"), type: searchTab },
+        success: function(data) {
+            $("#more").remove();
+            $("#results").append(renderResults(data));
+        },
+    });
+}
+
 function toggleFollow(username) {
     var follows = document.getElementById(`follows-${username}`);
     $.ajax({
         url: `/search/${username}/toggle-follow`,
         type: "POST",
-        success: function() {
-            follows.innerText = follows.innerText == "Unfollow" ? "Follow" : "Unfollow";
+        success: function(data) {
+            follows.innerText = data.follows ? "Unfollow" : "Follow";
+        },
+        error: function(xhr) {
+            try {
+                alert(JSON.parse(xhr.responseText).error);
+            } catch (e) {}
         }
     });
 }